@@ -0,0 +1,31 @@
+module github.com/aoeldemann/fluent10g-paper-fpl2018
+
+go 1.20
+
+// gofluent10g and gopcie have no tagged releases. gofluent10g is pinned to the
+// commit the measurements have been performed with (see
+// reproducible-research/README.md), "go mod tidy" resolves it to its
+// pseudo-version. No gopcie commit has been recorded, "go mod tidy" pins the
+// latest one. It also adds the checksums of both modules to go.sum.
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/aoeldemann/gofluent10g 8ab4e0cbe5970bccd07c8f2482b8abcdb5fdda74
+	github.com/google/gopacket v1.1.19
+	gonum.org/v1/plot v0.14.0
+)
+
+require (
+	git.sr.ht/~sbinet/gg v0.5.0 // indirect
+	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
+	github.com/campoy/embedmd v1.0.0 // indirect
+	github.com/go-fonts/liberation v0.3.1 // indirect
+	github.com/go-latex/latex v0.0.0-20230307184459-12ec69307ad9 // indirect
+	github.com/go-pdf/fpdf v0.8.0 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/image v0.11.0 // indirect
+	golang.org/x/net v0.6.0 // indirect
+	golang.org/x/sys v0.11.0 // indirect
+	golang.org/x/text v0.12.0 // indirect
+)
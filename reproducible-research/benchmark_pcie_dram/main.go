@@ -31,21 +31,33 @@ package main
 
 import (
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gopcie"
 	"sync"
 	"time"
 )
 
 var (
-	// read/write PCIExpress character devices
-	PCIE_DEV_WR = "/dev/xdma0_h2c_0"
-	PCIE_DEV_RD = "/dev/xdma0_c2h_0"
-
-	// dma transfer size
-	dmaTransferSize = 64 * 1024 * 1024
-
-	// duration of the read and write benchmarks
-	benchmarkDuration = 30 * time.Second
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// read/write PCIExpress character devices and dma transfer size
+		PCIe: config.PCIe{
+			DevWr:        "/dev/xdma0_h2c_0",
+			DevRd:        "/dev/xdma0_c2h_0",
+			TransferSize: 64 * 1024 * 1024,
+		},
+
+		// duration of the read and write benchmarks
+		Duration: config.Duration{Duration: 30 * time.Second},
+
+		// output directory (unused, results are printed to stdout)
+		OutDir: "output",
+	}
 
 	// goroutine sync stuff
 	syncWg   sync.WaitGroup
@@ -58,7 +70,7 @@ func rdwr(dev *gopcie.PCIeDMA, rdwr int, throughput *float64) {
 
 	defer syncWg.Done()
 
-	data := make([]byte, dmaTransferSize)
+	data := make([]byte, exp.PCIe.TransferSize)
 
 	var totalTime time.Duration
 	var totalBytes uint64
@@ -87,21 +99,37 @@ func rdwr(dev *gopcie.PCIeDMA, rdwr int, throughput *float64) {
 
 		// sum up transfer time and size
 		totalTime += time.Since(transferStartTime)
-		totalBytes += uint64(dmaTransferSize)
+		totalBytes += uint64(exp.PCIe.TransferSize)
 	}
 
 	*throughput = 8.0 * float64(totalBytes) / totalTime.Seconds() / 1e9
 }
 
 func main() {
+	// parse command line and load experiment configuration
+	opts, err := cli.Parse(&exp, cli.FlagDuration)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// nothing else to do in dry-run mode
+	if opts.DryRun {
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("benchmark_pcie_dram", &exp)
+	defer man.Close()
+
 	// open devices
-	devRd, err := gopcie.PCIeDMAOpen(PCIE_DEV_RD,
+	devRd, err := gopcie.PCIeDMAOpen(exp.PCIe.DevRd,
 		gopcie.PCIE_ACCESS_READ)
 	if err != nil {
 		panic("could not open dev for reading")
 	}
 	defer devRd.Close()
-	devWr, err := gopcie.PCIeDMAOpen(PCIE_DEV_WR,
+	devWr, err := gopcie.PCIeDMAOpen(exp.PCIe.DevWr,
 		gopcie.PCIE_ACCESS_WRITE)
 	if err != nil {
 		panic("could not open dev for writing")
@@ -116,14 +144,14 @@ func main() {
 	// read benchmark
 	syncWg.Add(1)
 	go rdwr(devRd, 0, &throughputRd)
-	time.Sleep(benchmarkDuration)
+	time.Sleep(exp.Duration.Duration)
 	syncChan <- true
 	syncWg.Wait()
 
 	// write benchmark
 	syncWg.Add(1)
 	go rdwr(devWr, 1, &throughputWr)
-	time.Sleep(benchmarkDuration)
+	time.Sleep(exp.Duration.Duration)
 	syncChan <- true
 	syncWg.Wait()
 
@@ -131,4 +159,20 @@ func main() {
 	fmt.Printf("Read throughput: %.2f\n", throughputRd)
 	fmt.Printf("Write throughput: %.2f\n", throughputWr)
 	fmt.Printf("\n")
+
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "benchmark_pcie_dram",
+		exp.Seed)
+	if err != nil {
+		panic("could not create result record file")
+	}
+	defer resultWriter.Close()
+
+	// write result record (throughput in Gbps)
+	rec := results.NewRecord("PCIe DMA Read/Write")
+	rec.Params["transfer_size"] = exp.PCIe.TransferSize
+	rec.Params["duration"] = exp.Duration.String()
+	rec.Values["throughput_rd_gbps"] = throughputRd
+	rec.Values["throughput_wr_gbps"] = throughputWr
+	resultWriter.Write(rec)
 }
@@ -0,0 +1,92 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Compares the output of all measurement programs against the reference
+// output in their output_ref directories and prints a pass/fail report.
+// The program exits with a non-zero status if any comparison fails, if
+// output files have not been generated (unless --allow-missing is set) or if
+// nothing has been compared at all.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/compare"
+	"os"
+)
+
+func main() {
+	tol := compare.TolerancesDefault()
+
+	root := flag.String("root", "..",
+		"directory containing the measurement programs")
+	outDir := flag.String("out-dir", compare.OutDirDefault,
+		"name of the output directories of the measurement programs")
+	allowMissing := flag.Bool("allow-missing", false,
+		"skip output files that have not been generated instead of failing")
+	flag.Float64Var(&tol.KSMax, "ks-max", tol.KSMax,
+		"maximum Kolmogorov-Smirnov distance of latency histograms")
+	flag.Float64Var(&tol.EMDMax, "emd-max", tol.EMDMax,
+		"maximum earth mover's distance of latency histograms in ns")
+	flag.Float64Var(&tol.RelTol, "rel-tol", tol.RelTol,
+		"maximum relative deviation of throughput values")
+	flag.Parse()
+
+	results := compare.Run(*root, *outDir, tol)
+
+	nFailed := 0
+	nPassed := 0
+	for _, res := range results {
+		fmt.Printf("%-4s %s/%s\n", res.Status, res.Experiment, res.File)
+		if res.Detail != "" {
+			fmt.Printf("     %s\n", res.Detail)
+		}
+
+		switch res.Status {
+		case compare.StatusFail:
+			nFailed++
+		case compare.StatusPass:
+			nPassed++
+		}
+	}
+
+	nSkipped := len(results) - nPassed - nFailed
+	fmt.Printf("\n%d passed, %d failed, %d skipped\n", nPassed, nFailed,
+		nSkipped)
+
+	if nSkipped > 0 && !*allowMissing {
+		fmt.Printf("output files are missing (see --allow-missing)\n")
+	}
+	if nPassed == 0 {
+		fmt.Printf("nothing has been compared\n")
+	}
+
+	if nFailed > 0 || (nSkipped > 0 && !*allowMissing) || nPassed == 0 {
+		os.Exit(1)
+	}
+}
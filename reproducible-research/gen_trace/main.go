@@ -0,0 +1,365 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Generates a random traffic trace (uniformly distributed packet sizes or
+// packet sizes drawn from a distribution, exponentially distributed
+// inter-packet gaps or gaps drawn from a gap model) in the hardware trace
+// format and writes it to disk, either as raw trace data or as trace container
+// file including seed and generator parameters. The trace is generated in
+// chunks, so its size is not limited by host memory. Optionally merges
+// multiple flows with their own data rates, packet sizes, gap models and
+// headers into one trace. Packets may carry sequence tags to detect loss,
+// reordering and duplication in captures. Does not require any hardware.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	datarate := flag.Float64("rate", 8e9, "mean data rate in bps")
+	duration := flag.Duration("duration", 60*time.Second, "trace duration")
+	captureLen := flag.Int("capture-len", 34,
+		"number of bytes of each packet transferred to the hardware "+
+			"(default with --headers: length of the headers)")
+	seed := flag.Int64("seed", 1, "seed for random trace generation")
+	pktlenDist := flag.String("pktlen-dist", "", "packet size distribution: "+
+		"IMIX profile, table (e.g. 64:7,594:4,1518:1) or histogram file "+
+		"(default: uniform between 64 and 1518 bytes)")
+	gapModel := flag.String("gap-model", "", "inter-packet gap model, e.g. "+
+		"pareto:alpha=1.5 or onoff:burst=32 (default: exponential)")
+	headers := flag.String("headers", "", "TOML file containing a packet "+
+		"header template (default: ethernet and ipv4 header)")
+	flowFile := flag.String("flows", "", "TOML file describing the flows "+
+		"of a multi-flow trace (replaces --rate, --pktlen-dist, "+
+		"--gap-model and --headers)")
+	flowStats := flag.String("flow-stats", "", "write expected packet "+
+		"counts per flow to JSON file")
+	container := flag.Bool("container", false, "write a trace container "+
+		"file including seed and generator parameters (see tracegen.Load)")
+	seqTag := flag.Bool("seq-tag", false, "embed flow ID and sequence "+
+		"number into each packet (see tracegen.SeqTag)")
+	seqTagOffset := flag.Int("seq-tag-offset", 0, "byte offset of the "+
+		"sequence tag (default: directly after the headers)")
+	chunkSize := flag.Int("chunk-size", tracegen.ChunkSizeDefault,
+		"number of bytes generated at once")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <trace file>\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *datarate <= 0.0 || *datarate > 10e9 {
+		fmt.Fprintf(os.Stderr, "invalid data rate %.2f bps\n", *datarate)
+		os.Exit(1)
+	}
+	if *captureLen < 0 || *captureLen > 1514 {
+		fmt.Fprintf(os.Stderr, "invalid capture length %d\n", *captureLen)
+		os.Exit(1)
+	}
+
+	if *seqTagOffset < 0 {
+		fmt.Fprintf(os.Stderr, "invalid sequence tag offset %d\n",
+			*seqTagOffset)
+		os.Exit(1)
+	}
+
+	rnd := rand.New(rand.NewSource(*seed))
+
+	var src tracegen.PacketSource
+	var fs *tracegen.FlowSource
+	if *flowFile != "" {
+		// multi-flow trace, see tracegen.GenFlows
+		flows, err := loadFlows(*flowFile, *captureLen)
+		if err == nil && *seqTag {
+			// flows are identified by their index
+			for i := range flows {
+				setSeqTag(&flows[i].Traffic, uint32(i), *seqTagOffset)
+			}
+		}
+		if err == nil {
+			fs, err = tracegen.FlowSourceCreate(rnd, flows, *duration)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		src = fs
+	} else {
+		traffic := tracegen.Traffic{
+			Datarate:   *datarate,
+			CaptureLen: *captureLen,
+			Duration:   *duration,
+		}
+
+		var err error
+		if *pktlenDist != "" {
+			traffic.Pktlens, err = tracegen.ParsePktlenDist(*pktlenDist)
+		}
+		if err == nil && *gapModel != "" {
+			traffic.Gaps, err = tracegen.ParseGapModel(*gapModel)
+		}
+		if err == nil && *headers != "" {
+			traffic.Headers, err = loadHeaders(*headers)
+		}
+		if err == nil && traffic.Headers != nil && !isSet("capture-len") {
+			traffic.CaptureLen, err = headersLen(traffic.Headers)
+		}
+		if err == nil && *seqTag {
+			setSeqTag(&traffic, 0, *seqTagOffset)
+		}
+		if err == nil {
+			// same packets as generated by tracegen.GenTraffic for the same
+			// seed
+			src, err = tracegen.StreamTraffic(rnd, traffic)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	s := tracegen.StreamCreate(src, *chunkSize)
+
+	var n int64
+	var err error
+	if *container {
+		n, err = tracegen.SaveStream(flag.Arg(0), s, tracegen.Meta{
+			Seed:   *seed,
+			Params: generatorParams(),
+		})
+	} else {
+		n, err = writeRaw(flag.Arg(0), s)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write trace to '%s': %s\n",
+			flag.Arg(0), err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("packets:    %d\n", s.NumPackets())
+	fmt.Printf("trace size: %d bytes\n", n)
+	fmt.Printf("duration:   %s\n", s.Duration())
+	fmt.Printf("sha256:     %s\n", s.Checksum())
+
+	if fs == nil {
+		return
+	}
+
+	// expected number of packets per flow, e.g. to check captures
+	fmt.Printf("\n%-20s %12s %16s %12s\n", "flow", "packets", "bytes",
+		"delayed")
+	for _, stats := range fs.Stats() {
+		fmt.Printf("%-20s %12d %16d %12d\n", stats.Name, stats.NumPackets,
+			stats.BytesWire, stats.NumDelayed)
+	}
+	if fs.NumGapsCapped() > 0 {
+		fmt.Printf("warning: %d inter-packet times capped at hardware "+
+			"limit of 2^32-1 cycles\n", fs.NumGapsCapped())
+	}
+
+	if *flowStats != "" {
+		buf, err := json.MarshalIndent(fs.Stats(), "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(*flowStats, buf, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write flow statistics to "+
+				"'%s': %s\n", *flowStats, err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// writes the raw trace data of the stream s to a file
+func writeRaw(filename string, s *tracegen.Stream) (int64, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.WriteTo(file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return n, err
+}
+
+// returns the generator parameters stored in trace container files: the
+// values of all flags that influence the generated trace (header templates
+// and flows are referenced by their file name)
+func generatorParams() map[string]interface{} {
+	params := make(map[string]interface{})
+	for _, name := range []string{"rate", "duration", "capture-len",
+		"pktlen-dist", "gap-model", "headers", "flows", "seq-tag",
+		"seq-tag-offset"} {
+		params[strings.Replace(name, "-", "_", -1)] =
+			flag.Lookup(name).Value.String()
+	}
+	return params
+}
+
+// embeds sequence tags with the given flow ID into the packets of traffic t.
+// The tag is placed directly after the transferred bytes if offset is zero,
+// the number of transferred bytes is extended to include the tag
+func setSeqTag(t *tracegen.Traffic, flowID uint32, offset int) {
+	if offset == 0 {
+		offset = t.CaptureLen
+	}
+	t.SeqTag = &tracegen.SeqTag{Offset: offset, FlowID: flowID}
+	if t.CaptureLen < offset+tracegen.SeqTagLen {
+		t.CaptureLen = offset + tracegen.SeqTagLen
+	}
+}
+
+// flow of a multi-flow trace as specified in a flow file
+type flowConfig struct {
+	Name       string                   `toml:"name"`
+	Rate       float64                  `toml:"rate"`
+	PktlenDist string                   `toml:"pktlen_dist"`
+	GapModel   string                   `toml:"gap_model"`
+	CaptureLen int                      `toml:"capture_len"`
+	Start      config.Duration          `toml:"start"`
+	Stop       config.Duration          `toml:"stop"`
+	Headers    *tracegen.HeaderTemplate `toml:"headers"`
+}
+
+// loads the flows of a multi-flow trace from a TOML file. captureLen is used
+// for flows without header template and capture length
+func loadFlows(filename string, captureLen int) ([]tracegen.Flow, error) {
+	var file struct {
+		Flows []flowConfig `toml:"flows"`
+	}
+	md, err := toml.DecodeFile(filename, &file)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown parameter '%s' in flow file",
+			undecoded[0].String())
+	}
+
+	var flows []tracegen.Flow
+	datarateSum := 0.0
+	for i, cfg := range file.Flows {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("flow%d", i)
+		}
+		if cfg.Rate <= 0.0 || cfg.Rate > 10e9 {
+			return nil, fmt.Errorf("invalid data rate %.2f bps of flow '%s'",
+				cfg.Rate, cfg.Name)
+		}
+		datarateSum += cfg.Rate
+
+		t := tracegen.Traffic{
+			Datarate:   cfg.Rate,
+			CaptureLen: cfg.CaptureLen,
+			Headers:    cfg.Headers,
+		}
+		if cfg.PktlenDist != "" {
+			t.Pktlens, err = tracegen.ParsePktlenDist(cfg.PktlenDist)
+		}
+		if err == nil && cfg.GapModel != "" {
+			t.Gaps, err = tracegen.ParseGapModel(cfg.GapModel)
+		}
+		if err == nil && t.CaptureLen == 0 {
+			t.CaptureLen = captureLen
+			if t.Headers != nil {
+				t.CaptureLen, err = headersLen(t.Headers)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("flow '%s': %s", cfg.Name, err.Error())
+		}
+
+		flows = append(flows, tracegen.Flow{
+			Name:    cfg.Name,
+			Traffic: t,
+			Start:   cfg.Start.Duration,
+			Stop:    cfg.Stop.Duration,
+		})
+	}
+
+	if datarateSum > 10e9 {
+		fmt.Fprintf(os.Stderr, "warning: data rates of all flows add up to "+
+			"%.2f bps, packets will be delayed\n", datarateSum)
+	}
+
+	return flows, nil
+}
+
+// returns the length of the headers described by a header template. all
+// headers are transferred to the hardware by default
+func headersLen(t *tracegen.HeaderTemplate) (int, error) {
+	h, err := t.Compile()
+	if err != nil {
+		return 0, err
+	}
+	return h.Len(), nil
+}
+
+// loads a packet header template from a TOML file
+func loadHeaders(filename string) (*tracegen.HeaderTemplate, error) {
+	var t tracegen.HeaderTemplate
+	md, err := toml.DecodeFile(filename, &t)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown parameter '%s' in header template",
+			undecoded[0].String())
+	}
+	return &t, nil
+}
+
+// returns true if the flag name has been set on the command line
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,304 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Prints the packets of a trace saved to disk (e.g. with --save-traces) in the
+// hardware trace format: inter-packet time, capture length, wire length and
+// decoded packet headers of each packet, followed by summary statistics.
+// Trace container files are memory-mapped, their meta data is printed as
+// well. Optionally exports the trace to a PCAP file. Does not require any
+// hardware.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summary statistics of a trace
+type stats struct {
+	nPkts int
+
+	cycles    uint64
+	cyclesMin uint64
+	cyclesMax uint64
+
+	captureLenMin int
+	captureLenMax int
+
+	wireLenMin int
+	wireLenMax int
+
+	// number of bits on the wire incl. FCS, preamble, SOD and inter-frame
+	// gap
+	bitsWire uint64
+}
+
+func (s *stats) add(pkt *tracegen.Packet) {
+	if s.nPkts == 0 {
+		s.cyclesMin, s.cyclesMax = pkt.CyclesInterPacket, pkt.CyclesInterPacket
+		s.captureLenMin, s.captureLenMax = pkt.CaptureLen, pkt.CaptureLen
+		s.wireLenMin, s.wireLenMax = pkt.WireLen, pkt.WireLen
+	}
+
+	s.nPkts++
+	s.cycles += pkt.CyclesInterPacket
+	s.bitsWire += uint64(8 * (pkt.WireLen + 24))
+
+	if pkt.CyclesInterPacket < s.cyclesMin {
+		s.cyclesMin = pkt.CyclesInterPacket
+	}
+	if pkt.CyclesInterPacket > s.cyclesMax {
+		s.cyclesMax = pkt.CyclesInterPacket
+	}
+	if pkt.CaptureLen < s.captureLenMin {
+		s.captureLenMin = pkt.CaptureLen
+	}
+	if pkt.CaptureLen > s.captureLenMax {
+		s.captureLenMax = pkt.CaptureLen
+	}
+	if pkt.WireLen < s.wireLenMin {
+		s.wireLenMin = pkt.WireLen
+	}
+	if pkt.WireLen > s.wireLenMax {
+		s.wireLenMax = pkt.WireLen
+	}
+}
+
+func main() {
+	count := flag.Int("count", -1,
+		"number of packets to print (default: all)")
+	skip := flag.Int("skip", 0, "number of packets to skip before printing")
+	summary := flag.Bool("summary", false,
+		"only print summary statistics")
+	dump := flag.Bool("hex", false, "print hex dump of the packet data")
+	pcapFile := flag.String("pcap", "", "export trace to PCAP file, "+
+		"packets are timestamped with their scheduled departure time")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <trace file>\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	buf, meta, release, err := readTrace(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	defer release()
+
+	var s stats
+
+	d := tracegen.DecoderCreate(buf)
+	for i := 0; ; i++ {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		s.add(pkt)
+
+		if *summary || i < *skip || (*count >= 0 && i >= *skip+*count) {
+			continue
+		}
+
+		fmt.Printf("%8d  gap %10d cycles %14.1f ns  caplen %5d  "+
+			"wirelen %5d  %s\n", i, pkt.CyclesInterPacket,
+			float64(pkt.CyclesInterPacket)/gofluent10g.FREQ_SFP*1e9,
+			pkt.CaptureLen, pkt.WireLen, describeHeaders(pkt.Data))
+		if *dump {
+			fmt.Print(hex.Dump(pkt.Data))
+		}
+	}
+
+	printSummary(&s, len(buf), d.Offset())
+	if meta != nil {
+		printMeta(meta)
+	}
+
+	if *pcapFile != "" {
+		// timestamps start at zero, so that they can be compared to the
+		// arrival times of captured packets
+		data := &tracegen.Data{Buf: buf, NumPackets: s.nPkts}
+		if err := data.WritePcap(*pcapFile, time.Unix(0, 0)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// reads the trace data of a raw trace file or maps the trace data of a trace
+// container file into memory. The returned function releases the trace data.
+func readTrace(filename string) ([]byte, *tracegen.Meta, func(), error) {
+	container, err := tracegen.IsContainerFile(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !container {
+		buf, err := ioutil.ReadFile(filename)
+		return buf, nil, func() {}, err
+	}
+
+	t, err := tracegen.LoadMmap(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := t.Meta.Verify(t.Data); err != nil {
+		t.Close()
+		return nil, nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return t.Data.Buf, t.Meta, func() { t.Close() }, nil
+}
+
+// returns a one-line description of the packet headers contained in data
+func describeHeaders(data []byte) string {
+	pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet,
+		gopacket.NoCopy)
+
+	var descs []string
+	pktLayers := pkt.Layers()
+	for i, layer := range pktLayers {
+		// decoding of a layer failed if it is followed by a decode failure
+		// and could not extract any header bytes. only packet headers are
+		// stored in most traces, so this usually happens at the end of the
+		// captured data
+		if i+1 < len(pktLayers) && len(layer.LayerContents()) == 0 {
+			if _, ok := pktLayers[i+1].(*gopacket.DecodeFailure); ok {
+				descs = append(descs, fmt.Sprintf("%s (truncated)",
+					layer.LayerType()))
+				continue
+			}
+		}
+
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			descs = append(descs, fmt.Sprintf("eth %s > %s type 0x%04x",
+				l.SrcMAC, l.DstMAC, uint16(l.EthernetType)))
+		case *layers.Dot1Q:
+			descs = append(descs, fmt.Sprintf("vlan %d prio %d type 0x%04x",
+				l.VLANIdentifier, l.Priority, uint16(l.Type)))
+		case *layers.MPLS:
+			descs = append(descs, fmt.Sprintf("mpls label %d",
+				l.Label))
+		case *layers.IPv4:
+			descs = append(descs, fmt.Sprintf("ipv4 %s > %s proto %d "+
+				"len %d", l.SrcIP, l.DstIP, l.Protocol, l.Length))
+		case *layers.IPv6:
+			descs = append(descs, fmt.Sprintf("ipv6 %s > %s next %d "+
+				"len %d", l.SrcIP, l.DstIP, l.NextHeader, l.Length))
+		case *layers.UDP:
+			descs = append(descs, fmt.Sprintf("udp %d > %d", l.SrcPort,
+				l.DstPort))
+		case *layers.TCP:
+			descs = append(descs, fmt.Sprintf("tcp %d > %d seq %d",
+				l.SrcPort, l.DstPort, l.Seq))
+		case *gopacket.Payload:
+			descs = append(descs, fmt.Sprintf("payload %d bytes",
+				len(l.Payload())))
+		case *gopacket.DecodeFailure:
+			if len(l.LayerContents()) > 0 {
+				descs = append(descs, fmt.Sprintf("undecoded %d bytes",
+					len(l.LayerContents())))
+			}
+		default:
+			descs = append(descs, layer.LayerType().String())
+		}
+	}
+
+	return strings.Join(descs, " | ")
+}
+
+func printSummary(s *stats, traceSize, dataSize int) {
+	duration := float64(s.cycles) / gofluent10g.FREQ_SFP
+
+	fmt.Printf("\n")
+	fmt.Printf("packets:             %d\n", s.nPkts)
+	fmt.Printf("trace size:          %d bytes (%d bytes padding)\n",
+		traceSize, traceSize-dataSize)
+	fmt.Printf("duration:            %.9f s (%d cycles)\n", duration,
+		s.cycles)
+	if s.nPkts == 0 {
+		return
+	}
+
+	if s.cycles > 0 {
+		fmt.Printf("mean data rate:      %.3f Gbps\n", float64(s.bitsWire)/
+			duration/1e9)
+		fmt.Printf("mean packet rate:    %.3f Mpps\n", float64(s.nPkts)/
+			duration/1e6)
+	}
+	fmt.Printf("inter-packet cycles: min %d, mean %.1f, max %d\n",
+		s.cyclesMin, float64(s.cycles)/float64(s.nPkts), s.cyclesMax)
+	fmt.Printf("capture length:      min %d, max %d\n", s.captureLenMin,
+		s.captureLenMax)
+	fmt.Printf("wire length:         min %d, max %d\n", s.wireLenMin,
+		s.wireLenMax)
+
+	if s.cyclesMax == tracegen.CyclesInterPacketMax {
+		fmt.Printf("warning: inter-packet time capped at hardware limit " +
+			"of 2^32-1 cycles\n")
+	}
+}
+
+// prints the meta data of a trace container file
+func printMeta(meta *tracegen.Meta) {
+	fmt.Printf("replay count:        %d\n", meta.ReplayCount)
+	fmt.Printf("seed:                %d\n", meta.Seed)
+	fmt.Printf("sha256:              %s\n", meta.Checksum)
+
+	keys := make([]string, 0, len(meta.Params))
+	for key := range meta.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := json.Marshal(meta.Params[key])
+		fmt.Printf("param %-13s %s\n", key+":", value)
+	}
+}
@@ -0,0 +1,401 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package cli provides the command line interface shared by all measurement
+// programs. Parameters are resolved in the following order: program
+// defaults, experiment configuration file (-config), command line flags.
+
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/gofluent10g"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options holds command line options that are not part of the experiment
+// configuration
+type Options struct {
+	// only print what would be done, do not perform any measurements
+	DryRun bool
+
+	// save generated traces to the output directory (see inspect_trace)
+	SaveTraces bool
+
+	// load traces saved with --save-traces from the output directory instead
+	// of generating them
+	LoadTraces bool
+
+	// save captured packets to PCAPNG files in the output directory
+	SaveCaptures bool
+
+	// generate each random trace a second time from the same seed and make
+	// sure it is byte-identical (see tracegen.CheckReproducible)
+	CheckReproducible bool
+}
+
+// list of comma-separated floats
+type floatList []float64
+
+func (l *floatList) String() string {
+	strs := make([]string, len(*l))
+	for i, v := range *l {
+		strs[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(strs, ",")
+}
+
+func (l *floatList) Set(s string) error {
+	*l = nil
+	for _, str := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// list of comma-separated integers
+type intList []int
+
+func (l *intList) String() string {
+	strs := make([]string, len(*l))
+	for i, v := range *l {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ",")
+}
+
+func (l *intList) Set(s string) error {
+	*l = nil
+	for _, str := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// list of comma-separated durations
+type durationList []time.Duration
+
+func (l *durationList) String() string {
+	strs := make([]string, len(*l))
+	for i, v := range *l {
+		strs[i] = v.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+func (l *durationList) Set(s string) error {
+	*l = nil
+	for _, str := range strings.Split(s, ",") {
+		v, err := time.ParseDuration(strings.TrimSpace(str))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// log levels that can be selected on the command line
+var logLevels = map[string]int{
+	"error": gofluent10g.LOG_ERR,
+	"info":  gofluent10g.LOG_INFO,
+	"debug": gofluent10g.LOG_DEBUG,
+}
+
+// Flags selects the groups of command line flags a program accepts in
+// addition to --config, --out-dir, --log-level, --seed and --dry-run, which
+// are accepted by all programs. Flags of other groups are rejected.
+type Flags uint
+
+// command line flag groups
+const (
+	// --rates
+	FlagRates Flags = 1 << iota
+
+	// --pktlens
+	FlagPktlens
+
+	// --duration
+	FlagDuration
+
+	// --gen-if, --recv-if
+	FlagInterfaces
+
+	// --pcap, --speedup, --line-rate
+	FlagPcap
+
+	// --pktlen-dist, --gap-model
+	FlagTraffic
+
+	// --seq-tag
+	FlagSeqTag
+
+	// --histogram-binning, --histogram-cdf, --latency-series,
+	// --latency-windows
+	FlagLatency
+
+	// --save-traces
+	FlagSaveTraces
+
+	// --load-traces
+	FlagLoadTraces
+
+	// --save-captures
+	FlagSaveCaptures
+
+	// --check-reproducible
+	FlagCheckReproducible
+)
+
+// Parse parses the command line and resolves the experiment configuration
+// exp. exp must hold the program defaults when Parse is called. Only the
+// flags selected by flags are accepted. An error is returned if the resulting
+// configuration is invalid. If --dry-run is set, the resolved configuration
+// is printed.
+func Parse(exp *config.Experiment, flags Flags) (*Options, error) {
+	opts := &Options{}
+
+	var (
+		configFile string
+		rates      floatList
+		pktlens    intList
+		duration   time.Duration
+		ifsGen     intList
+		ifsRecv    intList
+		outDir     string
+		logLevel   string
+		seed       int64
+		pcapFile   string
+		speedup    float64
+		lineRate   bool
+		pktlenDist string
+		gapModel   string
+		binning    string
+		cdf        bool
+		series     bool
+		windows    durationList
+		seqTag     bool
+	)
+
+	flag.StringVar(&configFile, "config", "",
+		"experiment configuration file (TOML)")
+	flag.StringVar(&outDir, "out-dir", "", "output directory")
+	flag.StringVar(&logLevel, "log-level", "info",
+		"log level (error, info, debug)")
+	flag.Int64Var(&seed, "seed", 0,
+		"seed for random trace generation (default: derived from time)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false,
+		"print measurement plan, do not perform measurements")
+
+	if flags&FlagRates != 0 {
+		flag.Var(&rates, "rates",
+			"comma-separated list of data rates per interface in bps")
+	}
+	if flags&FlagPktlens != 0 {
+		flag.Var(&pktlens, "pktlens",
+			"comma-separated list of packet sizes in bytes")
+	}
+	if flags&FlagDuration != 0 {
+		flag.DurationVar(&duration, "duration", 0, "measurement duration")
+	}
+	if flags&FlagInterfaces != 0 {
+		flag.Var(&ifsGen, "gen-if",
+			"generator interface id(s), comma-separated")
+		flag.Var(&ifsRecv, "recv-if",
+			"receiver interface id(s), comma-separated")
+	}
+	if flags&FlagPcap != 0 {
+		flag.StringVar(&pcapFile, "pcap", "",
+			"PCAP or PCAPNG file to replay")
+		flag.Float64Var(&speedup, "speedup", 0,
+			"PCAP replay speed relative to the original capture")
+		flag.BoolVar(&lineRate, "line-rate", false,
+			"replay PCAP packets back-to-back at line rate")
+	}
+	if flags&FlagTraffic != 0 {
+		flag.StringVar(&pktlenDist, "pktlen-dist", "", "packet size "+
+			"distribution of random traces (IMIX profile, table or file)")
+		flag.StringVar(&gapModel, "gap-model", "", "inter-packet gap "+
+			"model of random traces (e.g. pareto:alpha=1.5)")
+	}
+	if flags&FlagSeqTag != 0 {
+		flag.BoolVar(&seqTag, "seq-tag", false, "embed sequence tags into "+
+			"generated packets and check for lost, reordered and "+
+			"duplicated packets")
+	}
+	if flags&FlagLatency != 0 {
+		flag.StringVar(&binning, "histogram-binning", "", "binning of "+
+			"latency histograms, e.g. clock:cycles=2 or log:bins=100 "+
+			"(default: exact)")
+		flag.BoolVar(&cdf, "histogram-cdf", false, "also write "+
+			"cumulative latency distributions")
+		flag.BoolVar(&series, "latency-series", false, "write arrival "+
+			"time and latency of each captured packet")
+		flag.Var(&windows, "latency-windows", "comma-separated widths of "+
+			"time windows latency statistics are aggregated in (e.g. "+
+			"1ms,100ms)")
+	}
+	if flags&FlagSaveTraces != 0 {
+		flag.BoolVar(&opts.SaveTraces, "save-traces", false,
+			"save generated traces to the output directory")
+	}
+	if flags&FlagLoadTraces != 0 {
+		flag.BoolVar(&opts.LoadTraces, "load-traces", false, "load traces "+
+			"saved with --save-traces from the output directory")
+	}
+	if flags&FlagSaveCaptures != 0 {
+		flag.BoolVar(&opts.SaveCaptures, "save-captures", false,
+			"save captured packets to PCAPNG files in the output directory")
+	}
+	if flags&FlagCheckReproducible != 0 {
+		flag.BoolVar(&opts.CheckReproducible, "check-reproducible", false,
+			"generate each random trace twice and abort if the traces differ")
+	}
+	flag.Parse()
+
+	level, ok := logLevels[logLevel]
+	if !ok {
+		return nil, fmt.Errorf("invalid log level '%s'", logLevel)
+	}
+	gofluent10g.LogSetLevel(level)
+
+	if configFile != "" {
+		if err := config.Load(configFile, exp); err != nil {
+			return nil, err
+		}
+	}
+
+	// flags that have been set explicitly override the configuration file
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rates":
+			exp.Datarates = rates
+		case "pktlens":
+			exp.Pktlens = pktlens
+		case "duration":
+			exp.Duration.Duration = duration
+		case "gen-if":
+			err = setInterfaces(&exp.IfGen, &exp.IfsGen, ifsGen)
+		case "recv-if":
+			err = setInterfaces(&exp.IfRecv, &exp.IfsRecv, ifsRecv)
+		case "out-dir":
+			exp.OutDir = outDir
+		case "seed":
+			exp.Seed = seed
+			exp.SeedSet = true
+		case "pcap":
+			exp.Pcap.File = pcapFile
+		case "speedup":
+			exp.Pcap.Speedup = speedup
+		case "line-rate":
+			exp.Pcap.LineRate = lineRate
+		case "pktlen-dist":
+			exp.PktlenDist = pktlenDist
+		case "gap-model":
+			exp.GapModel = gapModel
+		case "histogram-binning":
+			exp.Histogram.Binning = binning
+		case "histogram-cdf":
+			exp.Histogram.CDF = cdf
+		case "seq-tag":
+			exp.SeqTag.Enabled = seqTag
+		case "latency-series":
+			exp.LatencySeries.Packets = series
+		case "latency-windows":
+			exp.LatencySeries.Windows = nil
+			for _, width := range windows {
+				exp.LatencySeries.Windows = append(exp.LatencySeries.Windows,
+					config.Duration{Duration: width})
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// random traces are always generated from an explicit seed, so that
+	// they can be reproduced. if no seed is configured, derive one from the
+	// current time
+	if !exp.SeedSet {
+		exp.Seed = time.Now().UTC().UnixNano()
+		exp.SeedSet = true
+	}
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Random seed: %d", exp.Seed)
+
+	if err := exp.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %s", err.Error())
+	}
+
+	if opts.DryRun {
+		if err := PrintConfig(exp); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// programs measuring on multiple interfaces have a default list of interface
+// ids, all others use a single interface id
+func setInterfaces(id *int, ids *[]int, values []int) error {
+	if *ids != nil {
+		*ids = values
+		return nil
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("program expects a single interface id, got %d",
+			len(values))
+	}
+	*id = values[0]
+	return nil
+}
+
+// PrintConfig prints the experiment configuration in configuration file
+// format
+func PrintConfig(exp *config.Experiment) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(exp); err != nil {
+		return err
+	}
+	fmt.Printf("# resolved experiment configuration\n%s\n", buf.String())
+	return nil
+}
@@ -0,0 +1,406 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package compare compares fresh measurement output against the reference
+// output shipped in the output_ref directories. Latency histograms are
+// compared by their Kolmogorov-Smirnov and earth mover's distance,
+// throughput results with a relative tolerance and deterministic
+// calculations must match exactly.
+
+package compare
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Status is the outcome of a comparison
+type Status int
+
+// comparison outcomes
+const (
+	StatusPass Status = iota
+	StatusFail
+	StatusSkip
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusFail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// Tolerances configures when a comparison fails
+type Tolerances struct {
+	// maximum Kolmogorov-Smirnov distance between two latency histograms
+	KSMax float64
+
+	// maximum earth mover's distance in ns between two latency histograms
+	EMDMax float64
+
+	// maximum relative deviation of throughput values
+	RelTol float64
+}
+
+// TolerancesDefault returns the default tolerances. Histograms may differ by
+// at most half a clock cycle (3.2 ns) on average, so that a histogram shifted
+// by one bin (6.4 ns) fails. The Kolmogorov-Smirnov distance catches shifts
+// of narrow histograms, which only occupy a few bins.
+func TolerancesDefault() Tolerances {
+	return Tolerances{
+		KSMax:  0.1,
+		EMDMax: 3.2,
+		RelTol: 0.02,
+	}
+}
+
+// OutDirDefault is the name of the output directory of the programs
+const OutDirDefault = "output"
+
+// Result is the outcome of comparing one output file
+type Result struct {
+	Experiment string
+	File       string
+	Status     Status
+	Detail     string
+}
+
+// Experiment describes how the output of a program is compared
+type Experiment struct {
+	// directory of the program
+	Dir string
+
+	// compares all output files in newDir against the reference files in
+	// refDir
+	Compare func(refDir, newDir string, tol Tolerances) []Result
+}
+
+// Experiments lists all programs that ship reference output
+var Experiments = []Experiment{
+	{"plot_accuracy_cbr", compareHistograms},
+	{"plot_accuracy_random", compareHistograms},
+	{"plot_throughput_generate_capture", compareMaxThroughput},
+	{"plot_required_mem_bandwidth_generate_capture",
+		compareRequiredMemBandwidth},
+	{"benchmark_pcie_dram", comparePCIeThroughput},
+}
+
+// Run compares the output of all experiments located in the directory root.
+// outDir is the name of the output directories of the programs (see
+// OutDirDefault).
+func Run(root, outDir string, tol Tolerances) []Result {
+	var results []Result
+	for _, exp := range Experiments {
+		refDir := filepath.Join(root, exp.Dir, "output_ref")
+		newDir := filepath.Join(root, exp.Dir, outDir)
+		for _, res := range exp.Compare(refDir, newDir, tol) {
+			res.Experiment = exp.Dir
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// KSDistance returns the Kolmogorov-Smirnov distance (maximum distance of the
+// cumulative distribution functions) of two histograms
+func KSDistance(a, b []datfile.HistogramBin) float64 {
+	dist := 0.0
+	walkCDFs(a, b, func(x, xNext, cdfA, cdfB float64) {
+		dist = math.Max(dist, math.Abs(cdfA-cdfB))
+	})
+	return dist
+}
+
+// EMDistance returns the earth mover's distance of two histograms in the
+// unit of the histogram bins. For one-dimensional distributions it equals
+// the area between the two cumulative distribution functions.
+func EMDistance(a, b []datfile.HistogramBin) float64 {
+	dist := 0.0
+	walkCDFs(a, b, func(x, xNext, cdfA, cdfB float64) {
+		dist += math.Abs(cdfA-cdfB) * (xNext - x)
+	})
+	return dist
+}
+
+// calls f for each bin value x in ascending order with the values of both
+// cumulative distribution functions at x and the next bin value xNext
+func walkCDFs(a, b []datfile.HistogramBin,
+	f func(x, xNext, cdfA, cdfB float64)) {
+	pdfA, totalA := histogramMap(a)
+	pdfB, totalB := histogramMap(b)
+	if totalA == 0 || totalB == 0 {
+		return
+	}
+
+	// collect all bin values
+	var xs []float64
+	for x := range pdfA {
+		xs = append(xs, x)
+	}
+	for x := range pdfB {
+		if _, ok := pdfA[x]; !ok {
+			xs = append(xs, x)
+		}
+	}
+	sort.Float64s(xs)
+
+	var accA, accB uint64
+	for i, x := range xs {
+		accA += pdfA[x]
+		accB += pdfB[x]
+
+		xNext := x
+		if i+1 < len(xs) {
+			xNext = xs[i+1]
+		}
+
+		f(x, xNext, float64(accA)/float64(totalA),
+			float64(accB)/float64(totalB))
+	}
+}
+
+func histogramMap(bins []datfile.HistogramBin) (map[float64]uint64, uint64) {
+	m := make(map[float64]uint64)
+	var total uint64
+	for _, bin := range bins {
+		m[bin.Latency] += bin.Occurrences
+		total += bin.Occurrences
+	}
+	return m, total
+}
+
+// compares all latency histogram files of the reference directory. New
+// histogram files without reference fail.
+func compareHistograms(refDir, newDir string, tol Tolerances) []Result {
+	filenames, _ := filepath.Glob(filepath.Join(refDir, "histogram_*.dat"))
+	filenamesNew, _ := filepath.Glob(filepath.Join(newDir,
+		"histogram_*.dat"))
+
+	var results []Result
+
+	hasRef := make(map[string]bool)
+	for _, filenameRef := range filenames {
+		hasRef[filepath.Base(filenameRef)] = true
+	}
+	for _, filenameNew := range filenamesNew {
+		if file := filepath.Base(filenameNew); !hasRef[file] {
+			results = append(results, Result{
+				File:   file,
+				Status: StatusFail,
+				Detail: "no reference file",
+			})
+		}
+	}
+
+	for _, filenameRef := range filenames {
+		file := filepath.Base(filenameRef)
+		res := Result{File: file}
+
+		ref, errRef := datfile.ReadHistogram(filenameRef)
+		cur, errNew := datfile.ReadHistogram(filepath.Join(newDir, file))
+
+		switch {
+		case errRef != nil:
+			res.Status = StatusFail
+			res.Detail = errRef.Error()
+		case errNew != nil:
+			res.Status = statusMissing(errNew)
+			res.Detail = errNew.Error()
+		default:
+			ks := KSDistance(ref, cur)
+			emd := EMDistance(ref, cur)
+			res.Detail = fmt.Sprintf("KS distance: %.4f (max %.4f), "+
+				"EMD: %.2f ns (max %.2f ns)", ks, tol.KSMax, emd, tol.EMDMax)
+			if ks > tol.KSMax || emd > tol.EMDMax {
+				res.Status = StatusFail
+			}
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// compares the maximum throughput and memory bandwidth per packet size
+func compareMaxThroughput(refDir, newDir string, tol Tolerances) []Result {
+	return compareRows(refDir, newDir, "max_throughput.dat", tol.RelTol)
+}
+
+// required memory bandwidth is calculated, not measured, so values must
+// match exactly
+func compareRequiredMemBandwidth(refDir, newDir string,
+	tol Tolerances) []Result {
+	return compareRows(refDir, newDir, "required_membandwidth.dat", 0.0)
+}
+
+// compares files containing one row per packet size (first column). all
+// other columns may deviate by relTol
+func compareRows(refDir, newDir, file string, relTol float64) []Result {
+	res := Result{File: file}
+
+	ref, err := datfile.ReadColumns(filepath.Join(refDir, file))
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return []Result{res}
+	}
+	cur, err := datfile.ReadColumns(filepath.Join(newDir, file))
+	if err != nil {
+		res.Status = statusMissing(err)
+		res.Detail = err.Error()
+		return []Result{res}
+	}
+
+	// index new rows by packet size
+	curRows := make(map[float64][]float64)
+	for _, row := range cur {
+		curRows[row[0]] = row
+	}
+
+	// rows missing in the new output and rows without reference are
+	// mismatches
+	nMismatches := 0
+	refRows := make(map[float64]bool)
+	for _, rowRef := range ref {
+		refRows[rowRef[0]] = true
+	}
+	for _, rowCur := range cur {
+		if !refRows[rowCur[0]] {
+			nMismatches++
+		}
+	}
+
+	maxDev := 0.0
+	for _, rowRef := range ref {
+		rowCur, ok := curRows[rowRef[0]]
+		if !ok || len(rowCur) != len(rowRef) {
+			nMismatches++
+			continue
+		}
+		for i := 1; i < len(rowRef); i++ {
+			dev := relDeviation(rowRef[i], rowCur[i])
+			maxDev = math.Max(maxDev, dev)
+			if dev > relTol {
+				nMismatches++
+				break
+			}
+		}
+	}
+
+	res.Detail = fmt.Sprintf("%d rows out of tolerance or missing (%d "+
+		"reference rows, %d new rows), max deviation: %.4f%% (max %.4f%%)",
+		nMismatches, len(ref), len(cur), 100.0*maxDev, 100.0*relTol)
+	if nMismatches > 0 {
+		res.Status = StatusFail
+	}
+
+	return []Result{res}
+}
+
+// compares the PCIe read/write throughput. benchmark_pcie_dram prints its
+// results, they are expected to be redirected to the output directory
+func comparePCIeThroughput(refDir, newDir string, tol Tolerances) []Result {
+	file := "rd_wr_performance.txt"
+	res := Result{File: file}
+
+	ref, err := datfile.ReadKeyValues(filepath.Join(refDir, file))
+	if err != nil {
+		res.Status = StatusFail
+		res.Detail = err.Error()
+		return []Result{res}
+	}
+	cur, err := datfile.ReadKeyValues(filepath.Join(newDir, file))
+	if err != nil {
+		res.Status = statusMissing(err)
+		res.Detail = err.Error()
+		return []Result{res}
+	}
+
+	var keys []string
+	for key := range ref {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var keysNew []string
+	for key := range cur {
+		if _, ok := ref[key]; !ok {
+			keysNew = append(keysNew, key)
+		}
+	}
+	sort.Strings(keysNew)
+	for _, key := range keysNew {
+		res.Status = StatusFail
+		res.Detail += fmt.Sprintf("%s: no reference; ", key)
+	}
+
+	for _, key := range keys {
+		value, ok := cur[key]
+		if !ok {
+			res.Status = StatusFail
+			res.Detail += fmt.Sprintf("%s: missing; ", key)
+			continue
+		}
+		dev := relDeviation(ref[key], value)
+		res.Detail += fmt.Sprintf("%s: %.2f (ref %.2f); ", key, value,
+			ref[key])
+		if dev > tol.RelTol {
+			res.Status = StatusFail
+		}
+	}
+
+	return []Result{res}
+}
+
+func relDeviation(ref, value float64) float64 {
+	if ref == value {
+		return 0.0
+	}
+	if ref == 0.0 {
+		return math.Inf(1)
+	}
+	return math.Abs(value-ref) / math.Abs(ref)
+}
+
+// output files that have not been generated yet are skipped. Whether
+// skipped files are acceptable is up to the caller.
+func statusMissing(err error) Status {
+	if os.IsNotExist(err) {
+		return StatusSkip
+	}
+	return StatusFail
+}
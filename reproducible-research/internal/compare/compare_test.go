@@ -0,0 +1,179 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the reference output comparison.
+
+package compare
+
+import (
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// returns a histogram with the given occurrences in consecutive clock cycle
+// bins starting at latency first (ns)
+func histogram(first float64, occurrences ...uint64) []datfile.HistogramBin {
+	bins := make([]datfile.HistogramBin, len(occurrences))
+	for i, n := range occurrences {
+		bins[i] = datfile.HistogramBin{
+			Latency:     first + 6.4*float64(i),
+			Occurrences: n,
+		}
+	}
+	return bins
+}
+
+func TestHistogramTolerances(t *testing.T) {
+	tol := TolerancesDefault()
+
+	wide := make([]uint64, 20)
+	for i := range wide {
+		wide[i] = 1000
+	}
+
+	tests := []struct {
+		name string
+		a, b []datfile.HistogramBin
+		pass bool
+	}{
+		{"identical", histogram(409.6, 10, 80, 10),
+			histogram(409.6, 10, 80, 10), true},
+		{"noise", histogram(409.6, 10, 80, 10),
+			histogram(409.6, 12, 77, 11), true},
+		{"narrow shifted by one bin", histogram(409.6, 10, 80, 10),
+			histogram(416.0, 10, 80, 10), false},
+		{"wide shifted by one bin", histogram(409.6, wide...),
+			histogram(416.0, wide...), false},
+		{"empty", nil, histogram(409.6, 1), true},
+	}
+
+	for _, test := range tests {
+		ks := KSDistance(test.a, test.b)
+		emd := EMDistance(test.a, test.b)
+		pass := ks <= tol.KSMax && emd <= tol.EMDMax
+		if pass != test.pass {
+			t.Errorf("%s: KS distance %.4f, EMD %.2f ns: pass %v, "+
+				"expected %v", test.name, ks, emd, pass, test.pass)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content),
+			0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	hist := "409.6 10\n416.0 80\n422.4 10\n"
+	rows := "64 9.5 1.2\n1518 9.9 1.1\n"
+
+	tests := []struct {
+		name     string
+		compare  func(refDir, newDir string, tol Tolerances) []Result
+		ref, cur map[string]string
+		statuses []Status
+	}{
+		{"histograms equal", compareHistograms,
+			map[string]string{"histogram_1.dat": hist},
+			map[string]string{"histogram_1.dat": hist},
+			[]Status{StatusPass}},
+		{"histogram missing", compareHistograms,
+			map[string]string{"histogram_1.dat": hist},
+			map[string]string{},
+			[]Status{StatusSkip}},
+		{"histogram without reference", compareHistograms,
+			map[string]string{"histogram_1.dat": hist},
+			map[string]string{"histogram_1.dat": hist,
+				"histogram_2.dat": hist},
+			[]Status{StatusFail, StatusPass}},
+		{"rows within tolerance", compareMaxThroughput,
+			map[string]string{"max_throughput.dat": rows},
+			map[string]string{"max_throughput.dat": "64 9.51 1.2\n" +
+				"1518 9.9 1.1\n"},
+			[]Status{StatusPass}},
+		{"row out of tolerance", compareMaxThroughput,
+			map[string]string{"max_throughput.dat": rows},
+			map[string]string{"max_throughput.dat": "64 9.0 1.2\n" +
+				"1518 9.9 1.1\n"},
+			[]Status{StatusFail}},
+		{"row missing", compareMaxThroughput,
+			map[string]string{"max_throughput.dat": rows},
+			map[string]string{"max_throughput.dat": "64 9.5 1.2\n"},
+			[]Status{StatusFail}},
+		{"row without reference", compareMaxThroughput,
+			map[string]string{"max_throughput.dat": rows},
+			map[string]string{"max_throughput.dat": rows +
+				"512 9.7 1.1\n"},
+			[]Status{StatusFail}},
+		{"rows missing", compareMaxThroughput,
+			map[string]string{"max_throughput.dat": rows},
+			map[string]string{},
+			[]Status{StatusSkip}},
+		{"value without reference", comparePCIeThroughput,
+			map[string]string{"rd_wr_performance.txt": "rd: 10\n"},
+			map[string]string{"rd_wr_performance.txt": "rd: 10\nwr: 5\n"},
+			[]Status{StatusFail}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "compare")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			refDir := filepath.Join(root, "output_ref")
+			newDir := filepath.Join(root, "output")
+			writeFiles(t, refDir, test.ref)
+			writeFiles(t, newDir, test.cur)
+
+			results := test.compare(refDir, newDir, TolerancesDefault())
+			if len(results) != len(test.statuses) {
+				t.Fatalf("%d results, expected %d", len(results),
+					len(test.statuses))
+			}
+			for i, res := range results {
+				if res.Status != test.statuses[i] {
+					t.Errorf("%s: %s, expected %s (%s)", res.File,
+						res.Status, test.statuses[i], res.Detail)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package config loads experiment configuration files. A file describes the
+// parameter sweep of a measurement program (data rates, packet sizes,
+// interfaces, duration, timestamping and output directory) in TOML format.
+// Parameters not set in the file keep the defaults of the program.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"strings"
+	"time"
+)
+
+// maximum data rate of a single network interface
+const datarateMaxPerPort = 10e9
+
+// number of network interfaces of the network tester
+const numInterfaces = 4
+
+// Ethernet frame size limits (including FCS)
+const (
+	pktlenMin = 64
+	pktlenMax = 1518
+)
+
+// Duration is a time.Duration that is specified as a string (e.g. "10s") in
+// configuration files
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// MarshalText formats a duration as string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Timestamp holds the packet timestamp configuration
+type Timestamp struct {
+	// byte position of the timestamp in the packet
+	Pos int `toml:"pos" json:"pos"`
+
+	// width of the timestamp in bits
+	Width int `toml:"width" json:"width"`
+}
+
+// EndsBefore returns true if the timestamp is disabled or ends before byte
+// position pos
+func (ts Timestamp) EndsBefore(pos int) bool {
+	return ts.Width == 0 || ts.Pos+ts.Width/8 <= pos
+}
+
+// SeqTag holds the configuration of sequence tags embedded into generated
+// packets (see tracegen.SeqTag)
+type SeqTag struct {
+	// embed sequence tags and check captured packets for loss, reordering,
+	// duplication and corruption
+	Enabled bool `toml:"enabled,omitempty" json:"enabled"`
+
+	// byte offset of the tag in the packet. Tags directly follow the packet
+	// headers if zero (see Experiment.SeqTagOffset)
+	Offset int `toml:"offset,omitempty" json:"offset"`
+}
+
+// Histogram holds the configuration of latency histogram output files
+type Histogram struct {
+	// binning of latency histograms (see stats.ParseBinning). Each distinct
+	// latency gets its own bin if not set.
+	Binning string `toml:"binning,omitempty" json:"binning"`
+
+	// additionally write the cumulative distribution to cdf_*.dat files
+	CDF bool `toml:"cdf,omitempty" json:"cdf"`
+}
+
+// LatencySeries holds the configuration of latency time series output files
+type LatencySeries struct {
+	// write the arrival time and latency of each packet to series_*.dat
+	Packets bool `toml:"packets,omitempty" json:"packets"`
+
+	// widths of the time windows latency statistics are aggregated in, each
+	// written to windows_<width>_*.dat (e.g. windows_100us_*.dat)
+	Windows []Duration `toml:"windows,omitempty" json:"windows"`
+}
+
+// WindowWidths returns the widths of the latency windows
+func (s LatencySeries) WindowWidths() []time.Duration {
+	widths := make([]time.Duration, len(s.Windows))
+	for i, width := range s.Windows {
+		widths[i] = width.Duration
+	}
+	return widths
+}
+
+// Bisection holds the parameters of a data rate bisection search
+type Bisection struct {
+	// data rate the search starts with
+	Start float64 `toml:"datarate_start,omitempty" json:"datarate_start"`
+
+	// initial step size
+	StepInit float64 `toml:"datarate_step_init,omitempty" json:"datarate_step_init"`
+
+	// search stops when step size is smaller or equal than this value
+	StepLimit float64 `toml:"datarate_step_limit,omitempty" json:"datarate_step_limit"`
+}
+
+// PCIe holds the parameters of PCIe DMA benchmarks
+type PCIe struct {
+	// character devices for writing to and reading from the FPGA
+	DevWr string `toml:"dev_wr,omitempty" json:"dev_wr"`
+	DevRd string `toml:"dev_rd,omitempty" json:"dev_rd"`
+
+	// size of a single DMA transfer in bytes
+	TransferSize int `toml:"transfer_size,omitempty" json:"transfer_size"`
+}
+
+// Pcap holds the parameters of PCAP/PCAPNG trace replays
+type Pcap struct {
+	// PCAP or PCAPNG file that is replayed
+	File string `toml:"file,omitempty" json:"file"`
+
+	// number of bytes of each packet transferred to the hardware (0: all
+	// captured bytes)
+	CaptureLen int `toml:"capture_len,omitempty" json:"capture_len"`
+
+	// replay speed relative to the original capture
+	Speedup float64 `toml:"speedup,omitempty" json:"speedup"`
+
+	// replay packets back-to-back at line rate
+	LineRate bool `toml:"line_rate,omitempty" json:"line_rate"`
+}
+
+// Experiment is the configuration of a measurement program. Each program
+// only evaluates the parameters it needs.
+type Experiment struct {
+	// (mean) data rates per network interface in bps
+	Datarates []float64 `toml:"datarates,omitempty" json:"datarates"`
+
+	// packet sizes in bytes (including FCS)
+	Pktlens []int `toml:"pktlens,omitempty" json:"pktlens"`
+
+	// generator and receiver interface ids for measurements using a single
+	// generator and receiver
+	IfGen  int `toml:"if_gen" json:"if_gen"`
+	IfRecv int `toml:"if_recv" json:"if_recv"`
+
+	// generator and receiver interface ids for measurements using multiple
+	// generators and receivers
+	IfsGen  []int `toml:"ifs_gen,omitempty" json:"ifs_gen"`
+	IfsRecv []int `toml:"ifs_recv,omitempty" json:"ifs_recv"`
+
+	// duration of each measurement
+	Duration Duration `toml:"duration" json:"duration"`
+
+	// interval between two PTP packet bursts (precision measurement)
+	PTPInterval Duration `toml:"ptp_interval,omitempty" json:"ptp_interval"`
+
+	// timestamp configuration
+	Timestamp Timestamp `toml:"timestamp,omitempty" json:"timestamp"`
+
+	// latency histogram output configuration
+	Histogram Histogram `toml:"histogram,omitempty" json:"histogram"`
+
+	// latency time series output configuration
+	LatencySeries LatencySeries `toml:"latency_series" json:"latency_series"`
+
+	// data rate bisection (throughput measurement)
+	Bisection Bisection `toml:"bisection,omitempty" json:"bisection"`
+
+	// PCIe DMA benchmark configuration
+	PCIe PCIe `toml:"pcie,omitempty" json:"pcie"`
+
+	// PCAP/PCAPNG replay configuration
+	Pcap Pcap `toml:"pcap,omitempty" json:"pcap"`
+
+	// packet size distribution of random traces: IMIX profile, weighted
+	// packet size table or histogram file (see tracegen.ParsePktlenDist).
+	// Packet sizes are uniformly distributed if not set.
+	PktlenDist string `toml:"pktlen_dist,omitempty" json:"pktlen_dist"`
+
+	// inter-packet gap model of random traces (see tracegen.ParseGapModel).
+	// Gaps are exponentially distributed if not set.
+	GapModel string `toml:"gap_model,omitempty" json:"gap_model"`
+
+	// sequence tags of random traces
+	SeqTag SeqTag `toml:"seq_tag,omitempty" json:"seq_tag"`
+
+	// packet header template of random traces. Packets consist of an
+	// ethernet and an ipv4 header if not set.
+	Headers *tracegen.HeaderTemplate `toml:"headers,omitempty" json:"headers"`
+
+	// directory output files are written to
+	OutDir string `toml:"out_dir,omitempty" json:"out_dir"`
+
+	// seed for random trace generation
+	Seed int64 `toml:"seed" json:"seed"`
+
+	// whether Seed has been configured. Zero is a valid seed, so it cannot
+	// mark an unset seed.
+	SeedSet bool `toml:"-" json:"-"`
+}
+
+// Load reads the configuration file filename into exp. Parameters that are
+// not set in the file are left untouched.
+func Load(filename string, exp *Experiment) error {
+	md, err := toml.DecodeFile(filename, exp)
+	if err != nil {
+		return fmt.Errorf("could not load config file '%s': %s", filename,
+			err.Error())
+	}
+
+	if md.IsDefined("seed") {
+		exp.SeedSet = true
+	}
+
+	// reject unknown keys, they are most likely typos
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return fmt.Errorf("unknown parameters in config file '%s': %s",
+			filename, strings.Join(keys, ", "))
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for impossible parameter combinations
+func (exp *Experiment) Validate() error {
+	for _, datarate := range exp.Datarates {
+		if datarate <= 0.0 {
+			return fmt.Errorf("invalid data rate %.2f bps", datarate)
+		}
+		if datarate > datarateMaxPerPort {
+			return fmt.Errorf("data rate %.2f bps exceeds the maximum data "+
+				"rate of %.2f bps per network interface", datarate,
+				datarateMaxPerPort)
+		}
+	}
+
+	for _, pktlen := range exp.Pktlens {
+		if pktlen < pktlenMin || pktlen > pktlenMax {
+			return fmt.Errorf("invalid packet size %d (must be between %d "+
+				"and %d bytes)", pktlen, pktlenMin, pktlenMax)
+		}
+
+		// hardware does not support inter-packet times larger than 2**32-1
+		// clock cycles. add 20 bytes for preamble, SOD and inter-frame gap
+		for _, datarate := range exp.Datarates {
+			cycles := float64(8*(pktlen+20)) / datarate *
+				gofluent10g.FREQ_SFP
+			if cycles > 4294967295 {
+				return fmt.Errorf("data rate %.2f bps too low for packet "+
+					"size %d", datarate, pktlen)
+			}
+		}
+	}
+
+	if err := validateInterface(exp.IfGen); err != nil {
+		return err
+	}
+	if err := validateInterface(exp.IfRecv); err != nil {
+		return err
+	}
+
+	if len(exp.IfsGen) != len(exp.IfsRecv) {
+		return errors.New("number of generator and receiver interfaces " +
+			"does not match")
+	}
+	for i, ifGen := range exp.IfsGen {
+		if err := validateInterface(ifGen); err != nil {
+			return err
+		}
+		if err := validateInterface(exp.IfsRecv[i]); err != nil {
+			return err
+		}
+		for j := 0; j < i; j++ {
+			if exp.IfsGen[j] == ifGen {
+				return fmt.Errorf("generator interface %d used twice", ifGen)
+			}
+			if exp.IfsRecv[j] == exp.IfsRecv[i] {
+				return fmt.Errorf("receiver interface %d used twice",
+					exp.IfsRecv[i])
+			}
+		}
+	}
+
+	if exp.Duration.Duration <= 0 {
+		return fmt.Errorf("invalid duration %s", exp.Duration)
+	}
+
+	if exp.Timestamp.Width != 0 {
+		if exp.Timestamp.Width%8 != 0 || exp.Timestamp.Width > 32 {
+			return fmt.Errorf("invalid timestamp width %d bits",
+				exp.Timestamp.Width)
+		}
+
+		// timestamp must fit into the smallest packet (without FCS)
+		for _, pktlen := range exp.Pktlens {
+			if exp.Timestamp.Pos < 0 ||
+				exp.Timestamp.Pos+exp.Timestamp.Width/8 > pktlen-4 {
+				return fmt.Errorf("timestamp at byte position %d does not "+
+					"fit into packets of size %d", exp.Timestamp.Pos, pktlen)
+			}
+		}
+	}
+
+	if _, err := stats.ParseBinning(exp.Histogram.Binning); err != nil {
+		return fmt.Errorf("invalid histogram binning: %s", err.Error())
+	}
+
+	for _, width := range exp.LatencySeries.Windows {
+		if width.Duration <= 0 {
+			return fmt.Errorf("invalid latency window width %s", width)
+		}
+	}
+
+	b := exp.Bisection
+	if b.Start != 0.0 || b.StepInit != 0.0 || b.StepLimit != 0.0 {
+		if b.Start <= 0.0 || b.Start > datarateMaxPerPort {
+			return fmt.Errorf("invalid bisection start data rate %.2f bps",
+				b.Start)
+		}
+		if b.StepLimit <= 0.0 || b.StepInit < b.StepLimit {
+			return errors.New("bisection step limit must be positive and " +
+				"must not exceed the initial step size")
+		}
+	}
+
+	if exp.Pcap.CaptureLen < 0 {
+		return fmt.Errorf("invalid pcap capture length %d",
+			exp.Pcap.CaptureLen)
+	}
+	if exp.Pcap.Speedup < 0.0 {
+		return fmt.Errorf("invalid pcap replay speedup %f", exp.Pcap.Speedup)
+	}
+
+	var traffic tracegen.Traffic
+	if exp.PktlenDist != "" {
+		dist, err := tracegen.ParsePktlenDist(exp.PktlenDist)
+		if err != nil {
+			return fmt.Errorf("invalid packet size distribution: %s",
+				err.Error())
+		}
+		traffic.Pktlens = dist
+	}
+	if exp.GapModel != "" {
+		gaps, err := tracegen.ParseGapModel(exp.GapModel)
+		if err != nil {
+			return fmt.Errorf("invalid gap model: %s", err.Error())
+		}
+		traffic.Gaps = gaps
+	}
+	if exp.Headers != nil {
+		if _, err := exp.Headers.Compile(); err != nil {
+			return fmt.Errorf("invalid header template: %s", err.Error())
+		}
+		traffic.Headers = exp.Headers
+	}
+	if exp.GapModel != "" || exp.Headers != nil {
+		// bursts must not exceed line rate at any of the data rates and
+		// headers must fit into the smallest packet
+		for _, datarate := range exp.Datarates {
+			traffic.Datarate = datarate
+			if err := traffic.Check(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if exp.SeqTag.Offset < 0 {
+		return fmt.Errorf("invalid sequence tag offset %d", exp.SeqTag.Offset)
+	}
+	if exp.SeqTag.Enabled {
+		if err := exp.validateSeqTag(); err != nil {
+			return err
+		}
+	}
+
+	if exp.OutDir == "" {
+		return errors.New("no output directory specified")
+	}
+
+	return nil
+}
+
+// Datarate returns the data rate of experiments that are performed at a
+// single data rate. An error is returned if not exactly one data rate is
+// configured.
+func (exp *Experiment) Datarate() (float64, error) {
+	if len(exp.Datarates) != 1 {
+		return 0, errors.New("invalid configuration: experiment requires " +
+			"exactly one data rate")
+	}
+	return exp.Datarates[0], nil
+}
+
+// SeqTagOffset returns the byte offset of the sequence tags: the configured
+// offset or, if it is zero, the offset directly following the packet headers
+// (see tracegen.HeadersLenDefault).
+func (exp *Experiment) SeqTagOffset() (int, error) {
+	if exp.SeqTag.Offset != 0 {
+		return exp.SeqTag.Offset, nil
+	}
+	return exp.headersLen()
+}
+
+// returns the length of the packet headers of generated packets
+func (exp *Experiment) headersLen() (int, error) {
+	if exp.Headers == nil {
+		return tracegen.HeadersLenDefault, nil
+	}
+	headers, err := exp.Headers.Compile()
+	if err != nil {
+		return 0, fmt.Errorf("invalid header template: %s", err.Error())
+	}
+	return headers.Len(), nil
+}
+
+// checks that the sequence tag neither overlaps the packet headers nor
+// precedes the timestamp and fits into the smallest packet (without FCS)
+func (exp *Experiment) validateSeqTag() error {
+	hdrLen, err := exp.headersLen()
+	if err != nil {
+		return err
+	}
+	offset, err := exp.SeqTagOffset()
+	if err != nil {
+		return err
+	}
+
+	tag := tracegen.SeqTag{Offset: offset}
+	if err := tag.CheckOffset(hdrLen); err != nil {
+		return err
+	}
+	// the hardware inserts the timestamp after the tag CRC has been computed,
+	// so it must neither overlap the tag nor the protected bytes following it
+	if !exp.Timestamp.EndsBefore(offset) {
+		return fmt.Errorf("timestamp at byte position %d overlaps the "+
+			"sequence tag at byte offset %d or the bytes it protects",
+			exp.Timestamp.Pos, offset)
+	}
+	for _, pktlen := range exp.Pktlens {
+		if offset+tracegen.SeqTagLen > pktlen-4 {
+			return fmt.Errorf("sequence tag at byte offset %d does not fit "+
+				"into packets of size %d", offset, pktlen)
+		}
+	}
+	return nil
+}
+
+func validateInterface(id int) error {
+	if id < 0 || id >= numInterfaces {
+		return fmt.Errorf("invalid interface id %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+//
+// Description:
+//
+// Tests of the sequence tag configuration.
+
+package config
+
+import (
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"testing"
+	"time"
+)
+
+func TestSeqTag(t *testing.T) {
+	// ipv6 + tcp headers (74 bytes)
+	headers := &tracegen.HeaderTemplate{
+		SrcMAC: "53:00:00:00:00:01",
+		DstMAC: "53:00:00:00:00:02",
+		SrcIP:  "fd00::1",
+		DstIP:  "fd00::2",
+		Proto:  "tcp",
+	}
+
+	tests := []struct {
+		name      string
+		seqTag    SeqTag
+		headers   *tracegen.HeaderTemplate
+		timestamp Timestamp
+		pktlens   []int
+
+		// resolved offset, -1 if the configuration is invalid
+		offset int
+	}{
+		{"default offset", SeqTag{Enabled: true}, nil, Timestamp{}, nil,
+			tracegen.HeadersLenDefault},
+		{"default offset after template", SeqTag{Enabled: true}, headers,
+			Timestamp{}, nil, 74},
+		{"configured offset", SeqTag{Enabled: true, Offset: 40}, nil,
+			Timestamp{}, []int{64}, 40},
+		{"disabled", SeqTag{Offset: 35}, nil, Timestamp{}, nil, 35},
+		{"negative offset", SeqTag{Offset: -2}, nil, Timestamp{}, nil, -1},
+		{"odd offset", SeqTag{Enabled: true, Offset: 35}, nil, Timestamp{},
+			nil, -1},
+		{"overlaps headers", SeqTag{Enabled: true, Offset: 60}, headers,
+			Timestamp{}, nil, -1},
+		{"default offset overlaps timestamp", SeqTag{Enabled: true}, nil,
+			Timestamp{Pos: 50, Width: 32}, nil, -1},
+		{"timestamp in protected bytes", SeqTag{Enabled: true, Offset: 40},
+			nil, Timestamp{Pos: 64, Width: 32}, nil, -1},
+		{"timestamp before tag", SeqTag{Enabled: true, Offset: 60}, nil,
+			Timestamp{Pos: 50, Width: 32}, nil, 60},
+		{"smallest packet too short", SeqTag{Enabled: true}, headers,
+			Timestamp{}, []int{64, 1518}, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exp := Experiment{
+				Pktlens:   test.pktlens,
+				Duration:  Duration{Duration: time.Second},
+				Timestamp: test.timestamp,
+				SeqTag:    test.seqTag,
+				Headers:   test.headers,
+				OutDir:    "output",
+			}
+
+			err := exp.Validate()
+			if ok := err == nil; ok != (test.offset >= 0) {
+				t.Fatalf("error %v, expected success %v", err,
+					test.offset >= 0)
+			}
+			if test.offset < 0 {
+				return
+			}
+
+			offset, err := exp.SeqTagOffset()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != test.offset {
+				t.Errorf("offset %d, expected %d", offset, test.offset)
+			}
+		})
+	}
+}
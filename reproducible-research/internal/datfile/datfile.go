@@ -0,0 +1,141 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package datfile reads the whitespace-separated .dat output files of the
+// measurement programs.
+
+package datfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HistogramBin is a bin of a latency histogram file
+type HistogramBin struct {
+	// latency in nanoseconds
+	Latency float64
+
+	// number of packets with this latency
+	Occurrences uint64
+}
+
+// ReadColumns reads a file containing one record of whitespace-separated
+// numbers per line. Empty lines and lines starting with '#' are skipped.
+func ReadColumns(filename string) ([][]float64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows [][]float64
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		row := make([]float64, len(fields))
+		for i, field := range fields {
+			row[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", filename, lineNo,
+					err.Error())
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// ReadHistogram reads a latency histogram file ("<latency> <occurrences>"
+// per line)
+func ReadHistogram(filename string) ([]HistogramBin, error) {
+	rows, err := ReadColumns(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	bins := make([]HistogramBin, len(rows))
+	for i, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("%s: expected 2 columns, got %d",
+				filename, len(row))
+		}
+		bins[i] = HistogramBin{
+			Latency:     row[0],
+			Occurrences: uint64(row[1]),
+		}
+	}
+
+	return bins, nil
+}
+
+// ReadKeyValues reads a file containing "<key>: <number>" lines (e.g. the
+// output of benchmark_pcie_dram)
+func ReadKeyValues(filename string) (map[string]float64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]float64)
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNo,
+				err.Error())
+		}
+		values[strings.TrimSpace(fields[0])] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
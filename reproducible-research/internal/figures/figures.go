@@ -0,0 +1,159 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package figures renders the figures of the paper from the result files in
+// the output (or output_ref) directories of the measurement programs.
+
+package figures
+
+import (
+	"errors"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoData is returned if the data directory does not contain any result
+// files
+var ErrNoData = errors.New("no result files found")
+
+// Figure describes how the result files of a program are plotted
+type Figure struct {
+	// directory of the program
+	Dir string
+
+	// creates the plots from the result files in dataDir. plots are arranged
+	// in rows and columns
+	Plot func(dataDir string) ([][]*plot.Plot, error)
+}
+
+// Figures lists the figures of all programs that produce plottable output
+var Figures = []Figure{
+	{"plot_accuracy_cbr", plotLatencyHistograms(labelCBR)},
+	{"plot_accuracy_random", plotLatencyHistograms(labelRandom)},
+	{"plot_throughput_generate_capture", plotMaxThroughput},
+	{"plot_required_mem_bandwidth_generate_capture",
+		plotRequiredMemBandwidth},
+	{"plot_precision", plotPrecision},
+}
+
+// color of lines and bars
+var colorData = color.RGBA{R: 31, G: 119, B: 180, A: 255}
+
+// Save arranges the plots in rows and columns and writes them to filename.
+// The output format (svg, png, pdf, eps, ...) is derived from the file
+// extension. Each row of plots is rowHeight high.
+func Save(plots [][]*plot.Plot, width, rowHeight vg.Length,
+	filename string) error {
+	if len(plots) == 0 || len(plots[0]) == 0 {
+		return ErrNoData
+	}
+
+	format := strings.TrimPrefix(filepath.Ext(filename), ".")
+	c, err := draw.NewFormattedCanvas(width,
+		rowHeight*vg.Length(len(plots)), format)
+	if err != nil {
+		return err
+	}
+
+	tiles := draw.Tiles{
+		Rows:      len(plots),
+		Cols:      len(plots[0]),
+		PadX:      vg.Millimeter,
+		PadY:      vg.Millimeter,
+		PadTop:    2 * vg.Millimeter,
+		PadBottom: 2 * vg.Millimeter,
+		PadLeft:   2 * vg.Millimeter,
+		PadRight:  2 * vg.Millimeter,
+	}
+
+	canvases := plot.Align(plots, tiles, draw.New(c))
+	for i := range plots {
+		for j := range plots[i] {
+			if plots[i][j] != nil {
+				plots[i][j].Draw(canvases[i][j])
+			}
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// returns ticks at every multiple of step between min and max. If labels is
+// false, the ticks are not labeled (e.g. shared x axis of stacked plots)
+func ticks(min, max, step float64, format func(float64) string,
+	labels bool) plot.ConstantTicks {
+	var t plot.ConstantTicks
+	for i := 0; ; i++ {
+		value := min + float64(i)*step
+		if value > max+step/1e3 {
+			break
+		}
+		tick := plot.Tick{Value: value}
+		if labels {
+			tick.Label = format(value)
+		}
+		t = append(t, tick)
+	}
+	return t
+}
+
+// rounds x to the given number of decimal places
+func roundTo(x float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(x*scale) / scale
+}
+
+// reads a file containing a single number per line
+func readValues(filename string) ([]float64, error) {
+	rows, err := datfile.ReadColumns(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, len(rows))
+	for i, row := range rows {
+		values[i] = row[0]
+	}
+	return values, nil
+}
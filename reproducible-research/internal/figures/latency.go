@@ -0,0 +1,235 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Latency histograms of plot_accuracy_cbr and plot_accuracy_random.
+
+package figures
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"github.com/aoeldemann/gofluent10g"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/text"
+	"gonum.org/v1/plot/vg"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// clock period of the network tester's timestamp counter in ns. Latencies
+// are multiples of it
+var tClk = 1e9 / gofluent10g.FREQ_SFP
+
+// histogram file and the numeric parameters encoded in its filename
+type histogramFile struct {
+	filename string
+	params   []float64
+}
+
+// plot_accuracy_cbr: histogram_<datarate>_<pktlen>.dat
+func labelCBR(params []float64) string {
+	if len(params) != 2 {
+		return ""
+	}
+	return fmt.Sprintf("Data rate: %.2f Gbps, Packet size: %d",
+		params[0]/1e9, int(params[1]))
+}
+
+// plot_accuracy_random: histogram_<datarate mean>.dat
+func labelRandom(params []float64) string {
+	if len(params) != 1 {
+		return ""
+	}
+	return fmt.Sprintf("Mean datarate: %.2f Gbps", params[0]/1e9)
+}
+
+// returns a function plotting all histogram files of a data directory in
+// stacked plots sharing their x axis. label creates the legend entry from the
+// filename parameters
+func plotLatencyHistograms(label func(params []float64) string) func(
+	string) ([][]*plot.Plot, error) {
+	return func(dataDir string) ([][]*plot.Plot, error) {
+		files, err := findHistogramFiles(dataDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// read histograms and determine latency range of all of them
+		latencyMin, latencyMax := math.Inf(1), math.Inf(-1)
+		histograms := make([][]datfile.HistogramBin, len(files))
+		for i, file := range files {
+			histograms[i], err = datfile.ReadHistogram(file.filename)
+			if err != nil {
+				return nil, err
+			}
+			for _, bin := range histograms[i] {
+				latencyMin = math.Min(latencyMin, bin.Latency)
+				latencyMax = math.Max(latencyMax, bin.Latency)
+			}
+		}
+		if math.IsInf(latencyMin, 0) {
+			return nil, ErrNoData
+		}
+
+		var plots [][]*plot.Plot
+		for i, file := range files {
+			last := i == len(files)-1
+
+			p, err := plotLatencyHistogram(histograms[i], label(file.params))
+			if err != nil {
+				return nil, err
+			}
+
+			p.X.Min = latencyMin - 1.0
+			p.X.Max = latencyMax + 1.0
+			p.X.Tick.Marker = ticks(latencyMin, latencyMax, tClk,
+				func(v float64) string {
+					return strconv.FormatFloat(v, 'f', 1, 64)
+				}, last)
+			p.Y.Min = 0
+			p.Y.Max = 120
+			p.Y.Tick.Marker = ticks(0, 100, 20, func(v float64) string {
+				return strconv.Itoa(int(v))
+			}, true)
+			p.Y.Label.Text = "Probability [%]"
+			if last {
+				p.X.Label.Text = "Measured Latency [ns]"
+			}
+
+			plots = append(plots, []*plot.Plot{p})
+		}
+
+		return plots, nil
+	}
+}
+
+// plots a single histogram. bars show the probability of each latency value
+// in percent
+func plotLatencyHistogram(histogram []datfile.HistogramBin,
+	label string) (*plot.Plot, error) {
+	var total uint64
+	for _, bin := range histogram {
+		total += bin.Occurrences
+	}
+
+	var bins []plotter.HistogramBin
+	var points plotter.XYs
+	var labels []string
+	for _, bin := range histogram {
+		probability := 100.0 * float64(bin.Occurrences) / float64(total)
+		bins = append(bins, plotter.HistogramBin{
+			Min:    bin.Latency - tClk/3.0,
+			Max:    bin.Latency + tClk/3.0,
+			Weight: probability,
+		})
+		points = append(points, plotter.XY{X: bin.Latency, Y: probability})
+		labels = append(labels, fmt.Sprintf("%.6f %%", probability))
+	}
+
+	bars := &plotter.Histogram{
+		Bins:      bins,
+		Width:     2.0 * tClk / 3.0,
+		FillColor: colorData,
+		LineStyle: plotter.DefaultLineStyle,
+	}
+
+	// show probability values over bars
+	values, err := plotter.NewLabels(plotter.XYLabels{
+		XYs:    points,
+		Labels: labels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range values.TextStyle {
+		values.TextStyle[i].XAlign = text.XCenter
+	}
+	values.Offset.Y = 2 * vg.Millimeter
+
+	p := plot.New()
+	p.Add(plotter.NewGrid(), bars, values)
+	p.Legend.Add(label, bars)
+	p.Legend.Top = true
+	p.Legend.Left = true
+
+	return p, nil
+}
+
+// finds all histogram_*.dat files of a data directory and sorts them by the
+// parameters encoded in their filenames
+func findHistogramFiles(dataDir string) ([]histogramFile, error) {
+	filenames, err := filepath.Glob(filepath.Join(dataDir, "histogram_*.dat"))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []histogramFile
+	for _, filename := range filenames {
+		name := strings.TrimSuffix(strings.TrimPrefix(
+			filepath.Base(filename), "histogram_"), ".dat")
+
+		file := histogramFile{filename: filename}
+
+		valid := true
+		for _, field := range strings.Split(name, "_") {
+			param, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			file.params = append(file.params, param)
+		}
+
+		// skip this file if it did not match the pattern we are expecting
+		if !valid {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return nil, ErrNoData
+	}
+
+	// sort by first parameter, then by second parameter etc.
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i].params, files[j].params
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	return files, nil
+}
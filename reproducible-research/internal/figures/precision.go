@@ -0,0 +1,126 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Inter-packet time error distribution of plot_precision.
+
+package figures
+
+import (
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"math"
+	"path/filepath"
+	"strconv"
+)
+
+// clock period of the timestamping logic of the Intel X710 NIC in ns. The
+// accuracy of the measured inter-packet times is determined by it
+const tClkNIC = 3.2
+
+// timestamp_diffs_expected.dat contains the inter-packet times (in seconds)
+// of the PTP packets in the generated trace, timestamp_diffs_measured.dat the
+// inter-packet times (in ns) measured by the NIC
+func plotPrecision(dataDir string) ([][]*plot.Plot, error) {
+	tExpected, err := readValues(filepath.Join(dataDir,
+		"timestamp_diffs_expected.dat"))
+	if err != nil {
+		return nil, err
+	}
+	tMeasured, err := readValues(filepath.Join(dataDir,
+		"timestamp_diffs_measured.dat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure we have as many measured timestamps as we do expect
+	if len(tExpected) != len(tMeasured) {
+		return nil, fmt.Errorf("%d expected, but %d measured inter-packet "+
+			"times", len(tExpected), len(tMeasured))
+	}
+	if len(tExpected) == 0 {
+		return nil, ErrNoData
+	}
+
+	// calculate absolute error. measured values are rounded to the nearest
+	// clock period
+	tErrors := make([]float64, len(tExpected))
+	errorMin, errorMax := math.Inf(1), math.Inf(-1)
+	for i := range tExpected {
+		measured := roundTo(math.Round(tMeasured[i]/tClkNIC)*tClkNIC, 1)
+		tErrors[i] = measured - 1e9*tExpected[i]
+		errorMin = math.Min(errorMin, tErrors[i])
+		errorMax = math.Max(errorMax, tErrors[i])
+	}
+
+	// bin the errors with the NIC's clock period
+	start := tClkNIC * math.Floor(errorMin/tClkNIC)
+	end := tClkNIC * math.Ceil(errorMax/tClkNIC)
+	nBins := int(math.Round((end - start) / tClkNIC))
+	if nBins == 0 {
+		nBins = 1
+	}
+
+	occurrences := make([]int, nBins)
+	for _, tError := range tErrors {
+		bin := int(math.Floor((tError - start) / tClkNIC))
+		if bin >= nBins {
+			bin = nBins - 1
+		}
+		occurrences[bin]++
+	}
+
+	// translate occurrences to probabilities
+	bins := make([]plotter.HistogramBin, nBins)
+	for i := range bins {
+		bin := roundTo(start+float64(i)*tClkNIC, 1)
+		bins[i] = plotter.HistogramBin{
+			Min:    bin - tClkNIC/2.0,
+			Max:    bin + tClkNIC/2.0,
+			Weight: 100.0 * float64(occurrences[i]) / float64(len(tErrors)),
+		}
+	}
+
+	bars := &plotter.Histogram{
+		Bins:      bins,
+		Width:     tClkNIC,
+		FillColor: colorData,
+		LineStyle: plotter.DefaultLineStyle,
+	}
+
+	p := plot.New()
+	p.Add(plotter.NewGrid(), bars)
+	p.X.Label.Text = "Absolute Measured Inter-Packet Time Error [ns]"
+	p.X.Tick.Marker = ticks(start, start+float64(nBins-1)*tClkNIC, tClkNIC,
+		func(v float64) string {
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}, true)
+	p.Y.Label.Text = "Probability [%]"
+	p.Y.Min = 0
+
+	return [][]*plot.Plot{{p}}, nil
+}
@@ -0,0 +1,142 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Throughput and memory bandwidth plots of plot_throughput_generate_capture
+// and plot_required_mem_bandwidth_generate_capture.
+
+package figures
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg/draw"
+	"math"
+	"path/filepath"
+	"sort"
+)
+
+// max_throughput.dat: "<pktlen> <network throughput> <memory bandwidth>"
+func plotMaxThroughput(dataDir string) ([][]*plot.Plot, error) {
+	rows, err := readRowsByPktlen(filepath.Join(dataDir,
+		"max_throughput.dat"), 3)
+	if err != nil {
+		return nil, err
+	}
+
+	pThroughput, err := plotOverPktlen(rows, 1,
+		"Network Throughput (duplex) [Gbps]")
+	if err != nil {
+		return nil, err
+	}
+
+	pMemBandwidth, err := plotOverPktlen(rows, 2,
+		"Aggregate Memory Bandwidth [Gbps]")
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]*plot.Plot{{pThroughput}, {pMemBandwidth}}, nil
+}
+
+// required_membandwidth.dat: "<pktlen> <memory bandwidth>"
+func plotRequiredMemBandwidth(dataDir string) ([][]*plot.Plot, error) {
+	rows, err := readRowsByPktlen(filepath.Join(dataDir,
+		"required_membandwidth.dat"), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := plotOverPktlen(rows, 1, "Required Memory Bandwidth [Gbps]")
+	if err != nil {
+		return nil, err
+	}
+
+	// y axis limited to the data range
+	p.Y.Min, p.Y.Max = math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		p.Y.Min = math.Min(p.Y.Min, row[1]/1e9)
+		p.Y.Max = math.Max(p.Y.Max, row[1]/1e9)
+	}
+	p.Add(plotter.NewGrid())
+
+	return [][]*plot.Plot{{p}}, nil
+}
+
+// plots column col (in bps, converted to Gbps) over the packet size (first
+// column) as a line with markers
+func plotOverPktlen(rows [][]float64, col int,
+	yLabel string) (*plot.Plot, error) {
+	xys := make(plotter.XYs, len(rows))
+	for i, row := range rows {
+		xys[i].X = row[0]
+		xys[i].Y = row[col] / 1e9
+	}
+
+	line, points, err := plotter.NewLinePoints(xys)
+	if err != nil {
+		return nil, err
+	}
+	line.Color = colorData
+	points.Shape = draw.CrossGlyph{}
+	points.Color = colorData
+
+	p := plot.New()
+	p.Add(line, points)
+	p.X.Min = rows[0][0]
+	p.X.Max = rows[len(rows)-1][0]
+	p.X.Label.Text = "Packet Size [byte]"
+	p.Y.Label.Text = yLabel
+
+	return p, nil
+}
+
+// reads a file containing one row per packet size (first column) and sorts
+// the rows by ascending packet size
+func readRowsByPktlen(filename string, nCols int) ([][]float64, error) {
+	rows, err := datfile.ReadColumns(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoData
+	}
+
+	for _, row := range rows {
+		if len(row) != nCols {
+			return nil, fmt.Errorf("%s: expected %d columns, got %d",
+				filename, nCols, len(row))
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+
+	return rows, nil
+}
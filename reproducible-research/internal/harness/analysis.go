@@ -0,0 +1,252 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Analysis helpers shared by the latency measurement programs.
+
+package harness
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/integrity"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/pcapng"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteLatencyHistogram logs latency statistics of the captured packets and
+// writes their latency histogram (binned as configured with
+// Harness.SetHistogram) to the file filename. If enabled, the cumulative
+// distribution is written next to the histogram (histogram_* is replaced by
+// cdf_* in filename) and the latency time series (see
+// Harness.SetLatencySeries) to series_* and windows_<width>_* (width in
+// whole microseconds or nanoseconds, e.g. windows_100us_*). The latency
+// statistics and the filenames are added to the result record of the
+// measurement point. res.Packets must be in arrival order.
+func WriteLatencyHistogram(res *Result, filename string) {
+	pkts := res.Packets
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Calculating latency statistics ...")
+
+	// calculate latency min, max, mean, std dev and percentiles
+	latency := results.CalcLatencyStats(pkts)
+	if latency == nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "no packets captured")
+		return
+	}
+	res.Record.Latency = latency
+
+	// calculate latency histogram (in nanoseconds)
+	hist := stats.HistogramCreate(res.histBinning)
+	for _, pkt := range pkts {
+		hist.Add(pkt.Latency * 1e9)
+	}
+	res.Record.Params["histogram_binning"] = hist.Binning().String()
+
+	// output some infos
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Min latency: %.2f ns", latency.Min)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Max latency: %.2f ns", latency.Max)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Mean latency: %.2f ns",
+		latency.Mean)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Stddev latency: %.2f ns",
+		latency.StdDev)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Mean latency 95%% CI: "+
+		"[%.2f, %.2f] ns", latency.MeanCILow, latency.MeanCIHigh)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Latency percentiles: p50 %.2f "+
+		"ns, p90 %.2f ns, p99 %.2f ns, p99.9 %.2f ns, p99.99 %.2f ns",
+		latency.P50, latency.P90, latency.P99, latency.P999, latency.P9999)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Median absolute deviation: "+
+		"%.2f ns", latency.MAD)
+
+	gofluent10g.Log(gofluent10g.LOG_INFO,
+		"Writing latency histogram to output file '%s' ...", filename)
+
+	if err := hist.WriteFile(filename); err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not write file '%s': %s",
+			filename, err.Error())
+		return
+	}
+	res.Record.Files = append(res.Record.Files, filename)
+
+	// further output files are named like the histogram file with a
+	// different prefix
+	dir, base := filepath.Split(filename)
+	suffix := strings.TrimPrefix(base, "histogram")
+
+	if res.histCDF {
+		filenameCDF := filepath.Join(dir, "cdf"+suffix)
+
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Writing cumulative latency "+
+			"distribution to output file '%s' ...", filenameCDF)
+
+		if err := hist.WriteCDFFile(filenameCDF); err != nil {
+			gofluent10g.Log(gofluent10g.LOG_ERR, "could not write file "+
+				"'%s': %s", filenameCDF, err.Error())
+			return
+		}
+		res.Record.Files = append(res.Record.Files, filenameCDF)
+	}
+
+	writeLatencySeries(res, dir, suffix)
+}
+
+// writes the latency time series enabled with Harness.SetLatencySeries to
+// the directory dir. Filenames end with suffix.
+func writeLatencySeries(res *Result, dir, suffix string) {
+	if res.seriesPackets {
+		filename := filepath.Join(dir, "series"+suffix)
+
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Writing latency series to "+
+			"output file '%s' ...", filename)
+
+		if err := stats.WriteLatencySeries(res.Packets, filename); err != nil {
+			gofluent10g.Log(gofluent10g.LOG_ERR, "could not write file "+
+				"'%s': %s", filename, err.Error())
+			return
+		}
+		res.Record.Files = append(res.Record.Files, filename)
+	}
+
+	for _, width := range res.seriesWindows {
+		label := windowLabel(width)
+		filename := filepath.Join(dir,
+			fmt.Sprintf("windows_%s%s", label, suffix))
+
+		windows := stats.AggregateLatency(res.Packets, width)
+
+		// largest deviation of a window from the overall mean latency
+		// indicates drift and warm-up effects
+		driftMax := 0.0
+		for _, w := range windows {
+			driftMax = math.Max(driftMax,
+				math.Abs(w.Mean-float64(res.Record.Latency.Mean)))
+		}
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Max deviation of %s window "+
+			"mean latency from mean latency: %.2f ns", width, driftMax)
+		res.Record.Values[fmt.Sprintf("window_%s_mean_dev_max_ns", label)] =
+			driftMax
+
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Writing %s latency windows "+
+			"to output file '%s' ...", width, filename)
+
+		if err := stats.WriteWindows(windows, filename); err != nil {
+			gofluent10g.Log(gofluent10g.LOG_ERR, "could not write file "+
+				"'%s': %s", filename, err.Error())
+			return
+		}
+		res.Record.Files = append(res.Record.Files, filename)
+	}
+}
+
+// returns the window width in whole microseconds (e.g. 100us) or, if it is
+// not a multiple of a microsecond, in nanoseconds (e.g. 2500ns). Unlike
+// time.Duration.String, the label only contains ASCII characters and can be
+// used in filenames.
+func windowLabel(width time.Duration) string {
+	if width%time.Microsecond == 0 {
+		return fmt.Sprintf("%dus", width.Microseconds())
+	}
+	return fmt.Sprintf("%dns", width.Nanoseconds())
+}
+
+// CheckIntegrity checks the sequence tags of the captured packets (see
+// Point.SeqTag) for lost, reordered, duplicated and corrupted packets, logs
+// the results and adds them to the result record of the measurement point.
+// Each flow is expected to hold the number of packets given by
+// Result.ExpectedFlows.
+func CheckIntegrity(res *Result) {
+	tag := res.Point.SeqTag
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Checking sequence tags ...")
+
+	report := integrity.Check(res.Packets, tag.Offset, res.ExpectedFlows)
+	res.Record.Integrity = report
+
+	res.Record.Values["packets_lost"] = float64(report.Lost())
+	res.Record.Values["packets_duplicated"] = float64(report.Duplicates())
+	res.Record.Values["packets_reordered"] = float64(report.Reordered())
+	res.Record.Values["packets_corrupted"] = float64(report.Corrupted)
+	res.Record.Values["packets_untagged"] = float64(report.Untagged)
+
+	for _, f := range report.Flows {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Flow %d: %d/%d packets "+
+			"received, %d lost, %d duplicated, %d reordered (max extent "+
+			"%d)", f.FlowID, f.Received, f.Expected, f.Lost, f.Duplicates,
+			f.Reordered, f.ExtentMax)
+		for i, r := range f.LostRanges {
+			if i == 10 {
+				gofluent10g.Log(gofluent10g.LOG_INFO, "  ... (see result "+
+					"record)")
+				break
+			}
+			gofluent10g.Log(gofluent10g.LOG_INFO, "  lost: %d packets "+
+				"starting at sequence number %d", r.Count, r.First)
+		}
+	}
+	if report.Corrupted > 0 || report.Untagged > 0 ||
+		report.UnknownFlow > 0 {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "%d corrupted, %d untagged "+
+			"packets, %d packets of unknown flows", report.Corrupted,
+			report.Untagged, report.UnknownFlow)
+	}
+}
+
+// WriteCapturePcapng writes the captured packets in their arrival order to
+// the PCAPNG file filename. The filename is added to the result record of the
+// measurement point.
+func WriteCapturePcapng(res *Result, filename string) {
+	gofluent10g.Log(gofluent10g.LOG_INFO,
+		"Writing captured packets to output file '%s' ...", filename)
+
+	w, err := pcapng.Create(filename, "fluent10g-paper-fpl2018")
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create file '%s'",
+			filename)
+		return
+	}
+
+	ifID, err := w.AddInterface(fmt.Sprintf("if%d", res.Point.IfRecv),
+		fmt.Sprintf("network tester interface %d", res.Point.IfRecv),
+		res.Point.CaptureMaxLen)
+	if err == nil {
+		err = w.WriteCapture(ifID, res.Packets, res.CaptureStart)
+	}
+	if errClose := w.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not write file '%s': %s",
+			filename, err.Error())
+		return
+	}
+
+	res.Record.Files = append(res.Record.Files, filename)
+}
@@ -0,0 +1,56 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+//
+// Description:
+//
+// Tests of the measurement analysis helpers.
+
+package harness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowLabel(t *testing.T) {
+	tests := []struct {
+		width time.Duration
+		label string
+	}{
+		{100 * time.Microsecond, "100us"},
+		{time.Millisecond, "1000us"},
+		{2 * time.Second, "2000000us"},
+		{2500 * time.Nanosecond, "2500ns"},
+		{500 * time.Nanosecond, "500ns"},
+	}
+
+	for _, test := range tests {
+		if label := windowLabel(test.width); label != test.label {
+			t.Errorf("%s: label %s, expected %s", test.width, label,
+				test.label)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package harness runs measurement points: a trace is replayed on one
+// interface while the packets arriving at another interface are captured.
+// After each point the captured packets are handed to an analysis hook and
+// host memory is freed again.
+
+package harness
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/integrity"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"path/filepath"
+	"time"
+)
+
+// DrainTimeDefault is the time we wait after the replay finished to make
+// sure all packets have been captured
+const DrainTimeDefault = time.Second
+
+// Point describes a single measurement point
+type Point struct {
+	// description of the point that is logged before the measurement starts
+	Name string
+
+	// parameters of the point that are stored in the result record
+	Params map[string]interface{}
+
+	// generates the trace that is replayed
+	GenTrace func() *gofluent10g.Trace
+
+	// alternatively to GenTrace, generates the trace data that is replayed
+	// nReplays times. Unlike traces returned by GenTrace, the simulated
+	// network tester models the inter-packet times and the data of the
+	// individual packets of the trace data (see tester.SetTraceData).
+	GenTraceData func() (data *tracegen.Data, nReplays int)
+
+	// generator and receiver interface ids
+	IfGen  int
+	IfRecv int
+
+	// maximum number of bytes captured per packet. zero only captures meta
+	// data (e.g. for latency measurements)
+	CaptureMaxLen int
+
+	// time to wait after replay before capturing is stopped. if zero,
+	// DrainTimeDefault is used
+	DrainTime time.Duration
+
+	// sequence tags embedded into the packets of the trace (see
+	// tracegen.SeqTag). If set, the captured packets are checked for loss,
+	// reordering, duplication and corruption (see CheckIntegrity) and
+	// missing packets do not abort the measurement. CaptureMaxLen must cover
+	// the tag and the bytes it protects. Flows of traces generated by
+	// tracegen.GenFlows carry their own flow IDs, but must use the offset
+	// of SeqTag. Tagged traces cannot be replayed more than once, since
+	// each replay repeats the sequence numbers.
+	SeqTag *tracegen.SeqTag
+
+	// called with the measurement results. may be nil
+	Analyze func(res *Result)
+
+	// called after the measurement, once the network tester freed its host
+	// memory, to release resources backing the trace data (e.g. a memory
+	// mapping, see tracegen.LoadMmap). may be nil
+	Release func()
+}
+
+// Result holds the outcome of a measurement point
+type Result struct {
+	Point *Point
+
+	// the replayed trace
+	Trace *gofluent10g.Trace
+
+	// captured packets
+	Packets gofluent10g.CapturePackets
+
+	// time the capture was started
+	CaptureStart time.Time
+
+	// number of packets in the trace (including all replays), number of
+	// packets transmitted by the generator interface and number of packets
+	// captured by the receiver
+	NumPacketsTrace    int
+	NumPacketsTX       int
+	NumPacketsCaptured int
+
+	// number of packets of each flow ID carrying sequence tags in the trace
+	// (see Point.SeqTag)
+	ExpectedFlows map[uint32]uint64
+
+	// result record of the point. the analysis hook may add statistics
+	Record *results.Record
+
+	// latency histogram output (see SetHistogram)
+	histBinning stats.Binning
+	histCDF     bool
+
+	// latency time series output (see SetLatencySeries)
+	seriesPackets bool
+	seriesWindows []time.Duration
+}
+
+// Harness runs measurement points on a network tester
+type Harness struct {
+	nt      tester.NetworkTester
+	results *results.Writer
+
+	// directory captured packets are written to (see SetCaptureDir)
+	captureDir string
+
+	// binning of latency histograms and whether cumulative distributions
+	// are written (see SetHistogram)
+	histBinning stats.Binning
+	histCDF     bool
+
+	// whether per-packet latency series are written and widths of latency
+	// windows (see SetLatencySeries)
+	seriesPackets bool
+	seriesWindows []time.Duration
+
+	// number of measurement points run so far
+	nRuns int
+}
+
+// Create returns a harness running measurements on the network tester nt.
+// Timestamp configuration is left to the caller.
+func Create(nt tester.NetworkTester) *Harness {
+	return &Harness{nt: nt}
+}
+
+// SetResultWriter sets the writer result records of all subsequent
+// measurement points are written to
+func (h *Harness) SetResultWriter(w *results.Writer) {
+	h.results = w
+}
+
+// SetCaptureDir enables writing the captured packets of all subsequent
+// measurement points to PCAPNG files in the directory dir. Files are named
+// capture_<n>.pcapng, n counting the measurement points starting at one. The
+// filenames are added to the result records.
+func (h *Harness) SetCaptureDir(dir string) {
+	h.captureDir = dir
+}
+
+// SetHistogram sets the binning of the latency histograms written by
+// WriteLatencyHistogram for all subsequent measurement points. If cdf is set,
+// the cumulative distribution is written as well. By default, each distinct
+// latency gets its own bin.
+func (h *Harness) SetHistogram(binning stats.Binning, cdf bool) {
+	h.histBinning = binning
+	h.histCDF = cdf
+}
+
+// SetLatencySeries enables writing latency time series for all subsequent
+// measurement points: the arrival time and latency of each packet if packets
+// is set (see stats.WriteLatencySeries) and latency statistics aggregated in
+// time windows of each of the widths in windows (see stats.AggregateLatency
+// and stats.WriteWindows)
+func (h *Harness) SetLatencySeries(packets bool, windows []time.Duration) {
+	h.seriesPackets = packets
+	h.seriesWindows = windows
+}
+
+// CaptureMemSize returns the host memory size required to capture nPkts
+// packets with a maximum capture length of captureMaxLen bytes. each packet
+// occupies 8 bytes of meta data followed by the packet data padded to 8 byte
+// words
+func CaptureMemSize(nPkts int, captureMaxLen int) uint64 {
+	lenData := uint64(captureMaxLen)
+	if lenData%8 != 0 {
+		lenData = 8 * (lenData/8 + 1)
+	}
+	return uint64(nPkts) * (8 + lenData)
+}
+
+// RunAll runs all measurement points one after another
+func (h *Harness) RunAll(points []Point) {
+	for i := range points {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "%d/%d: %s", i+1, len(points),
+			points[i].Name)
+
+		gofluent10g.LogIncrementIndentLevel()
+		h.Run(&points[i])
+		gofluent10g.LogDecrementIndentLevel()
+	}
+}
+
+// Run runs a single measurement point
+func (h *Harness) Run(point *Point) {
+	nt := h.nt
+
+	// get generator and receiver
+	gen := nt.GetGenerator(point.IfGen)
+	recv := nt.GetReceiver(point.IfRecv)
+
+	// enable packet capture on receiver interface
+	recv.EnableCapture(true)
+	recv.SetCaptureMaxLen(point.CaptureMaxLen)
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
+
+	// generate trace and assign it to generator
+	var trace *gofluent10g.Trace
+	var nPktsTrace int
+	var expectedFlows map[uint32]uint64
+	if point.GenTraceData != nil {
+		data, nReplays := point.GenTraceData()
+		trace = data.TraceReplays(nReplays)
+		nPktsTrace = nReplays * data.NumPackets
+		tester.SetTraceData(gen, trace, data.Buf, nReplays)
+
+		// multi-flow traces know the number of packets of each flow
+		if data.Flows != nil {
+			expectedFlows = integrity.ExpectedFlows(data.Flows)
+		}
+		if point.SeqTag != nil && nReplays != 1 {
+			gofluent10g.Log(gofluent10g.LOG_ERR, "sequence numbers repeat "+
+				"in each of the %d replays of the tagged trace", nReplays)
+		}
+	} else {
+		trace = point.GenTrace()
+		nPktsTrace = trace.GetPacketCount()
+		gen.SetTrace(trace)
+	}
+	if point.SeqTag != nil && expectedFlows == nil {
+		expectedFlows = map[uint32]uint64{
+			point.SeqTag.FlowID: uint64(nPktsTrace),
+		}
+	}
+
+	// set receiver capture host memory size
+	recv.SetCaptureHostMemSize(CaptureMemSize(nPktsTrace,
+		point.CaptureMaxLen))
+
+	// write config to hardware
+	nt.WriteConfig()
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Starting replay and capture ...")
+
+	// start capturing
+	captureStart := time.Now()
+	nt.StartCapture()
+
+	// start replay (blocks until replay finished)
+	nt.StartReplay()
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Replay done")
+
+	// wait a little to make sure all packets have been captured
+	drainTime := point.DrainTime
+	if drainTime == 0 {
+		drainTime = DrainTimeDefault
+	}
+	time.Sleep(drainTime)
+
+	// stop capturing
+	nt.StopCapture()
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Capture done")
+
+	res := &Result{
+		Point:              point,
+		Trace:              trace,
+		Packets:            recv.GetCapture().GetPackets(),
+		CaptureStart:       captureStart,
+		NumPacketsTrace:    nPktsTrace,
+		NumPacketsTX:       nt.GetInterface(point.IfGen).GetPacketCountTX(),
+		NumPacketsCaptured: recv.GetPacketCountCaptured(),
+		ExpectedFlows:      expectedFlows,
+		histBinning:        h.histBinning,
+		histCDF:            h.histCDF,
+		seriesPackets:      h.seriesPackets,
+		seriesWindows:      h.seriesWindows,
+	}
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Captured %d packets.",
+		len(res.Packets))
+
+	// make sure all generated packets arrived back at the receiver. tagged
+	// packets are checked in detail below
+	if len(res.Packets) != res.NumPacketsTrace && point.SeqTag == nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR,
+			"not all generated packets arrived back at the receiver")
+	}
+
+	res.Record = results.NewRecord(point.Name)
+	for key, value := range point.Params {
+		res.Record.Params[key] = value
+	}
+	res.Record.Counters = &results.Counters{
+		PacketsTrace:    res.NumPacketsTrace,
+		PacketsTX:       res.NumPacketsTX,
+		PacketsCaptured: res.NumPacketsCaptured,
+	}
+
+	h.nRuns++
+
+	// write captured packets before the analysis hook possibly reorders
+	// them
+	if h.captureDir != "" {
+		WriteCapturePcapng(res, filepath.Join(h.captureDir,
+			fmt.Sprintf("capture_%d.pcapng", h.nRuns)))
+	}
+
+	if point.SeqTag != nil {
+		CheckIntegrity(res)
+	}
+
+	if point.Analyze != nil {
+		point.Analyze(res)
+	}
+
+	// write result record
+	if h.results != nil {
+		h.results.Write(res.Record)
+	}
+
+	// reset pointers pointing to data we do not need anymore
+	res.Trace = nil
+	res.Packets = nil
+
+	// free memory
+	nt.FreeHostMemory()
+	if point.Release != nil {
+		point.Release()
+	}
+}
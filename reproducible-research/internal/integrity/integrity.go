@@ -0,0 +1,338 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package integrity analyses captured packets carrying sequence tags (see
+// tracegen.SeqTag). For each flow it reports lost packets and their
+// sequence numbers, duplicates and the reordering metrics of RFC 4737
+// (reordered packet ratio, reordering extent and n-reordering). Packets whose
+// tag does not match its CRC are counted as corrupted.
+
+package integrity
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"io"
+	"sort"
+)
+
+// LostRangesMax is the maximum number of ranges of lost sequence numbers
+// stored per flow
+const LostRangesMax = 1000
+
+// Range is a range of consecutive sequence numbers
+type Range struct {
+	First uint64 `json:"first"`
+	Count uint64 `json:"count"`
+}
+
+// FlowReport holds the results of a single flow
+type FlowReport struct {
+	FlowID uint32 `json:"flow_id"`
+
+	// number of packets of the flow in the trace
+	Expected uint64 `json:"expected"`
+
+	// number of distinct packets received
+	Received uint64 `json:"received"`
+
+	// number of packets not received and the ranges of their sequence
+	// numbers (at most LostRangesMax ranges)
+	Lost              uint64  `json:"lost"`
+	LostRanges        []Range `json:"lost_ranges,omitempty"`
+	LostRangesTrimmed bool    `json:"lost_ranges_trimmed,omitempty"`
+
+	// number of received copies of packets that have been received before
+	Duplicates uint64 `json:"duplicates"`
+
+	// number of packets with a sequence number beyond the expected packets
+	Unexpected uint64 `json:"unexpected"`
+
+	// number of packets arriving after a packet with a larger sequence
+	// number (RFC 4737, section 4.1) and their ratio to the received packets
+	Reordered      uint64  `json:"reordered"`
+	ReorderedRatio float64 `json:"reordered_ratio"`
+
+	// reordering extent (RFC 4737, section 4.2): number of packets arriving
+	// between the first packet with a larger sequence number and the
+	// reordered packet, maximum and mean of all reordered packets
+	ExtentMax  uint64  `json:"reordering_extent_max"`
+	ExtentMean float64 `json:"reordering_extent_mean"`
+
+	// number of n-reordered packets (RFC 4737, section 5.3) per n
+	NReordered map[int]uint64 `json:"n_reordered,omitempty"`
+}
+
+// Report holds the results of all flows
+type Report struct {
+	Flows []*FlowReport `json:"flows"`
+
+	// number of packets whose data does not contain a complete tag, e.g.
+	// because the capture length is too small
+	Untagged uint64 `json:"untagged"`
+
+	// number of packets whose tag does not match its CRC
+	Corrupted uint64 `json:"corrupted"`
+
+	// number of packets of flows that are not expected
+	UnknownFlow uint64 `json:"unknown_flow"`
+}
+
+// Lost returns the number of lost packets of all flows
+func (r *Report) Lost() uint64 {
+	var n uint64
+	for _, f := range r.Flows {
+		n += f.Lost
+	}
+	return n
+}
+
+// Duplicates returns the number of duplicated packets of all flows
+func (r *Report) Duplicates() uint64 {
+	var n uint64
+	for _, f := range r.Flows {
+		n += f.Duplicates
+	}
+	return n
+}
+
+// Reordered returns the number of reordered packets of all flows
+func (r *Report) Reordered() uint64 {
+	var n uint64
+	for _, f := range r.Flows {
+		n += f.Reordered
+	}
+	return n
+}
+
+// OK returns true if all expected packets have been received exactly once,
+// in order and without corruption
+func (r *Report) OK() bool {
+	if r.Untagged > 0 || r.Corrupted > 0 || r.UnknownFlow > 0 {
+		return false
+	}
+	for _, f := range r.Flows {
+		if f.Lost > 0 || f.Duplicates > 0 || f.Unexpected > 0 ||
+			f.Reordered > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes a summary of the report with one line per flow to w
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "%10s %12s %12s %12s %10s %10s %10s\n", "flow",
+		"expected", "received", "lost", "dup", "reordered", "extent")
+	for _, f := range r.Flows {
+		fmt.Fprintf(w, "%10d %12d %12d %12d %10d %10d %10d\n", f.FlowID,
+			f.Expected, f.Received, f.Lost, f.Duplicates, f.Reordered,
+			f.ExtentMax)
+	}
+	fmt.Fprintf(w, "untagged: %d, corrupted: %d, unknown flow: %d\n",
+		r.Untagged, r.Corrupted, r.UnknownFlow)
+}
+
+// state of a flow while packets are added
+type flowState struct {
+	report *FlowReport
+
+	// bitmap of received sequence numbers
+	seen []uint64
+
+	// next expected sequence number (RFC 4737, section 3.3)
+	nextExp uint64
+
+	// sequence numbers of the distinct packets in arrival order and indices
+	// of the in-order packets among them (their sequence numbers are
+	// ascending)
+	arrivals []uint64
+	inOrder  []int
+
+	extentSum uint64
+}
+
+// Checker analyses packets one by one in arrival order
+type Checker struct {
+	offset int
+	flows  map[uint32]*flowState
+	report *Report
+}
+
+// CheckerCreate creates a checker for packets carrying their sequence tag at
+// the byte offset. expected holds the number of packets of each flow ID in
+// the trace.
+func CheckerCreate(offset int, expected map[uint32]uint64) *Checker {
+	c := &Checker{
+		offset: offset,
+		flows:  make(map[uint32]*flowState),
+		report: &Report{},
+	}
+
+	for flowID, n := range expected {
+		f := &flowState{
+			report: &FlowReport{
+				FlowID:     flowID,
+				Expected:   n,
+				NReordered: make(map[int]uint64),
+			},
+			seen: make([]uint64, (n+63)/64),
+		}
+		c.flows[flowID] = f
+		c.report.Flows = append(c.report.Flows, f.report)
+	}
+	sort.Slice(c.report.Flows, func(i, j int) bool {
+		return c.report.Flows[i].FlowID < c.report.Flows[j].FlowID
+	})
+
+	return c
+}
+
+// Add analyses the data of the next arriving packet
+func (c *Checker) Add(data []byte) {
+	flowID, seq, err := tracegen.ParseSeqTag(data, c.offset)
+	if err == tracegen.ErrSeqTagTruncated {
+		c.report.Untagged++
+		return
+	} else if err != nil {
+		c.report.Corrupted++
+		return
+	}
+
+	f, ok := c.flows[flowID]
+	if !ok {
+		c.report.UnknownFlow++
+		return
+	}
+	r := f.report
+
+	if seq >= r.Expected {
+		r.Unexpected++
+		return
+	}
+
+	// duplicates are not considered for reordering (RFC 4737, section 3.2)
+	if f.seen[seq/64]&(1<<(seq%64)) != 0 {
+		r.Duplicates++
+		return
+	}
+	f.seen[seq/64] |= 1 << (seq % 64)
+	r.Received++
+
+	if seq >= f.nextExp {
+		f.nextExp = seq + 1
+		f.inOrder = append(f.inOrder, len(f.arrivals))
+		f.arrivals = append(f.arrivals, seq)
+		return
+	}
+
+	// reordered packet. the extent is the distance to the earliest packet
+	// with a larger sequence number, which is one of the in-order packets
+	r.Reordered++
+	j := len(f.arrivals)
+	k := sort.Search(len(f.inOrder), func(k int) bool {
+		return f.arrivals[f.inOrder[k]] > seq
+	})
+	extent := uint64(j - f.inOrder[k])
+	f.extentSum += extent
+	if extent > r.ExtentMax {
+		r.ExtentMax = extent
+	}
+
+	// the packet is n-reordered if the n packets arriving immediately
+	// before it have larger sequence numbers
+	n := 0
+	for n < j && f.arrivals[j-1-n] > seq {
+		n++
+	}
+	if n > 0 {
+		r.NReordered[n]++
+	}
+
+	f.arrivals = append(f.arrivals, seq)
+}
+
+// Report finishes the analysis and returns the report. The checker must not
+// be used afterwards.
+func (c *Checker) Report() *Report {
+	for _, f := range c.flows {
+		r := f.report
+
+		if r.Received > 0 {
+			r.ReorderedRatio = float64(r.Reordered) / float64(r.Received)
+		}
+		if r.Reordered > 0 {
+			r.ExtentMean = float64(f.extentSum) / float64(r.Reordered)
+		}
+
+		// collect ranges of lost sequence numbers
+		for seq := uint64(0); seq < r.Expected; seq++ {
+			if f.seen[seq/64]&(1<<(seq%64)) != 0 {
+				continue
+			}
+			r.Lost++
+
+			if n := len(r.LostRanges); n > 0 &&
+				r.LostRanges[n-1].First+r.LostRanges[n-1].Count == seq {
+				r.LostRanges[n-1].Count++
+			} else if n < LostRangesMax {
+				r.LostRanges = append(r.LostRanges, Range{First: seq, Count: 1})
+			} else {
+				r.LostRangesTrimmed = true
+			}
+		}
+
+		f.seen, f.arrivals, f.inOrder = nil, nil, nil
+	}
+
+	return c.report
+}
+
+// ExpectedFlows returns the number of packets of each flow ID of the tagged
+// flows of a trace (see tracegen.Data.Flows). Untagged flows are skipped.
+func ExpectedFlows(flows []tracegen.FlowStats) map[uint32]uint64 {
+	expected := make(map[uint32]uint64)
+	for _, f := range flows {
+		if f.FlowID != nil {
+			expected[*f.FlowID] += uint64(f.NumPackets)
+		}
+	}
+	return expected
+}
+
+// Check analyses the captured packets (in arrival order) carrying their
+// sequence tag at the byte offset. expected holds the number of packets of
+// each flow ID in the trace.
+func Check(pkts gofluent10g.CapturePackets, offset int,
+	expected map[uint32]uint64) *Report {
+	c := CheckerCreate(offset, expected)
+	for _, pkt := range pkts {
+		c.Add(pkt.Data)
+	}
+	return c.Report()
+}
@@ -0,0 +1,289 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the sequence tag analysis.
+
+package integrity
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// byte offset of the sequence tags, directly after ethernet and ipv4 header
+const offset = 34
+
+// returns the data of the first n packets of a trace tagged with the flow ID
+func taggedPackets(t *testing.T, flowID uint32, n int) [][]byte {
+	gen := tracegen.GenTraffic(tracegen.Traffic{
+		Datarate:   5e9,
+		CaptureLen: offset + tracegen.SeqTagLen,
+		Duration:   time.Duration(n) * 2 * time.Microsecond,
+		SeqTag:     &tracegen.SeqTag{Offset: offset, FlowID: flowID},
+	})
+	data, err := tracegen.Generate(gen, int64(flowID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pkts [][]byte
+	d := tracegen.DecoderCreate(data.Buf)
+	for len(pkts) < n {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			t.Fatalf("trace holds less than %d packets", n)
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, pkt.Data)
+	}
+	return pkts
+}
+
+// returns the captured packets arriving in the given order of sequence
+// numbers of flow 0
+func arrive(flow [][]byte, seqs ...int) gofluent10g.CapturePackets {
+	var pkts gofluent10g.CapturePackets
+	for _, seq := range seqs {
+		pkts = append(pkts, &gofluent10g.CapturePacket{Data: flow[seq]})
+	}
+	return pkts
+}
+
+func TestCheck(t *testing.T) {
+	flow := taggedPackets(t, 0, 16)
+
+	tests := []struct {
+		name     string
+		pkts     gofluent10g.CapturePackets
+		expected uint64
+		report   FlowReport
+	}{
+		{"in order", arrive(flow, 0, 1, 2, 3), 4,
+			FlowReport{Expected: 4, Received: 4}},
+		{"lost", arrive(flow, 0, 1, 2, 5, 6, 8, 9), 10,
+			FlowReport{Expected: 10, Received: 7, Lost: 3,
+				LostRanges: []Range{{3, 2}, {7, 1}}}},
+		{"lost at the end", arrive(flow, 0, 1), 4,
+			FlowReport{Expected: 4, Received: 2, Lost: 2,
+				LostRanges: []Range{{2, 2}}}},
+		{"duplicates", arrive(flow, 0, 1, 1, 2, 0), 3,
+			FlowReport{Expected: 3, Received: 3, Duplicates: 2}},
+		{"unexpected", arrive(flow, 0, 1, 2, 3), 2,
+			FlowReport{Expected: 2, Received: 2, Unexpected: 2}},
+
+		// RFC 4737, section 4.1: 1, 2, 3, 5, 4 (zero-based). 3 is
+		// 1-reordered with an extent of one
+		{"swapped", arrive(flow, 0, 1, 2, 4, 3), 5,
+			FlowReport{Expected: 5, Received: 5, Reordered: 1,
+				ReorderedRatio: 0.2, ExtentMax: 1, ExtentMean: 1,
+				NReordered: map[int]uint64{1: 1}}},
+
+		// RFC 4737, section 4.2.3: sequence numbers 3, 4 and 5 arrive
+		// after 6, 7, 8 and 9 with extents 4, 5 and 6. only 3 is
+		// n-reordered (n = 4), 4 and 5 arrive directly after a packet
+		// with a smaller sequence number
+		{"block", arrive(flow, 0, 1, 2, 6, 7, 8, 9, 3, 4, 5, 10), 11,
+			FlowReport{Expected: 11, Received: 11, Reordered: 3,
+				ReorderedRatio: 3.0 / 11.0, ExtentMax: 6, ExtentMean: 5,
+				NReordered: map[int]uint64{4: 1}}},
+
+		// reversed order: each packet arrives after all packets with a
+		// larger sequence number
+		{"reversed", arrive(flow, 3, 2, 1, 0), 4,
+			FlowReport{Expected: 4, Received: 4, Reordered: 3,
+				ReorderedRatio: 0.75, ExtentMax: 3, ExtentMean: 2,
+				NReordered: map[int]uint64{1: 1, 2: 1, 3: 1}}},
+
+		// duplicates of reordered packets are not reordered again
+		{"reordered duplicate", arrive(flow, 1, 0, 0, 2), 3,
+			FlowReport{Expected: 3, Received: 3, Duplicates: 1,
+				Reordered: 1, ReorderedRatio: 1.0 / 3.0, ExtentMax: 1,
+				ExtentMean: 1, NReordered: map[int]uint64{1: 1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := Check(test.pkts, offset,
+				map[uint32]uint64{0: test.expected})
+			if len(report.Flows) != 1 {
+				t.Fatalf("%d flows, expected 1", len(report.Flows))
+			}
+
+			r := report.Flows[0]
+			if len(r.NReordered) == 0 {
+				r.NReordered = nil
+			}
+			if !reflect.DeepEqual(*r, test.report) {
+				t.Errorf("report %+v, expected %+v", *r, test.report)
+			}
+
+			ok := test.report.Lost == 0 && test.report.Duplicates == 0 &&
+				test.report.Unexpected == 0 && test.report.Reordered == 0
+			if report.OK() != ok {
+				t.Errorf("OK() = %v, expected %v", report.OK(), ok)
+			}
+		})
+	}
+}
+
+func TestCheckFlows(t *testing.T) {
+	flows := [][][]byte{taggedPackets(t, 0, 4), taggedPackets(t, 7, 4),
+		taggedPackets(t, 9, 1)}
+
+	// flows are reordered among each other, but not within a flow
+	pkts := gofluent10g.CapturePackets{}
+	for _, pkt := range [][]byte{flows[1][0], flows[0][0], flows[0][1],
+		flows[1][1], flows[0][2], flows[1][2], flows[1][3], flows[2][0]} {
+		pkts = append(pkts, &gofluent10g.CapturePacket{Data: pkt})
+	}
+
+	// corrupted sequence number, truncated tag
+	corrupted := append([]byte(nil), flows[0][3]...)
+	corrupted[offset+11] ^= 1
+	pkts = append(pkts,
+		&gofluent10g.CapturePacket{Data: corrupted},
+		&gofluent10g.CapturePacket{Data: flows[0][3][:offset+10]})
+
+	report := Check(pkts, offset, map[uint32]uint64{7: 4, 0: 4})
+
+	if len(report.Flows) != 2 || report.Flows[0].FlowID != 0 ||
+		report.Flows[1].FlowID != 7 {
+		t.Fatalf("invalid flows %+v", report.Flows)
+	}
+	if r := report.Flows[0]; r.Received != 3 || r.Lost != 1 {
+		t.Errorf("flow 0: received %d, lost %d, expected 3 and 1",
+			r.Received, r.Lost)
+	}
+	if r := report.Flows[1]; r.Received != 4 || r.Lost != 0 {
+		t.Errorf("flow 7: received %d, lost %d, expected 4 and 0",
+			r.Received, r.Lost)
+	}
+	if report.Reordered() != 0 || report.Duplicates() != 0 ||
+		report.Lost() != 1 {
+		t.Errorf("reordered %d, duplicates %d, lost %d, expected 0, 0, 1",
+			report.Reordered(), report.Duplicates(), report.Lost())
+	}
+	if report.Corrupted != 1 || report.Untagged != 1 ||
+		report.UnknownFlow != 1 {
+		t.Errorf("corrupted %d, untagged %d, unknown flow %d, expected 1 "+
+			"each", report.Corrupted, report.Untagged, report.UnknownFlow)
+	}
+	if report.OK() {
+		t.Error("report OK despite errors")
+	}
+}
+
+func TestLostRangesTrimmed(t *testing.T) {
+	n := 2*LostRangesMax + 2
+	flow := taggedPackets(t, 0, n)
+
+	// every other packet is lost
+	var seqs []int
+	for seq := 0; seq < n; seq += 2 {
+		seqs = append(seqs, seq)
+	}
+
+	report := Check(arrive(flow, seqs...), offset,
+		map[uint32]uint64{0: uint64(n)})
+	r := report.Flows[0]
+	if r.Lost != uint64(n/2) || len(r.LostRanges) != LostRangesMax ||
+		!r.LostRangesTrimmed {
+		t.Errorf("lost %d in %d ranges (trimmed: %v), expected %d in %d "+
+			"ranges (trimmed)", r.Lost, len(r.LostRanges),
+			r.LostRangesTrimmed, n/2, LostRangesMax)
+	}
+}
+
+func TestExpectedFlows(t *testing.T) {
+	id := func(flowID uint32) *uint32 { return &flowID }
+
+	expected := ExpectedFlows([]tracegen.FlowStats{
+		{Name: "a", FlowID: id(3), NumPackets: 10},
+		{Name: "untagged", NumPackets: 5},
+		{Name: "b", FlowID: id(0), NumPackets: 7},
+		{Name: "c", FlowID: id(3), NumPackets: 2},
+	})
+	if !reflect.DeepEqual(expected, map[uint32]uint64{0: 7, 3: 12}) {
+		t.Errorf("expected packets %v", expected)
+	}
+}
+
+func TestCheckFlowsTrace(t *testing.T) {
+	traffic := tracegen.Traffic{
+		Datarate:   2e9,
+		CaptureLen: offset + tracegen.SeqTagLen,
+	}
+	var flows []tracegen.Flow
+	for _, flowID := range []uint32{4, 1} {
+		f := tracegen.Flow{Name: fmt.Sprintf("%d", flowID),
+			Traffic: traffic}
+		f.Traffic.SeqTag = &tracegen.SeqTag{Offset: offset, FlowID: flowID}
+		flows = append(flows, f)
+	}
+	gen := tracegen.GenFlows(flows, time.Millisecond)
+	data, err := tracegen.Generate(gen, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pkts gofluent10g.CapturePackets
+	d := tracegen.DecoderCreate(data.Buf)
+	for {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, &gofluent10g.CapturePacket{Data: pkt.Data})
+	}
+
+	// the packets of all flows are expected
+	report := Check(pkts, offset, ExpectedFlows(data.Flows))
+	if !report.OK() || len(report.Flows) != 2 {
+		t.Fatalf("report of the complete trace not OK: %+v", report)
+	}
+	for i, f := range report.Flows {
+		n := uint64(data.Flows[1-i].NumPackets)
+		if f.Expected != n || f.Received != n {
+			t.Errorf("flow %d: received %d of %d packets, expected %d",
+				f.FlowID, f.Received, f.Expected, n)
+		}
+	}
+
+	// the last packet is lost
+	report = Check(pkts[:len(pkts)-1], offset, ExpectedFlows(data.Flows))
+	if report.OK() || report.Lost() != 1 {
+		t.Errorf("lost %d packets, expected 1", report.Lost())
+	}
+}
@@ -0,0 +1,210 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package manifest records everything needed to reproduce a program run:
+// software versions, host environment, network tester backend and version,
+// start/end time, seed and the resolved experiment configuration. The
+// manifest is written to manifest.json in the output directory of the
+// program when the run starts and updated when it ends, so that runs
+// aborting with an error leave a manifest without end time.
+
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/gofluent10g"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Filename is the name of the manifest file in the output directory
+const Filename = "manifest.json"
+
+// import paths of the modules whose versions are recorded
+const (
+	pkgGofluent10g = "github.com/aoeldemann/gofluent10g"
+	pkgThis        = "github.com/aoeldemann/fluent10g-paper-fpl2018"
+)
+
+// Manifest describes a program run
+type Manifest struct {
+	Program string   `json:"program"`
+	Args    []string `json:"args"`
+
+	GoVersion          string `json:"go_version"`
+	Gofluent10gVersion string `json:"gofluent10g_version"`
+	CodeVersion        string `json:"code_version"`
+	TesterBackend      string `json:"tester_backend"`
+	TesterVersion      string `json:"tester_version"`
+
+	Hostname string `json:"hostname"`
+	Kernel   string `json:"kernel"`
+	CPU      string `json:"cpu"`
+	NumCPU   int    `json:"num_cpu"`
+
+	// end is not set while the program is running or if it aborted
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+
+	Seed   int64              `json:"seed"`
+	Config *config.Experiment `json:"config"`
+}
+
+// Create starts the manifest of the program run with the resolved
+// experiment configuration exp and writes it to the output directory of the
+// experiment
+func Create(program string, exp *config.Experiment) *Manifest {
+	m := &Manifest{
+		Program:            program,
+		Args:               os.Args[1:],
+		GoVersion:          runtime.Version(),
+		Gofluent10gVersion: pkgVersion(pkgGofluent10g),
+		CodeVersion:        pkgVersion(pkgThis),
+		TesterBackend:      os.Getenv(tester.BackendEnv),
+		Kernel:             readFirstLine("/proc/sys/kernel/osrelease"),
+		CPU:                cpuModel(),
+		NumCPU:             runtime.NumCPU(),
+		Start:              time.Now().UTC(),
+		Seed:               exp.Seed,
+		Config:             exp,
+	}
+
+	if m.TesterBackend == "" {
+		m.TesterBackend = "hardware"
+	}
+
+	m.Hostname, _ = os.Hostname()
+
+	m.write()
+
+	return m
+}
+
+// SetTester records the version of the network tester the program runs on
+// and updates the manifest in the output directory of the experiment
+func (m *Manifest) SetTester(nt tester.NetworkTester) {
+	m.TesterVersion = nt.GetVersion()
+
+	m.write()
+}
+
+// Close records the end time and updates the manifest in the output
+// directory of the experiment
+func (m *Manifest) Close() {
+	end := time.Now().UTC()
+	m.End = &end
+
+	m.write()
+}
+
+func (m *Manifest) write() {
+	m.Seed = m.Config.Seed
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(m.Config.OutDir, 0755); err == nil {
+			err = ioutil.WriteFile(filepath.Join(m.Config.OutDir, Filename),
+				append(data, '\n'), 0644)
+		}
+	}
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not write manifest: %s",
+			err.Error())
+	}
+}
+
+// returns the version of a package. if the program has been built in module
+// mode the version is taken from the build information, otherwise the git
+// commit of the package source directory is used
+func pkgVersion(path string) string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Path != "" {
+		if info.Main.Path == path && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == path {
+				return dep.Version
+			}
+		}
+	}
+
+	pkg, err := build.Import(path, "", build.FindOnly)
+	if err != nil {
+		return "unknown"
+	}
+
+	out, err := exec.Command("git", "-C", pkg.Dir, "rev-parse",
+		"HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	version := strings.TrimSpace(string(out))
+
+	// mark versions with uncommitted changes
+	out, err = exec.Command("git", "-C", pkg.Dir, "status",
+		"--porcelain").Output()
+	if err == nil && len(out) > 0 {
+		version += "-dirty"
+	}
+
+	return version
+}
+
+func readFirstLine(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+}
+
+func cpuModel() string {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "unknown"
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "model name" {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,250 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package pcapng writes captured packets to PCAPNG files (one interface
+// description block per network tester interface, nanosecond timestamps,
+// packet latency stored as packet comment), so that captures can be opened
+// in Wireshark and other tools.
+
+package pcapng
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/gofluent10g"
+	"os"
+	"time"
+)
+
+// block types
+const (
+	blockTypeSectionHeader        = 0x0A0D0D0A
+	blockTypeInterfaceDescription = 0x00000001
+	blockTypeEnhancedPacket       = 0x00000006
+)
+
+// option codes. codes of block-specific options overlap
+const (
+	// all blocks
+	optEndOfOpt = 0
+	optComment  = 1
+
+	// section header block
+	optSHBUserAppl = 4
+
+	// interface description block
+	optIfName          = 2
+	optIfDescription   = 3
+	optIfTimestampResl = 9
+)
+
+// link type of all interfaces
+const linkTypeEthernet = 1
+
+// timestamps are stored in nanoseconds
+const timestampResolutionNs = 9
+
+// Writer writes a PCAPNG file
+type Writer struct {
+	file        *os.File
+	w           *bufio.Writer
+	nInterfaces int
+}
+
+// option of a block
+type option struct {
+	code  uint16
+	value []byte
+}
+
+// Create creates the PCAPNG file filename and writes its section header.
+// application is stored as the name of the application that created the
+// file.
+func Create(filename, application string) (*Writer, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		file: file,
+		w:    bufio.NewWriter(file),
+	}
+
+	// byte-order magic, version 1.0, unspecified section length
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], 0x1A2B3C4D)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	binary.LittleEndian.PutUint16(body[6:8], 0)
+	binary.LittleEndian.PutUint64(body[8:16], 0xFFFFFFFFFFFFFFFF)
+
+	err = w.writeBlock(blockTypeSectionHeader, body, []option{
+		{optSHBUserAppl, []byte(application)},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// AddInterface adds an ethernet interface with nanosecond timestamp
+// resolution and returns its id. snapLen is the maximum number of captured
+// bytes per packet (zero: unlimited).
+func (w *Writer) AddInterface(name, description string,
+	snapLen int) (int, error) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], linkTypeEthernet)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(snapLen))
+
+	err := w.writeBlock(blockTypeInterfaceDescription, body, []option{
+		{optIfName, []byte(name)},
+		{optIfDescription, []byte(description)},
+		{optIfTimestampResl, []byte{timestampResolutionNs}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	w.nInterfaces++
+	return w.nInterfaces - 1, nil
+}
+
+// WritePacket writes a packet captured on interface ifID at the given time.
+// data are the captured bytes, wireLen is the original length of the packet.
+// comment is stored as packet comment, if it is not empty.
+func (w *Writer) WritePacket(ifID int, timestamp time.Time, data []byte,
+	wireLen int, comment string) error {
+	if ifID < 0 || ifID >= w.nInterfaces {
+		return fmt.Errorf("invalid interface id %d", ifID)
+	}
+	if wireLen < len(data) {
+		wireLen = len(data)
+	}
+
+	ts := uint64(timestamp.UnixNano())
+
+	body := make([]byte, 20+pad4(len(data)))
+	binary.LittleEndian.PutUint32(body[0:4], uint32(ifID))
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(wireLen))
+	copy(body[20:], data)
+
+	var opts []option
+	if comment != "" {
+		opts = append(opts, option{optComment, []byte(comment)})
+	}
+
+	return w.writeBlock(blockTypeEnhancedPacket, body, opts)
+}
+
+// WriteCapture writes packets captured by the network tester on interface
+// ifID. The hardware reports the time between the arrival of two packets
+// measured with its own clock, so the timestamps are relative hardware times
+// anchored on the host clock: the first packet is timestamped with start
+// (e.g. the host time the capture was started), all others with start plus
+// the hardware time elapsed since the arrival of the first packet (see
+// stats.ForEachArrival). The packet latency is stored as packet comment.
+func (w *Writer) WriteCapture(ifID int, pkts gofluent10g.CapturePackets,
+	start time.Time) error {
+	var err error
+	stats.ForEachArrival(pkts, func(pkt *gofluent10g.CapturePacket,
+		t float64) {
+		if err != nil {
+			return
+		}
+
+		var comment string
+		if pkt.Latency != 0.0 {
+			comment = fmt.Sprintf("latency: %.1f ns", pkt.Latency*1e9)
+		}
+
+		err = w.WritePacket(ifID, start.Add(time.Duration(t*1e9+0.5)),
+			pkt.Data, pkt.WireLength, comment)
+	})
+	return err
+}
+
+// Close flushes all buffered data and closes the file
+func (w *Writer) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// writes a block consisting of a fixed-length body and options
+func (w *Writer) writeBlock(blockType uint32, body []byte,
+	opts []option) error {
+	// block type + total length, body, options, total length
+	length := 12 + len(body)
+	if len(opts) > 0 {
+		for _, opt := range opts {
+			length += 4 + pad4(len(opt.value))
+		}
+		length += 4
+	}
+
+	block := make([]byte, 0, length)
+	block = appendUint32(block, blockType)
+	block = appendUint32(block, uint32(length))
+	block = append(block, body...)
+	if len(opts) > 0 {
+		for _, opt := range opts {
+			block = appendUint16(block, opt.code)
+			block = appendUint16(block, uint16(len(opt.value)))
+			block = append(block, opt.value...)
+			block = append(block, make([]byte, pad4(len(opt.value))-
+				len(opt.value))...)
+		}
+		block = appendUint16(block, optEndOfOpt)
+		block = appendUint16(block, 0)
+	}
+	block = appendUint32(block, uint32(length))
+
+	_, err := w.w.Write(block)
+	return err
+}
+
+// rounds n up to a multiple of 4
+func pad4(n int) int {
+	return 4 * ((n + 3) / 4)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
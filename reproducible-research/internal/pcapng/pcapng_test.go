@@ -0,0 +1,176 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the PCAPNG writer. Files are read back with gopacket.
+
+package pcapng
+
+import (
+	"bytes"
+	"github.com/aoeldemann/gofluent10g"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// packet expected to be read back
+type expectedPacket struct {
+	ifID      int
+	timestamp time.Time
+	data      []byte
+	wireLen   int
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pcapng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "capture.pcapng")
+	w, err := Create(filename, "pcapng test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.AddInterface("if0", "generator", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.AddInterface("if1", "receiver", 128); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2018, 8, 27, 12, 0, 0, 123456789, time.UTC)
+	data := make([]byte, 61)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	var expected []expectedPacket
+
+	// single packets with odd lengths (padded to 4 bytes in the file)
+	for i, n := range []int{0, 1, 3, 61} {
+		timestamp := start.Add(time.Duration(i) * time.Microsecond)
+		err := w.WritePacket(0, timestamp, data[:n], 60, "comment")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wireLen := 60
+		if n > wireLen {
+			wireLen = n
+		}
+		expected = append(expected,
+			expectedPacket{0, timestamp, data[:n], wireLen})
+	}
+	if err := w.WritePacket(2, start, nil, 60, ""); err == nil {
+		t.Error("no error for invalid interface id")
+	}
+
+	// captured packets, arrival times are relative to the previous packet.
+	// the arrival time of the first packet is ignored
+	pkts := gofluent10g.CapturePackets{
+		{Data: data[:14], WireLength: 1514, ArrivalTime: 3.7,
+			Latency: 409.6e-9},
+		{Data: data[:60], WireLength: 60, ArrivalTime: 6.4e-9},
+		{Data: nil, WireLength: 64, ArrivalTime: 1.5},
+	}
+	if err := w.WriteCapture(1, pkts, start); err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected,
+		expectedPacket{1, start, data[:14], 1514},
+		expectedPacket{1, start.Add(6 * time.Nanosecond), data[:60], 60},
+		expectedPacket{1, start.Add(1500000006 * time.Nanosecond), nil,
+			64})
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app := r.SectionInfo().Application; app != "pcapng test" {
+		t.Errorf("application '%s', expected 'pcapng test'", app)
+	}
+
+	for i, pkt := range expected {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatalf("packet %d: %s", i, err.Error())
+		}
+		if ci.InterfaceIndex != pkt.ifID {
+			t.Errorf("packet %d: interface %d, expected %d", i,
+				ci.InterfaceIndex, pkt.ifID)
+		}
+		if !ci.Timestamp.Equal(pkt.timestamp) {
+			t.Errorf("packet %d: timestamp %s, expected %s", i,
+				ci.Timestamp, pkt.timestamp)
+		}
+		if !bytes.Equal(data, pkt.data) || ci.CaptureLength != len(pkt.data) {
+			t.Errorf("packet %d: data differs", i)
+		}
+		if ci.Length != pkt.wireLen {
+			t.Errorf("packet %d: wire length %d, expected %d", i,
+				ci.Length, pkt.wireLen)
+		}
+	}
+	if _, _, err := r.ReadPacketData(); err != io.EOF {
+		t.Errorf("expected end of file, got %v", err)
+	}
+
+	// interfaces are known after reading their packets
+	if r.NInterfaces() != 2 {
+		t.Fatalf("%d interfaces, expected 2", r.NInterfaces())
+	}
+	for i, name := range []string{"if0", "if1"} {
+		iface, err := r.Interface(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if iface.Name != name {
+			t.Errorf("interface %d: name '%s', expected '%s'", i,
+				iface.Name, name)
+		}
+	}
+	if iface, _ := r.Interface(1); iface.SnapLength != 128 {
+		t.Errorf("snap length %d, expected 128", iface.SnapLength)
+	}
+}
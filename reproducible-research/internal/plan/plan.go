@@ -0,0 +1,290 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package plan estimates the resources required by a measurement sweep
+// without generating any traces or touching the hardware. It is used by the
+// --dry-run mode of the measurement programs.
+
+package plan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point describes a measurement point of a sweep
+type Point struct {
+	// description of the point
+	Name string
+
+	// (mean) data rate per generator in bps (including FCS, preamble, SOD
+	// and inter-frame gap of each packet)
+	Datarate float64
+
+	// (mean) packet size in bytes (including FCS)
+	Pktlen int
+
+	// model the inter-packet gaps are drawn from. Gaps are constant if nil
+	Gaps tracegen.GapModel
+
+	// number of bytes of each packet that are transferred to the hardware
+	// as part of the trace
+	TraceCaptureLen int
+
+	// number of generators replaying the trace
+	NumGenerators int
+
+	// number of receivers capturing packets
+	NumReceivers int
+
+	// maximum number of captured bytes per packet
+	CaptureMaxLen int
+
+	// capture data is discarded after it has been transferred to the host
+	CaptureDiscard bool
+
+	// replay duration
+	Duration time.Duration
+
+	// time waited after each replay to drain the capture
+	DrainTime time.Duration
+
+	// number of times the point is measured (e.g. bisection steps). zero
+	// means one run
+	Runs int
+}
+
+// Estimate holds the resources required by a measurement point
+type Estimate struct {
+	// number of packets in the trace
+	NumPackets uint64
+
+	// size of the trace in bytes
+	TraceSize uint64
+
+	// host memory required to store the capture data of all receivers
+	CaptureMemSize uint64
+
+	// DRAM bandwidth in bps required for replay and capture
+	MemBandwidth float64
+
+	// mean number of clock cycles between two packets
+	CyclesInterPacket float64
+
+	// expected number of inter-packet times exceeding the hardware limit,
+	// which are cut to the limit by the trace generators
+	NumGapsCut float64
+
+	// wall time of all runs (excluding trace generation)
+	WallTime time.Duration
+}
+
+// Plan is a list of measurement points
+type Plan struct {
+	Points []Point
+}
+
+// Add appends a measurement point to the plan
+func (p *Plan) Add(point Point) {
+	p.Points = append(p.Points, point)
+}
+
+// Estimate calculates the resources required by a measurement point. The
+// trace size follows the hardware trace format: each packet occupies 8 bytes
+// of meta data followed by the packet data padded to 8 byte words, the trace
+// is aligned to 64 bytes.
+func (point *Point) Estimate() Estimate {
+	var est Estimate
+
+	// add 20 bytes to the packet length (including FCS) to account for
+	// Ethernet preamble + SOD and inter-frame gap
+	lenWire := float64(8 * (point.Pktlen + 20))
+
+	est.NumPackets = uint64(math.Floor(point.Duration.Seconds()*
+		point.Datarate/lenWire + 0.5))
+	est.CyclesInterPacket = lenWire / point.Datarate * gofluent10g.FREQ_SFP
+
+	// gaps drawn from a gap model may be much longer than the mean gap
+	if est.CyclesInterPacket > tracegen.CyclesInterPacketMax {
+		est.NumGapsCut = float64(est.NumPackets)
+	} else if point.Gaps != nil {
+		tGapMax := time.Duration(tracegen.CyclesInterPacketMax /
+			gofluent10g.FREQ_SFP * 1e9)
+		p, err := tracegen.GapExceedProb(point.Gaps, point.Datarate,
+			float64(point.Pktlen), tGapMax)
+		if err == nil {
+			est.NumGapsCut = p * float64(est.NumPackets)
+		}
+	}
+
+	est.TraceSize = est.NumPackets * (8 + align(point.TraceCaptureLen, 8))
+	est.TraceSize = align64(est.TraceSize, 64)
+
+	if point.NumReceivers > 0 && !point.CaptureDiscard {
+		est.CaptureMemSize = uint64(point.NumReceivers) * est.NumPackets *
+			(8 + align(point.CaptureMaxLen, 8))
+	}
+
+	// every replayed and captured byte is written to and read from DRAM
+	// once
+	if point.Duration > 0 {
+		bwTrace := 2.0 * 8.0 * float64(est.TraceSize) /
+			point.Duration.Seconds()
+		bwCapture := 2.0 * 8.0 * float64(est.NumPackets*
+			(8+align(point.CaptureMaxLen, 8))) / point.Duration.Seconds()
+		est.MemBandwidth = float64(point.NumGenerators)*bwTrace +
+			float64(point.NumReceivers)*bwCapture
+	}
+
+	runs := point.Runs
+	if runs == 0 {
+		runs = 1
+	}
+	if point.NumGenerators > 0 {
+		est.WallTime = time.Duration(runs) *
+			(point.Duration + point.DrainTime)
+	}
+
+	return est
+}
+
+// Print prints all measurement points with their resource estimates and
+// warnings for points that cannot be measured
+func (p *Plan) Print(w io.Writer) {
+	memTotal := hostMemTotal()
+
+	var wallTime time.Duration
+	var nWarnings int
+
+	fmt.Fprintf(w, "# measurement plan (%d points)\n", len(p.Points))
+
+	for i, point := range p.Points {
+		est := point.Estimate()
+		wallTime += est.WallTime
+
+		fmt.Fprintf(w, "%d/%d: %s\n", i+1, len(p.Points), point.Name)
+		fmt.Fprintf(w, "    packets:           %d\n", est.NumPackets)
+		fmt.Fprintf(w, "    trace size:        %s\n",
+			formatBytes(est.TraceSize))
+		fmt.Fprintf(w, "    capture host mem:  %s\n",
+			formatBytes(est.CaptureMemSize))
+		fmt.Fprintf(w, "    DRAM bandwidth:    %.2f Gbps\n",
+			est.MemBandwidth/1e9)
+		fmt.Fprintf(w, "    wall time:         %s\n", est.WallTime)
+
+		// host must hold trace and capture data at the same time
+		memRequired := est.TraceSize + est.CaptureMemSize
+		if memTotal > 0 && memRequired > memTotal {
+			fmt.Fprintf(w, "    WARNING: requires %s of host memory, only "+
+				"%s available\n", formatBytes(memRequired),
+				formatBytes(memTotal))
+			nWarnings++
+		}
+
+		if est.CyclesInterPacket > tracegen.CyclesInterPacketMax {
+			fmt.Fprintf(w, "    WARNING: inter-packet time of %.0f clock "+
+				"cycles exceeds hardware limit of %d cycles\n",
+				est.CyclesInterPacket,
+				uint64(tracegen.CyclesInterPacketMax))
+			nWarnings++
+		} else if est.NumGapsCut >= 1.0 {
+			fmt.Fprintf(w, "    WARNING: %.0f inter-packet times of the gap "+
+				"model expected to exceed hardware limit of %d cycles\n",
+				est.NumGapsCut, uint64(tracegen.CyclesInterPacketMax))
+			nWarnings++
+		}
+	}
+
+	fmt.Fprintf(w, "# estimated total wall time: %s (excluding trace "+
+		"generation)\n", wallTime)
+	if nWarnings > 0 {
+		fmt.Fprintf(w, "# %d warning(s)\n", nWarnings)
+	}
+}
+
+// BisectionRuns returns the number of measurement runs of a data rate
+// bisection with the given initial step size and abort step size
+func BisectionRuns(stepInit, stepLimit float64) int {
+	runs := 1
+	for step := stepInit; step > stepLimit; step /= 2.0 {
+		runs++
+	}
+	return runs
+}
+
+func align(n int, alignment int) uint64 {
+	return align64(uint64(n), uint64(alignment))
+}
+
+func align64(n uint64, alignment uint64) uint64 {
+	if n%alignment != 0 {
+		n = alignment * (n/alignment + 1)
+	}
+	return n
+}
+
+func formatBytes(n uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v := float64(n)
+	i := 0
+	for v >= 1024.0 && i < len(units)-1 {
+		v /= 1024.0
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", v, units[i])
+}
+
+// returns the total amount of host memory in bytes, zero if it cannot be
+// determined
+func hostMemTotal() uint64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package results writes machine-readable result records. Each measurement
+// point produces one JSON object on a separate line of the file
+// results.jsonl in the output directory of the program, next to the .dat
+// files.
+
+package results
+
+import (
+	"encoding/json"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/integrity"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Filename is the name of the result record file in the output directory
+const Filename = "results.jsonl"
+
+// RunInfo holds meta data of the program run a record belongs to
+type RunInfo struct {
+	Program string    `json:"program"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+	Seed    int64     `json:"seed"`
+	Backend string    `json:"backend"`
+}
+
+// Counters holds the packet counters of a measurement point
+type Counters struct {
+	// number of packets in the trace
+	PacketsTrace int `json:"packets_trace"`
+
+	// number of packets transmitted by the generator(s)
+	PacketsTX int `json:"packets_tx"`
+
+	// number of packets captured by the receiver(s)
+	PacketsCaptured int `json:"packets_captured"`
+}
+
+// LatencyStats holds latency statistics in nanoseconds
+type LatencyStats struct {
+	Min    Float `json:"min_ns"`
+	Max    Float `json:"max_ns"`
+	Mean   Float `json:"mean_ns"`
+	StdDev Float `json:"stddev_ns"`
+
+	// percentiles (see stats.Sketch for their precision)
+	P50   Float `json:"p50_ns"`
+	P90   Float `json:"p90_ns"`
+	P99   Float `json:"p99_ns"`
+	P999  Float `json:"p99_9_ns"`
+	P9999 Float `json:"p99_99_ns"`
+
+	// median absolute deviation
+	MAD Float `json:"mad_ns"`
+
+	// 95% confidence interval of the mean
+	MeanCILow  Float `json:"mean_ci95_low_ns"`
+	MeanCIHigh Float `json:"mean_ci95_high_ns"`
+}
+
+// Float is a floating-point value that is written as null if it is not
+// finite. JSON cannot represent NaN and infinity, encoding the record would
+// fail otherwise (e.g. the confidence interval of a single packet's latency).
+type Float float64
+
+// MarshalJSON implements json.Marshaler
+func (f Float) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+// Values holds program-specific results. Values that are not finite are
+// written as null (see Float).
+type Values map[string]float64
+
+// MarshalJSON implements json.Marshaler
+func (v Values) MarshalJSON() ([]byte, error) {
+	m := make(map[string]Float, len(v))
+	for key, value := range v {
+		m[key] = Float(value)
+	}
+	return json.Marshal(m)
+}
+
+// Record is the result of a single measurement point
+type Record struct {
+	Run RunInfo `json:"run"`
+
+	// time the record was written
+	Time time.Time `json:"time"`
+
+	// description of the measurement point
+	Point string `json:"point"`
+
+	// parameters of the measurement point (data rate, packet size, ...)
+	Params map[string]interface{} `json:"params"`
+
+	Counters *Counters     `json:"counters,omitempty"`
+	Latency  *LatencyStats `json:"latency,omitempty"`
+
+	// loss, reordering and duplication of packets carrying sequence tags
+	Integrity *integrity.Report `json:"integrity,omitempty"`
+
+	// further program-specific results (e.g. maximum throughput)
+	Values Values `json:"values,omitempty"`
+
+	// .dat files written for this measurement point
+	Files []string `json:"files,omitempty"`
+}
+
+// Writer appends records to the result record file
+type Writer struct {
+	run  RunInfo
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Create creates the result record file in the directory outDir. Records
+// are tagged with the name of the program and the seed used for random
+// trace generation.
+func Create(outDir string, program string, seed int64) (*Writer, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(filepath.Join(outDir, Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+
+	backend := os.Getenv(tester.BackendEnv)
+	if backend == "" {
+		backend = "hardware"
+	}
+
+	return &Writer{
+		run: RunInfo{
+			Program: program,
+			Host:    host,
+			Started: time.Now().UTC(),
+			Seed:    seed,
+			Backend: backend,
+		},
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// NewRecord returns an empty record for the measurement point with the
+// description point
+func NewRecord(point string) *Record {
+	return &Record{
+		Point:  point,
+		Params: make(map[string]interface{}),
+		Values: make(Values),
+	}
+}
+
+// Write appends a record to the file
+func (w *Writer) Write(rec *Record) {
+	rec.Run = w.run
+	rec.Time = time.Now().UTC()
+
+	// parameters are written as null if they are not finite (see Float)
+	for key, value := range rec.Params {
+		if f, ok := value.(float64); ok {
+			rec.Params[key] = Float(f)
+		}
+	}
+
+	if err := w.enc.Encode(rec); err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not write result "+
+			"record: %s", err.Error())
+	}
+}
+
+// Close closes the file
+func (w *Writer) Close() {
+	w.file.Close()
+}
+
+// CalcLatencyStats calculates latency statistics of the captured packets in a
+// single pass, the packets are not sorted
+func CalcLatencyStats(pkts gofluent10g.CapturePackets) *LatencyStats {
+	if len(pkts) == 0 {
+		return nil
+	}
+
+	sketch := stats.SketchCreate()
+	for _, pkt := range pkts {
+		sketch.Add(pkt.Latency * 1e9)
+	}
+
+	return LatencyStatsFromSketch(sketch)
+}
+
+// LatencyStatsFromSketch returns the latency statistics of the latencies (in
+// nanoseconds) recorded by sketch
+func LatencyStatsFromSketch(sketch *stats.Sketch) *LatencyStats {
+	if sketch.Count() == 0 {
+		return nil
+	}
+
+	ciLow, ciHigh := sketch.MeanCI(0.95)
+	return &LatencyStats{
+		Min:        Float(sketch.Min()),
+		Max:        Float(sketch.Max()),
+		Mean:       Float(sketch.Mean()),
+		StdDev:     Float(sketch.StdDev()),
+		P50:        Float(sketch.Percentile(50)),
+		P90:        Float(sketch.Percentile(90)),
+		P99:        Float(sketch.Percentile(99)),
+		P999:       Float(sketch.Percentile(99.9)),
+		P9999:      Float(sketch.Percentile(99.99)),
+		MAD:        Float(sketch.MAD()),
+		MeanCILow:  Float(ciLow),
+		MeanCIHigh: Float(ciHigh),
+	}
+}
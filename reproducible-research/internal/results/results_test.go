@@ -0,0 +1,100 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the result record writer.
+
+package results
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteNonFinite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := Create(dir, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewRecord("point")
+	rec.Params["rate"] = math.Inf(1)
+	rec.Values["finite"] = 1.5
+	rec.Values["nan"] = math.NaN()
+	rec.Values["inf"] = math.Inf(-1)
+	rec.Latency = &LatencyStats{Mean: 410.0, MeanCILow: Float(math.NaN())}
+	w.Write(rec)
+	w.Close()
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Params  map[string]*float64 `json:"params"`
+		Values  map[string]*float64 `json:"values"`
+		Latency map[string]*float64 `json:"latency"`
+	}
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatalf("record not written: %s (%q)", err, buf)
+	}
+
+	tests := []struct {
+		name  string
+		value *float64
+		want  float64
+		null  bool
+	}{
+		{"params.rate", decoded.Params["rate"], 0, true},
+		{"values.finite", decoded.Values["finite"], 1.5, false},
+		{"values.nan", decoded.Values["nan"], 0, true},
+		{"values.inf", decoded.Values["inf"], 0, true},
+		{"latency.mean_ns", decoded.Latency["mean_ns"], 410.0, false},
+		{"latency.mean_ci95_low_ns", decoded.Latency["mean_ci95_low_ns"], 0,
+			true},
+	}
+	for _, test := range tests {
+		if test.null {
+			if test.value != nil {
+				t.Errorf("%s: got %g, expected null", test.name, *test.value)
+			}
+		} else if test.value == nil || *test.value != test.want {
+			t.Errorf("%s: got %v, expected %g", test.name, test.value,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Latency histograms with selectable binning. By default every distinct
+// latency value gets its own bin, which keeps the full resolution but makes
+// histograms of long captures or different data rates hard to compare.
+// Fixed-width, clock-cycle, logarithmic and HDR-style (log-linear) binning
+// keep files small and bins aligned across runs. Histograms can be merged
+// and written as cumulative distribution.
+
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Binning maps latency values (in ns) to histogram bins
+type Binning interface {
+	// returns the bin the value v falls into, represented by its lower edge
+	Bin(v float64) float64
+
+	// returns the binning specification (see ParseBinning)
+	String() string
+}
+
+// tolerance for floating point errors when dividing values by the bin width,
+// e.g. 409.6 / 6.4
+const binEpsilon = 1e-9
+
+// BinningExact creates one bin for each distinct value
+type BinningExact struct{}
+
+// Bin returns v
+func (BinningExact) Bin(v float64) float64 {
+	return v
+}
+
+func (BinningExact) String() string {
+	return "exact"
+}
+
+// BinningFixed creates bins of a fixed width (in ns)
+type BinningFixed struct {
+	Width float64
+}
+
+// Bin returns the lower edge of the bin v falls into
+func (b BinningFixed) Bin(v float64) float64 {
+	return math.Floor(v/b.Width+binEpsilon) * b.Width
+}
+
+func (b BinningFixed) String() string {
+	return fmt.Sprintf("fixed:width=%g", b.Width)
+}
+
+// BinningClock creates bins that are multiples of the 6.4 ns clock period
+// of the network tester
+type BinningClock struct {
+	Cycles int
+}
+
+// Bin returns the lower edge of the bin v falls into
+func (b BinningClock) Bin(v float64) float64 {
+	width := float64(b.Cycles) * 1e9 / gofluent10g.FREQ_SFP
+	return math.Floor(v/width+binEpsilon) * width
+}
+
+func (b BinningClock) String() string {
+	return fmt.Sprintf("clock:cycles=%d", b.Cycles)
+}
+
+// BinningLog creates logarithmically sized bins, BinsPerDecade bins per
+// power of ten. Values smaller than 1 ns fall into the bin 0.
+type BinningLog struct {
+	BinsPerDecade int
+}
+
+// Bin returns the lower edge of the bin v falls into
+func (b BinningLog) Bin(v float64) float64 {
+	if v < 1.0 {
+		return 0.0
+	}
+	n := float64(b.BinsPerDecade)
+	return math.Pow(10, math.Floor(math.Log10(v)*n+binEpsilon)/n)
+}
+
+func (b BinningLog) String() string {
+	return fmt.Sprintf("log:bins=%d", b.BinsPerDecade)
+}
+
+// BinningHDR creates log-linear bins like an HDR histogram: values are
+// quantized to Unit ns and binned exactly up to 2^Bits units, larger values
+// fall into bins whose width is at most 2^-Bits of their value
+type BinningHDR struct {
+	Bits int
+	Unit float64
+}
+
+// Bin returns the lower edge of the bin v falls into
+func (b BinningHDR) Bin(v float64) float64 {
+	if v < 0 {
+		return 0.0
+	}
+	q := uint64(v/b.Unit + binEpsilon)
+	if q >= 1<<uint(b.Bits) {
+		shift := uint(bits.Len64(q)) - 1 - uint(b.Bits)
+		q = q >> shift << shift
+	}
+	return float64(q) * b.Unit
+}
+
+func (b BinningHDR) String() string {
+	return fmt.Sprintf("hdr:bits=%d,unit=%g", b.Bits, b.Unit)
+}
+
+// ParseBinning parses a binning specification "<name>[:<key>=<value>,...]":
+//
+//	exact                    one bin per distinct value (default, also used
+//	                         for an empty specification)
+//	fixed:width=10           fixed bin width in ns
+//	clock:cycles=1           bin width in clock cycles (6.4 ns)
+//	log:bins=100             number of bins per decade
+//	hdr:bits=7,unit=0.1      log-linear bins, 2^bits bins per power of two
+//	                         above 2^bits units of unit ns
+func ParseBinning(spec string) (Binning, error) {
+	fields := strings.SplitN(spec, ":", 2)
+	name := fields[0]
+
+	params := make(map[string]string)
+	if len(fields) == 2 {
+		for _, param := range strings.Split(fields[1], ",") {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid binning parameter '%s'",
+					param)
+			}
+			params[kv[0]] = kv[1]
+		}
+	}
+
+	used := make(map[string]bool)
+	var err error
+	float := func(key string, def float64) float64 {
+		used[key] = true
+		str, ok := params[key]
+		if !ok || err != nil {
+			return def
+		}
+		var v float64
+		if v, err = strconv.ParseFloat(str, 64); err != nil {
+			err = fmt.Errorf("invalid binning parameter '%s': %s", key, str)
+		}
+		return v
+	}
+	integer := func(key string, def int) int {
+		used[key] = true
+		str, ok := params[key]
+		if !ok || err != nil {
+			return def
+		}
+		var v int
+		if v, err = strconv.Atoi(str); err != nil {
+			err = fmt.Errorf("invalid binning parameter '%s': %s", key, str)
+		}
+		return v
+	}
+
+	var binning Binning
+	switch name {
+	case "", "exact":
+		binning = BinningExact{}
+	case "fixed":
+		binning = BinningFixed{Width: float("width", 0.0)}
+	case "clock":
+		binning = BinningClock{Cycles: integer("cycles", 1)}
+	case "log":
+		binning = BinningLog{BinsPerDecade: integer("bins", 100)}
+	case "hdr":
+		binning = BinningHDR{
+			Bits: integer("bits", 7),
+			Unit: float("unit", 0.1),
+		}
+	default:
+		return nil, fmt.Errorf("unknown binning '%s'", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	for key := range params {
+		if !used[key] {
+			return nil, fmt.Errorf("unknown parameter '%s' of binning '%s'",
+				key, name)
+		}
+	}
+
+	switch b := binning.(type) {
+	case BinningFixed:
+		if b.Width <= 0.0 {
+			return nil, errors.New("bin width must be positive")
+		}
+	case BinningClock:
+		if b.Cycles < 1 {
+			return nil, errors.New("bin width must be at least one cycle")
+		}
+	case BinningLog:
+		if b.BinsPerDecade < 1 {
+			return nil, errors.New("number of bins per decade must be " +
+				"positive")
+		}
+	case BinningHDR:
+		if b.Bits < 1 || b.Bits > 20 || b.Unit <= 0.0 {
+			return nil, errors.New("bits must be between 1 and 20 and " +
+				"unit must be positive")
+		}
+	}
+
+	return binning, nil
+}
+
+// Histogram counts latency values (in ns) per bin
+type Histogram struct {
+	binning Binning
+	counts  map[float64]uint64
+	n       uint64
+}
+
+// HistogramCreate creates an empty histogram. If binning is nil, each
+// distinct value gets its own bin.
+func HistogramCreate(binning Binning) *Histogram {
+	if binning == nil {
+		binning = BinningExact{}
+	}
+	return &Histogram{
+		binning: binning,
+		counts:  make(map[float64]uint64),
+	}
+}
+
+// Binning returns the binning of the histogram
+func (h *Histogram) Binning() Binning {
+	return h.binning
+}
+
+// Add counts the value v
+func (h *Histogram) Add(v float64) {
+	h.AddCount(v, 1)
+}
+
+// AddCount counts the value v count times
+func (h *Histogram) AddCount(v float64, count uint64) {
+	h.counts[h.binning.Bin(v)] += count
+	h.n += count
+}
+
+// Merge adds the bins of the histogram o, e.g. of another run or receiver
+// interface. The bins of o are binned again, so the result is only exact if o
+// has been created with the same binning or a finer binning whose bins do not
+// cross the bin edges of h.
+func (h *Histogram) Merge(o *Histogram) {
+	for v, count := range o.counts {
+		h.AddCount(v, count)
+	}
+}
+
+// Count returns the number of counted values
+func (h *Histogram) Count() uint64 {
+	return h.n
+}
+
+// Bins returns the non-empty bins in ascending order
+func (h *Histogram) Bins() []datfile.HistogramBin {
+	bins := make([]datfile.HistogramBin, 0, len(h.counts))
+	for v, count := range h.counts {
+		bins = append(bins, datfile.HistogramBin{
+			Latency:     v,
+			Occurrences: count,
+		})
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].Latency < bins[j].Latency
+	})
+	return bins
+}
+
+// WriteFile writes the histogram to the file filename ("<latency>
+// <occurrences>" per line, see datfile.ReadHistogram)
+func (h *Histogram) WriteFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, bin := range h.Bins() {
+		if _, err = fmt.Fprintf(file, "%f %d\n", bin.Latency,
+			bin.Occurrences); err != nil {
+			break
+		}
+	}
+
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// WriteCDFFile writes the cumulative distribution of the histogram to the
+// file filename ("<latency> <fraction of values in this or a lower bin>" per
+// line)
+func (h *Histogram) WriteCDFFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	var acc uint64
+	for _, bin := range h.Bins() {
+		acc += bin.Occurrences
+		if _, err = fmt.Fprintf(file, "%f %.9f\n", bin.Latency,
+			float64(acc)/float64(h.n)); err != nil {
+			break
+		}
+	}
+
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the latency histograms.
+
+package stats
+
+import (
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBinning(t *testing.T) {
+	tests := []struct {
+		binning Binning
+		v       float64
+		bin     float64
+	}{
+		{BinningExact{}, 412.3, 412.3},
+		{BinningFixed{Width: 10}, 409.6, 400},
+		{BinningFixed{Width: 10}, 410, 410},
+		{BinningFixed{Width: 0.1}, 0.3, 0.3},
+		{BinningClock{Cycles: 1}, 409.6, 409.6},
+		{BinningClock{Cycles: 1}, 415.9, 409.6},
+		{BinningClock{Cycles: 2}, 420, 409.6},
+		{BinningLog{BinsPerDecade: 10}, 0.5, 0},
+		{BinningLog{BinsPerDecade: 10}, 100, 100},
+		{BinningLog{BinsPerDecade: 10}, 150, math.Pow(10, 2.1)},
+		{BinningHDR{Bits: 2, Unit: 1}, 3.7, 3},
+		{BinningHDR{Bits: 2, Unit: 1}, 5, 5},
+		{BinningHDR{Bits: 2, Unit: 1}, 9, 8},
+		{BinningHDR{Bits: 2, Unit: 1}, 15, 14},
+		{BinningHDR{Bits: 2, Unit: 1}, 100, 96},
+		{BinningHDR{Bits: 7, Unit: 0.1}, 409.6, 409.6},
+		{BinningHDR{Bits: 2, Unit: 1}, -1, 0},
+	}
+
+	for _, test := range tests {
+		bin := test.binning.Bin(test.v)
+		if !almostEqual(bin, test.bin, 1e-9) {
+			t.Errorf("%s: value %g falls into bin %g, expected %g",
+				test.binning, test.v, bin, test.bin)
+		}
+	}
+}
+
+func TestParseBinning(t *testing.T) {
+	tests := []struct {
+		spec    string
+		binning Binning
+	}{
+		{"", BinningExact{}},
+		{"exact", BinningExact{}},
+		{"fixed:width=10", BinningFixed{Width: 10}},
+		{"clock", BinningClock{Cycles: 1}},
+		{"clock:cycles=4", BinningClock{Cycles: 4}},
+		{"log", BinningLog{BinsPerDecade: 100}},
+		{"log:bins=20", BinningLog{BinsPerDecade: 20}},
+		{"hdr", BinningHDR{Bits: 7, Unit: 0.1}},
+		{"hdr:bits=10, unit=1", BinningHDR{Bits: 10, Unit: 1}},
+	}
+
+	for _, test := range tests {
+		binning, err := ParseBinning(test.spec)
+		if err != nil {
+			t.Errorf("'%s': %s", test.spec, err.Error())
+			continue
+		}
+		if binning != test.binning {
+			t.Errorf("'%s': binning %s, expected %s", test.spec, binning,
+				test.binning)
+		}
+
+		// the specification of the binning parses to the same binning
+		if reparsed, err := ParseBinning(binning.String()); err != nil ||
+			reparsed != binning {
+			t.Errorf("'%s': specification '%s' does not round-trip",
+				test.spec, binning)
+		}
+	}
+
+	invalid := []string{
+		"fixed",
+		"fixed:width=0",
+		"fixed:width=abc",
+		"clock:cycles=0",
+		"log:bins=0",
+		"hdr:bits=21",
+		"hdr:unit=-1",
+		"fixed:width=10,bins=3",
+		"fixed:width",
+		"linear",
+	}
+	for _, spec := range invalid {
+		if _, err := ParseBinning(spec); err == nil {
+			t.Errorf("'%s': no error", spec)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := HistogramCreate(BinningFixed{Width: 10})
+	for _, v := range []float64{412, 405, 419.9, 420, 398} {
+		h.Add(v)
+	}
+	h.AddCount(401, 3)
+
+	// histogram of another run with a finer binning
+	o := HistogramCreate(BinningFixed{Width: 5})
+	o.AddCount(427, 2)
+	o.Add(414)
+	h.Merge(o)
+
+	expected := []datfile.HistogramBin{
+		{Latency: 390, Occurrences: 1},
+		{Latency: 400, Occurrences: 4},
+		{Latency: 410, Occurrences: 3},
+		{Latency: 420, Occurrences: 3},
+	}
+	if !reflect.DeepEqual(h.Bins(), expected) {
+		t.Errorf("bins %v, expected %v", h.Bins(), expected)
+	}
+	if h.Count() != 11 {
+		t.Errorf("%d values, expected 11", h.Count())
+	}
+
+	filename := filepath.Join(dir, "histogram.dat")
+	if err := h.WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	bins, err := datfile.ReadHistogram(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bins, expected) {
+		t.Errorf("read bins %v, expected %v", bins, expected)
+	}
+
+	filename = filepath.Join(dir, "cdf.dat")
+	if err := h.WriteCDFFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := datfile.ReadColumns(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fractions := []float64{1.0 / 11, 5.0 / 11, 8.0 / 11, 1}
+	if len(columns) != len(fractions) {
+		t.Fatalf("%d CDF lines, expected %d", len(columns), len(fractions))
+	}
+	for i, fraction := range fractions {
+		if columns[i][0] != expected[i].Latency ||
+			!almostEqual(columns[i][1], fraction, 1e-8) {
+			t.Errorf("CDF line %d: %v, expected %g %g", i, columns[i],
+				expected[i].Latency, fraction)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package stats calculates latency statistics of arbitrarily many packets in
+// a single pass and constant memory. Latencies are recorded in a log-linear
+// histogram (similar to an HDR histogram): values are quantized to 10 ps and
+// stored exactly up to 2^SubBucketBits quantization steps, larger values are
+// stored in buckets whose width is at most 2^-SubBucketBits of their value.
+// Each bucket is represented by the mean of its values, which is exact if all
+// values of a bucket are equal (e.g. latencies that are multiples of the
+// hardware clock period). Percentiles and the median absolute deviation are
+// derived from the histogram without sorting the packets, min, max, mean and
+// standard deviation are calculated exactly.
+
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// SubBucketBits determines the relative precision of the percentiles:
+	// bucket widths are at most 2^-SubBucketBits (~0.1%) of their values
+	SubBucketBits = 10
+
+	// quantization step of recorded values
+	quantum = 0.01
+
+	subBuckets = 1 << SubBucketBits
+)
+
+// Sketch is a streaming summary of latency values
+type Sketch struct {
+	// number and sum of values per bucket, grow on demand
+	counts []uint64
+	sums   []float64
+
+	n        uint64
+	min, max float64
+
+	// running mean and sum of squared deviations from the mean (Welford)
+	mean float64
+	m2   float64
+}
+
+// SketchCreate creates an empty sketch
+func SketchCreate() *Sketch {
+	return &Sketch{
+		min: math.Inf(1),
+		max: math.Inf(-1),
+	}
+}
+
+// returns the bucket index of the quantized value v
+func bucketIndex(v uint64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	shift := uint(bits.Len64(v)) - 1 - SubBucketBits
+	return int(shift+1)*subBuckets + int(v>>shift) - subBuckets
+}
+
+// returns the value representing all values of the bucket idx: their mean
+func (s *Sketch) bucketValue(idx int) float64 {
+	return s.sums[idx] / float64(s.counts[idx])
+}
+
+// grows the buckets to hold at least n buckets
+func (s *Sketch) grow(n int) {
+	if n <= len(s.counts) {
+		return
+	}
+	counts := make([]uint64, n)
+	copy(counts, s.counts)
+	s.counts = counts
+	sums := make([]float64, n)
+	copy(sums, s.sums)
+	s.sums = sums
+}
+
+// Add records the value v. Negative values are recorded as zero.
+func (s *Sketch) Add(v float64) {
+	if v < 0 || math.IsNaN(v) {
+		v = 0
+	}
+
+	idx := bucketIndex(uint64(v/quantum + 0.5))
+	if idx >= len(s.counts) {
+		s.grow(idx + subBuckets)
+	}
+	s.counts[idx]++
+	s.sums[idx] += v
+
+	s.n++
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+
+	delta := v - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (v - s.mean)
+}
+
+// Reset removes all recorded values, the allocated buckets are kept
+func (s *Sketch) Reset() {
+	for idx := range s.counts {
+		s.counts[idx] = 0
+		s.sums[idx] = 0.0
+	}
+	s.n = 0
+	s.min, s.max = math.Inf(1), math.Inf(-1)
+	s.mean, s.m2 = 0.0, 0.0
+}
+
+// Merge adds all values recorded by the sketch o, e.g. to combine the
+// latencies of multiple receivers
+func (s *Sketch) Merge(o *Sketch) {
+	if o.n == 0 {
+		return
+	}
+
+	s.grow(len(o.counts))
+	for idx, count := range o.counts {
+		s.counts[idx] += count
+		s.sums[idx] += o.sums[idx]
+	}
+
+	// combine means and squared deviations (Chan et al.)
+	n := s.n + o.n
+	delta := o.mean - s.mean
+	s.m2 += o.m2 + delta*delta*float64(s.n)*float64(o.n)/float64(n)
+	s.mean += delta * float64(o.n) / float64(n)
+	s.n = n
+
+	s.min = math.Min(s.min, o.min)
+	s.max = math.Max(s.max, o.max)
+}
+
+// Count returns the number of recorded values
+func (s *Sketch) Count() uint64 {
+	return s.n
+}
+
+// Min returns the smallest recorded value
+func (s *Sketch) Min() float64 {
+	return s.min
+}
+
+// Max returns the largest recorded value
+func (s *Sketch) Max() float64 {
+	return s.max
+}
+
+// Mean returns the mean of the recorded values
+func (s *Sketch) Mean() float64 {
+	return s.mean
+}
+
+// StdDev returns the sample standard deviation of the recorded values
+func (s *Sketch) StdDev() float64 {
+	if s.n < 2 {
+		return 0.0
+	}
+	return math.Sqrt(s.m2 / float64(s.n-1))
+}
+
+// MeanCI returns the confidence interval of the mean at the confidence level
+// (e.g. 0.95) based on the normal approximation. Latencies of subsequent
+// packets are correlated, so the interval only describes the uncertainty of
+// the mean if the packets are sufficiently far apart. At least two values are
+// required to estimate the interval, otherwise both bounds are NaN.
+func (s *Sketch) MeanCI(level float64) (float64, float64) {
+	if s.n < 2 {
+		return math.NaN(), math.NaN()
+	}
+	z := math.Sqrt2 * math.Erfinv(level)
+	h := z * s.StdDev() / math.Sqrt(float64(s.n))
+	return s.mean - h, s.mean + h
+}
+
+// Percentile returns the p-th percentile (0 <= p <= 100) of the recorded
+// values (nearest rank). The 0th and 100th percentile are the exact minimum
+// and maximum, all others deviate by less than one bucket width.
+func (s *Sketch) Percentile(p float64) float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	if p <= 0 {
+		return s.min
+	}
+	if p >= 100 {
+		return s.max
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(s.n)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var acc uint64
+	for idx, count := range s.counts {
+		acc += count
+		if acc >= rank {
+			return s.bucketValue(idx)
+		}
+	}
+	return s.max
+}
+
+// MAD returns the median absolute deviation of the recorded values from
+// their median. It deviates by at most one bucket width of the median.
+func (s *Sketch) MAD() float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	median := s.Percentile(50)
+
+	type deviation struct {
+		value float64
+		count uint64
+	}
+	var devs []deviation
+	for idx, count := range s.counts {
+		if count > 0 {
+			devs = append(devs, deviation{
+				math.Abs(s.bucketValue(idx) - median), count})
+		}
+	}
+	sort.Slice(devs, func(i, j int) bool {
+		return devs[i].value < devs[j].value
+	})
+
+	rank := (s.n + 1) / 2
+	var acc uint64
+	for _, dev := range devs {
+		acc += dev.count
+		if acc >= rank {
+			return dev.value
+		}
+	}
+	return devs[len(devs)-1].value
+}
@@ -0,0 +1,253 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the streaming latency statistics.
+
+package stats
+
+import (
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// clock period of the hardware in ns
+const tClock = 1e9 / gofluent10g.FREQ_SFP
+
+// returns captured packets with the given latencies (in ns)
+func capturePackets(latencies []float64) gofluent10g.CapturePackets {
+	pkts := make(gofluent10g.CapturePackets, len(latencies))
+	for i, latency := range latencies {
+		pkts[i] = &gofluent10g.CapturePacket{
+			ArrivalTime: 1e-6,
+			Latency:     latency * 1e-9,
+		}
+	}
+	return pkts
+}
+
+// returns a sketch of the latencies of the captured packets
+func sketchPackets(pkts gofluent10g.CapturePackets) *Sketch {
+	s := SketchCreate()
+	for _, pkt := range pkts {
+		s.Add(pkt.Latency * 1e9)
+	}
+	return s
+}
+
+// reference statistics calculated from the sorted latencies
+type reference struct {
+	sorted []float64
+}
+
+func referenceCreate(pkts gofluent10g.CapturePackets) *reference {
+	r := &reference{}
+	for _, pkt := range pkts {
+		r.sorted = append(r.sorted, pkt.Latency*1e9)
+	}
+	sort.Float64s(r.sorted)
+	return r
+}
+
+func (r *reference) mean() float64 {
+	sum := 0.0
+	for _, v := range r.sorted {
+		sum += v
+	}
+	return sum / float64(len(r.sorted))
+}
+
+func (r *reference) stdDev() float64 {
+	mean := r.mean()
+	sum := 0.0
+	for _, v := range r.sorted {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(r.sorted)-1))
+}
+
+// nearest rank percentile
+func (r *reference) percentile(p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(r.sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return r.sorted[rank-1]
+}
+
+func (r *reference) mad() float64 {
+	median := r.percentile(50)
+	devs := make([]float64, len(r.sorted))
+	for i, v := range r.sorted {
+		devs[i] = math.Abs(v - median)
+	}
+	sort.Float64s(devs)
+	return devs[(len(devs)+1)/2-1]
+}
+
+func almostEqual(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol*math.Max(1.0, math.Abs(b))
+}
+
+func TestSketch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	// latencies that are multiples of the clock period
+	clock := make([]float64, 10000)
+	for i := range clock {
+		clock[i] = tClock * float64(64+rnd.Intn(200))
+	}
+
+	// continuous latencies spanning several orders of magnitude
+	continuous := make([]float64, 10000)
+	for i := range continuous {
+		continuous[i] = 400 * math.Exp(3*rnd.NormFloat64())
+	}
+
+	tests := []struct {
+		name      string
+		latencies []float64
+
+		// relative tolerance of the percentiles and the MAD
+		tol float64
+	}{
+		{"single packet", []float64{409.6}, 1e-12},
+		{"two packets", []float64{409.6, 416.0}, 1e-12},
+		{"clock cycles", clock, 1e-12},
+		{"continuous", continuous, 1.0 / subBuckets},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkts := capturePackets(test.latencies)
+			s := sketchPackets(pkts)
+			r := referenceCreate(pkts)
+
+			if s.Count() != uint64(len(pkts)) {
+				t.Errorf("count %d, expected %d", s.Count(), len(pkts))
+			}
+			if s.Min() != r.sorted[0] {
+				t.Errorf("min %f, expected %f", s.Min(), r.sorted[0])
+			}
+			if s.Max() != r.sorted[len(r.sorted)-1] {
+				t.Errorf("max %f, expected %f", s.Max(),
+					r.sorted[len(r.sorted)-1])
+			}
+			if !almostEqual(s.Mean(), r.mean(), 1e-9) {
+				t.Errorf("mean %f, expected %f", s.Mean(), r.mean())
+			}
+			if len(pkts) > 1 && !almostEqual(s.StdDev(), r.stdDev(), 1e-9) {
+				t.Errorf("standard deviation %f, expected %f", s.StdDev(),
+					r.stdDev())
+			}
+
+			for _, p := range []float64{0, 1, 10, 50, 90, 99, 99.9, 100} {
+				expected := r.percentile(p)
+				if p == 0 {
+					expected = r.sorted[0]
+				}
+				if !almostEqual(s.Percentile(p), expected, test.tol) {
+					t.Errorf("%gth percentile %f, expected %f", p,
+						s.Percentile(p), expected)
+				}
+			}
+
+			// the MAD deviates by at most one bucket width of the median,
+			// the deviations themselves by one bucket width as well
+			if math.Abs(s.MAD()-r.mad()) > 2*test.tol*r.percentile(50) {
+				t.Errorf("MAD %f, expected %f", s.MAD(), r.mad())
+			}
+		})
+	}
+}
+
+func TestSketchMerge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+
+	latencies := make([]float64, 1000)
+	for i := range latencies {
+		latencies[i] = tClock * float64(64+rnd.Intn(100))
+	}
+	pkts := capturePackets(latencies)
+
+	all := sketchPackets(pkts)
+	merged := sketchPackets(pkts[:300])
+	merged.Merge(sketchPackets(pkts[300:]))
+	merged.Merge(SketchCreate())
+
+	if merged.Count() != all.Count() || merged.Min() != all.Min() ||
+		merged.Max() != all.Max() {
+		t.Errorf("merged count/min/max %d/%f/%f, expected %d/%f/%f",
+			merged.Count(), merged.Min(), merged.Max(), all.Count(),
+			all.Min(), all.Max())
+	}
+	if !almostEqual(merged.Mean(), all.Mean(), 1e-9) ||
+		!almostEqual(merged.StdDev(), all.StdDev(), 1e-9) {
+		t.Errorf("merged mean/standard deviation %f/%f, expected %f/%f",
+			merged.Mean(), merged.StdDev(), all.Mean(), all.StdDev())
+	}
+	for _, p := range []float64{1, 50, 99} {
+		if merged.Percentile(p) != all.Percentile(p) {
+			t.Errorf("merged %gth percentile %f, expected %f", p,
+				merged.Percentile(p), all.Percentile(p))
+		}
+	}
+}
+
+func TestSketchEmpty(t *testing.T) {
+	s := SketchCreate()
+	if s.Count() != 0 || !math.IsNaN(s.Percentile(50)) ||
+		!math.IsNaN(s.MAD()) || s.StdDev() != 0 {
+		t.Error("invalid statistics of empty sketch")
+	}
+
+	// the confidence interval of the mean requires at least two values
+	for i := 0; i < 3; i++ {
+		low, high := s.MeanCI(0.95)
+		if (i < 2) != (math.IsNaN(low) && math.IsNaN(high)) {
+			t.Errorf("mean confidence interval [%f, %f] of %d values", low,
+				high, i)
+		}
+		if i == 2 && !(low <= s.Mean() && s.Mean() <= high) {
+			t.Errorf("mean %f outside of confidence interval [%f, %f]",
+				s.Mean(), low, high)
+		}
+		s.Add(float64(100 * (i + 1)))
+	}
+	s.Reset()
+
+	// negative latencies are recorded as zero
+	s.Add(-1)
+	s.Reset()
+	s.Add(-1)
+	if s.Count() != 1 || s.Min() != 0 || s.Max() != 0 {
+		t.Errorf("count/min/max %d/%f/%f, expected 1/0/0", s.Count(),
+			s.Min(), s.Max())
+	}
+}
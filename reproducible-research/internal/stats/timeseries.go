@@ -0,0 +1,205 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Latency time series. The hardware reports the time between the arrival of
+// two captured packets, so the packets of a capture are in arrival order as
+// long as they are not sorted. Per-packet (arrival time, latency) series and
+// latency statistics aggregated over fixed time windows reveal latency drift,
+// periodic spikes and warm-up effects that are hidden in a histogram.
+
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"os"
+	"time"
+)
+
+// Window holds latency statistics in nanoseconds of the packets arriving
+// within a time window
+type Window struct {
+	// start of the window in seconds after the arrival of the first packet
+	Start float64
+
+	NumPackets uint64
+
+	Min  float64
+	Max  float64
+	Mean float64
+	P50  float64
+	P99  float64
+	P999 float64
+}
+
+// WindowAggregator aggregates packet latencies in fixed time windows
+type WindowAggregator struct {
+	// window width in seconds
+	width float64
+
+	// index of the current window, -1 if no packet has been added yet
+	index  int64
+	sketch *Sketch
+
+	windows []Window
+}
+
+// WindowAggregatorCreate creates an aggregator of windows of the given width
+func WindowAggregatorCreate(width time.Duration) *WindowAggregator {
+	return &WindowAggregator{
+		width:  width.Seconds(),
+		index:  -1,
+		sketch: SketchCreate(),
+	}
+}
+
+// Add adds the latency (in ns) of a packet arriving at time t (in seconds
+// after the start of the capture). Packets must be added in arrival order.
+func (a *WindowAggregator) Add(t, latency float64) {
+	index := int64(math.Floor(t / a.width))
+	if index != a.index {
+		a.flush()
+		a.index = index
+	}
+	a.sketch.Add(latency)
+}
+
+// completes the current window
+func (a *WindowAggregator) flush() {
+	s := a.sketch
+	if s.Count() == 0 {
+		return
+	}
+
+	a.windows = append(a.windows, Window{
+		Start:      float64(a.index) * a.width,
+		NumPackets: s.Count(),
+		Min:        s.Min(),
+		Max:        s.Max(),
+		Mean:       s.Mean(),
+		P50:        s.Percentile(50),
+		P99:        s.Percentile(99),
+		P999:       s.Percentile(99.9),
+	})
+	s.Reset()
+}
+
+// Windows completes the current window and returns all windows containing at
+// least one packet in ascending order
+func (a *WindowAggregator) Windows() []Window {
+	a.flush()
+	return a.windows
+}
+
+// ForEachArrival calls f with each captured packet in the order of pkts and
+// its arrival time in seconds after the arrival of the first packet. The
+// hardware reports the time since the arrival of the previous packet, the
+// arrival time it reports for the first packet is not meaningful and
+// ignored.
+func ForEachArrival(pkts gofluent10g.CapturePackets,
+	f func(pkt *gofluent10g.CapturePacket, t float64)) {
+	// the inter-packet arrival times of millions of packets are summed up.
+	// compensated (Kahan) summation keeps the rounding error of the sum
+	// independent of the number of packets
+	var t, c float64
+	for i, pkt := range pkts {
+		if i > 0 {
+			y := pkt.ArrivalTime - c
+			sum := t + y
+			c = (sum - t) - y
+			t = sum
+		}
+		f(pkt, t)
+	}
+}
+
+// AggregateLatency returns the latency statistics of the captured packets
+// aggregated in windows of the given width. pkts must be in arrival order
+// (as returned by the receiver).
+func AggregateLatency(pkts gofluent10g.CapturePackets,
+	width time.Duration) []Window {
+	a := WindowAggregatorCreate(width)
+	ForEachArrival(pkts, func(pkt *gofluent10g.CapturePacket, t float64) {
+		a.Add(t, pkt.Latency*1e9)
+	})
+	return a.Windows()
+}
+
+// WriteLatencySeries writes the arrival time (in seconds after the arrival of
+// the first packet) and latency (in ns) of each captured packet to the file
+// filename ("<arrival time> <latency>" per line). pkts must be in arrival
+// order.
+func WriteLatencySeries(pkts gofluent10g.CapturePackets,
+	filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	// the series may contain millions of packets, buffer the lines
+	w := bufio.NewWriter(file)
+	ForEachArrival(pkts, func(pkt *gofluent10g.CapturePacket, t float64) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%.9f %f\n", t, pkt.Latency*1e9)
+		}
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// WriteWindows writes latency windows to the file filename ("<start>
+// <packets> <min> <max> <mean> <p50> <p99> <p99.9>" per line, start in
+// seconds, latencies in ns)
+func WriteWindows(windows []Window, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "# start packets min max mean p50 p99 "+
+		"p99.9\n")
+	for _, w := range windows {
+		if err != nil {
+			break
+		}
+		_, err = fmt.Fprintf(file, "%.9f %d %f %f %f %f %f %f\n", w.Start,
+			w.NumPackets, w.Min, w.Max, w.Mean, w.P50, w.P99, w.P999)
+	}
+
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
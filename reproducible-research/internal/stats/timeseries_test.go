@@ -0,0 +1,189 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the latency time series.
+
+package stats
+
+import (
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"github.com/aoeldemann/gofluent10g"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// returns captured packets with the given times between the arrival of two
+// packets (in s, the first one is reported by the hardware for the first
+// packet and ignored) and latencies (in ns)
+func seriesPackets(arrivals, latencies []float64) gofluent10g.CapturePackets {
+	pkts := make(gofluent10g.CapturePackets, len(arrivals))
+	for i := range arrivals {
+		pkts[i] = &gofluent10g.CapturePacket{
+			ArrivalTime: arrivals[i],
+			Latency:     latencies[i] * 1e-9,
+		}
+	}
+	return pkts
+}
+
+// latencies are converted from ns to s and back, so they are compared with a
+// tolerance
+func windowEqual(a, b Window) bool {
+	return a.NumPackets == b.NumPackets &&
+		almostEqual(a.Start, b.Start, 1e-12) &&
+		almostEqual(a.Min, b.Min, 1e-12) &&
+		almostEqual(a.Max, b.Max, 1e-12) &&
+		almostEqual(a.Mean, b.Mean, 1e-12) &&
+		almostEqual(a.P50, b.P50, 1e-12) &&
+		almostEqual(a.P99, b.P99, 1e-12) &&
+		almostEqual(a.P999, b.P999, 1e-12)
+}
+
+func TestAggregateLatency(t *testing.T) {
+	tests := []struct {
+		name      string
+		arrivals  []float64
+		latencies []float64
+		width     time.Duration
+		windows   []Window
+	}{
+		{"single window",
+			[]float64{0, 1e-4, 1e-4},
+			[]float64{400, 500, 600},
+			time.Millisecond,
+			[]Window{{Start: 0, NumPackets: 3, Min: 400, Max: 600,
+				Mean: 500, P50: 500, P99: 600, P999: 600}}},
+		{"empty windows are skipped",
+			[]float64{0, 2.5e-3, 1e-4},
+			[]float64{400, 800, 600},
+			time.Millisecond,
+			[]Window{
+				{Start: 0, NumPackets: 1, Min: 400, Max: 400, Mean: 400,
+					P50: 400, P99: 400, P999: 400},
+				{Start: 2e-3, NumPackets: 2, Min: 600, Max: 800,
+					Mean: 700, P50: 600, P99: 800, P999: 800},
+			}},
+		{"arrival time of first packet ignored",
+			[]float64{3.7, 1e-4, 2e-3},
+			[]float64{400, 500, 600},
+			time.Millisecond,
+			[]Window{
+				{Start: 0, NumPackets: 2, Min: 400, Max: 500, Mean: 450,
+					P50: 400, P99: 500, P999: 500},
+				{Start: 2e-3, NumPackets: 1, Min: 600, Max: 600,
+					Mean: 600, P50: 600, P99: 600, P999: 600},
+			}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			windows := AggregateLatency(seriesPackets(test.arrivals,
+				test.latencies), test.width)
+			if len(windows) != len(test.windows) {
+				t.Fatalf("%d windows, expected %d", len(windows),
+					len(test.windows))
+			}
+			for i, w := range windows {
+				expected := test.windows[i]
+				if !windowEqual(w, expected) {
+					t.Errorf("window %d: %+v, expected %+v", i, w,
+						expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteLatencySeries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// one million packets 6.4 ns apart, the series starts with the first
+	// packet
+	n := 1000000
+	arrivals := make([]float64, n)
+	latencies := make([]float64, n)
+	arrivals[0] = 3.7
+	for i := range arrivals {
+		if i > 0 {
+			arrivals[i] = tClock * 1e-9
+		}
+		latencies[i] = 409.6 + tClock*float64(i%3)
+	}
+
+	filename := filepath.Join(dir, "series.dat")
+	err = WriteLatencySeries(seriesPackets(arrivals, latencies), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := datfile.ReadColumns(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n {
+		t.Fatalf("%d rows, expected %d", len(rows), n)
+	}
+	for i, row := range rows {
+		if math.Abs(row[0]-float64(i)*tClock*1e-9) > 1e-9 {
+			t.Fatalf("row %d: arrival time %.9f, expected %.9f", i, row[0],
+				float64(i)*tClock*1e-9)
+		}
+		if math.Abs(row[1]-latencies[i]) > 1e-6 {
+			t.Fatalf("row %d: latency %f, expected %f", i, row[1],
+				latencies[i])
+		}
+	}
+}
+
+func TestForEachArrivalRounding(t *testing.T) {
+	// one million packets 6.4 ns apart: the arrival times must not
+	// accumulate rounding errors
+	n := 1000000
+	pkts := make(gofluent10g.CapturePackets, n)
+	for i := range pkts {
+		pkts[i] = &gofluent10g.CapturePacket{ArrivalTime: tClock * 1e-9}
+	}
+
+	i := 0
+	ForEachArrival(pkts, func(pkt *gofluent10g.CapturePacket,
+		arrival float64) {
+		expected := float64(i) * tClock * 1e-9
+		if i%1000 == 0 && math.Abs(arrival-expected) > 1e-15*expected {
+			t.Fatalf("packet %d: arrival time %g, expected %g", i, arrival,
+				expected)
+		}
+		i++
+	})
+}
@@ -0,0 +1,106 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Thin wrappers around the gofluent10g types, so that they satisfy the
+// interfaces of this package.
+
+package tester
+
+import (
+	"github.com/aoeldemann/gofluent10g"
+	"os"
+)
+
+type hwNetworkTester struct {
+	*gofluent10g.NetworkTester
+}
+
+type hwGenerator struct {
+	*gofluent10g.Generator
+}
+
+type hwReceiver struct {
+	*gofluent10g.Receiver
+}
+
+type hwInterface struct {
+	*gofluent10g.Interface
+}
+
+// CreateHardware opens the NetFPGA-SUME network tester
+func CreateHardware() NetworkTester {
+	return &hwNetworkTester{gofluent10g.NetworkTesterCreate()}
+}
+
+func (nt *hwNetworkTester) GetGenerator(id int) Generator {
+	return &hwGenerator{nt.NetworkTester.GetGenerator(id)}
+}
+
+func (nt *hwNetworkTester) GetGenerators() Generators {
+	gens := nt.NetworkTester.GetGenerators()
+	wrapped := make(Generators, len(gens))
+	for i, gen := range gens {
+		wrapped[i] = &hwGenerator{gen}
+	}
+	return wrapped
+}
+
+func (nt *hwNetworkTester) GetReceiver(id int) Receiver {
+	return &hwReceiver{nt.NetworkTester.GetReceiver(id)}
+}
+
+func (nt *hwNetworkTester) GetReceivers() Receivers {
+	recvs := nt.NetworkTester.GetReceivers()
+	wrapped := make(Receivers, len(recvs))
+	for i, recv := range recvs {
+		wrapped[i] = &hwReceiver{recv}
+	}
+	return wrapped
+}
+
+func (nt *hwNetworkTester) GetInterface(id int) Interface {
+	return &hwInterface{nt.NetworkTester.GetInterface(id)}
+}
+
+// GetVersion returns the hardware version reported by the network tester, if
+// the gofluent10g version in use provides it. Otherwise it returns the
+// version given by the HardwareVersionEnv environment variable or "unknown".
+func (nt *hwNetworkTester) GetVersion() string {
+	if v, ok := interface{}(nt.NetworkTester).(interface {
+		GetHardwareVersion() string
+	}); ok {
+		return v.GetHardwareVersion()
+	}
+	if v := os.Getenv(HardwareVersionEnv); v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+func (recv *hwReceiver) GetCapture() Capture {
+	return recv.Receiver.GetCapture()
+}
@@ -0,0 +1,523 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Software model of the network tester. The interfaces are looped back in
+// pairs (0 <-> 1, 2 <-> 3) like in our fibre measurement setup. Packets are
+// delivered with a configurable latency, latency jitter and loss
+// probability. Replay and capture complete immediately, i.e. the model does
+// not wait for the trace duration to pass. Inter-packet times and packet data
+// are only modelled for traces assigned with SetTraceData, packets of other
+// traces are evenly distributed over the trace duration and carry no data.
+
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// number of network interfaces of the simulated network tester
+const simNumInterfaces = 4
+
+// SimConfig holds the parameters of the simulated network tester
+type SimConfig struct {
+	// mean latency between generator and receiver
+	Latency time.Duration
+
+	// standard deviation of the latency
+	LatencyJitter time.Duration
+
+	// probability that a packet is lost on its way to the receiver
+	LossRate float64
+
+	// maximum DRAM bandwidth in bps the network tester sustains for replay
+	// and capture. If the configured traces exceed it, an error is flagged
+	// like on the hardware. Zero disables the limit.
+	MemBandwidthMax float64
+
+	// seed of the random number generator used for jitter and loss
+	Seed int64
+}
+
+// SimConfigDefault returns a configuration roughly matching the latency we
+// measured with our fibre loopback setup
+func SimConfigDefault() SimConfig {
+	return SimConfig{
+		Latency:         410 * time.Nanosecond,
+		LatencyJitter:   5 * time.Nanosecond,
+		LossRate:        0.0,
+		MemBandwidthMax: 0.0,
+		Seed:            1,
+	}
+}
+
+// SimConfigFromEnv returns the default configuration overridden by the
+// FLUENT10G_SIM_LATENCY, FLUENT10G_SIM_JITTER, FLUENT10G_SIM_LOSS,
+// FLUENT10G_SIM_MEMBW and FLUENT10G_SIM_SEED environment variables
+func SimConfigFromEnv() (SimConfig, error) {
+	cfg := SimConfigDefault()
+
+	p := simEnvParser{}
+	p.duration("FLUENT10G_SIM_LATENCY", &cfg.Latency)
+	p.duration("FLUENT10G_SIM_JITTER", &cfg.LatencyJitter)
+	p.float("FLUENT10G_SIM_LOSS", &cfg.LossRate)
+	p.float("FLUENT10G_SIM_MEMBW", &cfg.MemBandwidthMax)
+	p.int("FLUENT10G_SIM_SEED", &cfg.Seed)
+
+	return cfg, p.err
+}
+
+// parses the environment variables overriding the simulation configuration,
+// remembers the first error. variables that are not set leave the value
+// untouched
+type simEnvParser struct {
+	err error
+}
+
+func (p *simEnvParser) get(name string) (string, bool) {
+	s := os.Getenv(name)
+	return s, s != "" && p.err == nil
+}
+
+func (p *simEnvParser) fail(name, s string) {
+	p.err = fmt.Errorf("invalid value '%s' for %s", s, name)
+}
+
+func (p *simEnvParser) duration(name string, d *time.Duration) {
+	if s, ok := p.get(name); ok {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			p.fail(name, s)
+		}
+		*d = v
+	}
+}
+
+func (p *simEnvParser) float(name string, f *float64) {
+	if s, ok := p.get(name); ok {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			p.fail(name, s)
+		}
+		*f = v
+	}
+}
+
+func (p *simEnvParser) int(name string, i *int64) {
+	if s, ok := p.get(name); ok {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			p.fail(name, s)
+		}
+		*i = v
+	}
+}
+
+type simNetworkTester struct {
+	cfg SimConfig
+	rnd *rand.Rand
+
+	gens   []*simGenerator
+	recvs  []*simReceiver
+	ifaces []*simInterface
+
+	checkErrors bool
+	err         error
+	capturing   bool
+}
+
+type simGenerator struct {
+	trace *gofluent10g.Trace
+
+	// trace data and replay count (see SetTraceData)
+	buf      []byte
+	nReplays int
+}
+
+// packet replayed by a simulated generator
+type simPacket struct {
+	// time the packet is sent in seconds after the replay started
+	tSend float64
+
+	// wire length (without FCS) and packet data. unknown if the trace data
+	// is not available
+	wireLen int
+	data    []byte
+}
+
+type simReceiver struct {
+	captureEnabled bool
+	captureMaxLen  int
+	captureDiscard bool
+	captureMemSize uint64
+
+	nPktsCaptured int
+	pkts          gofluent10g.CapturePackets
+
+	// host memory occupied by the captured packets
+	memSize uint64
+}
+
+type simInterface struct {
+	nPktsTX int
+}
+
+type simCapture struct {
+	pkts gofluent10g.CapturePackets
+}
+
+// CreateSim creates a simulated network tester
+func CreateSim(cfg SimConfig) NetworkTester {
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Using simulated network tester "+
+		"(latency: %s, jitter: %s, loss rate: %g)", cfg.Latency,
+		cfg.LatencyJitter, cfg.LossRate)
+
+	nt := &simNetworkTester{
+		cfg:         cfg,
+		rnd:         rand.New(rand.NewSource(cfg.Seed)),
+		checkErrors: true,
+	}
+
+	for i := 0; i < simNumInterfaces; i++ {
+		nt.gens = append(nt.gens, &simGenerator{})
+		nt.recvs = append(nt.recvs, &simReceiver{captureMaxLen: 1518})
+		nt.ifaces = append(nt.ifaces, &simInterface{})
+	}
+
+	return nt
+}
+
+func (nt *simNetworkTester) Close() {}
+
+func (nt *simNetworkTester) GetVersion() string {
+	return "simulation"
+}
+
+func (nt *simNetworkTester) GetGenerator(id int) Generator {
+	nt.checkID(id)
+	return nt.gens[id]
+}
+
+func (nt *simNetworkTester) GetGenerators() Generators {
+	gens := make(Generators, len(nt.gens))
+	for i, gen := range nt.gens {
+		gens[i] = gen
+	}
+	return gens
+}
+
+func (nt *simNetworkTester) GetReceiver(id int) Receiver {
+	nt.checkID(id)
+	return nt.recvs[id]
+}
+
+func (nt *simNetworkTester) GetReceivers() Receivers {
+	recvs := make(Receivers, len(nt.recvs))
+	for i, recv := range nt.recvs {
+		recvs[i] = recv
+	}
+	return recvs
+}
+
+func (nt *simNetworkTester) GetInterface(id int) Interface {
+	nt.checkID(id)
+	return nt.ifaces[id]
+}
+
+// interface ids are validated with the configuration, an invalid id is a
+// programming error
+func (nt *simNetworkTester) checkID(id int) {
+	if id < 0 || id >= simNumInterfaces {
+		panic(fmt.Sprintf("invalid interface id %d", id))
+	}
+}
+
+// timestamps are not modelled, latency is always available
+func (nt *simNetworkTester) SetTimestampMode(mode gofluent10g.TimestampMode) {}
+func (nt *simNetworkTester) SetTimestampPos(pos int)                         {}
+func (nt *simNetworkTester) SetTimestampWidth(width int)                     {}
+
+func (nt *simNetworkTester) SetCheckErrors(check bool) {
+	nt.checkErrors = check
+}
+
+func (nt *simNetworkTester) CheckErrors() error {
+	return nt.err
+}
+
+func (nt *simNetworkTester) flagError(err error) {
+	nt.err = err
+	if nt.checkErrors {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+	}
+}
+
+func (nt *simNetworkTester) WriteConfig() {
+	// a new configuration resets error state and packet counters
+	nt.err = nil
+	for _, iface := range nt.ifaces {
+		iface.nPktsTX = 0
+	}
+	for _, recv := range nt.recvs {
+		recv.nPktsCaptured = 0
+	}
+}
+
+func (nt *simNetworkTester) StartCapture() {
+	nt.capturing = true
+}
+
+func (nt *simNetworkTester) StopCapture() {
+	nt.capturing = false
+}
+
+func (nt *simNetworkTester) FreeHostMemory() {
+	for _, recv := range nt.recvs {
+		recv.pkts = nil
+		recv.memSize = 0
+	}
+}
+
+func (nt *simNetworkTester) StartReplay() {
+	// check whether the hardware would be able to sustain the configured
+	// replay and capture data rate
+	if nt.cfg.MemBandwidthMax > 0.0 {
+		if memBandwidth := nt.memBandwidth(); memBandwidth >
+			nt.cfg.MemBandwidthMax {
+			nt.flagError(errors.New("simulated DRAM bandwidth exceeded"))
+			return
+		}
+	}
+
+	for i, gen := range nt.gens {
+		if gen.trace == nil {
+			continue
+		}
+
+		pkts, err := gen.packets()
+		if err != nil {
+			nt.flagError(err)
+			return
+		}
+		nt.ifaces[i].nPktsTX += len(pkts)
+
+		// packets are looped back to the neighbouring interface
+		recv := nt.recvs[i^1]
+		if !nt.capturing || !recv.captureEnabled {
+			continue
+		}
+
+		if err := nt.capture(recv, pkts); err != nil {
+			nt.flagError(err)
+			return
+		}
+	}
+}
+
+// delivers the replayed packets pkts to the receiver recv
+func (nt *simNetworkTester) capture(recv *simReceiver,
+	pkts []simPacket) error {
+	// arrival time of the previously captured packet
+	tArrivalPrev := math.Inf(-1)
+
+	for _, pkt := range pkts {
+		if nt.rnd.Float64() < nt.cfg.LossRate {
+			continue
+		}
+
+		latency := nt.latency()
+
+		// packets cannot overtake each other on the link
+		tArrival := math.Max(pkt.tSend+latency, tArrivalPrev)
+
+		// the hardware stores the arrival time relative to the previously
+		// captured packet
+		tInterArrival := 0.0
+		if !math.IsInf(tArrivalPrev, -1) {
+			tInterArrival = tArrival - tArrivalPrev
+		}
+		tArrivalPrev = tArrival
+
+		if !recv.captureDiscard {
+			// the hardware captures up to captureMaxLen bytes of the packet.
+			// if the packet length is unknown, we account for the maximum
+			// capture length
+			captureLen := recv.captureMaxLen
+			if pkt.data != nil && pkt.wireLen < captureLen {
+				captureLen = pkt.wireLen
+			}
+
+			// each captured packet occupies 8 bytes of meta data followed
+			// by the packet data padded to 8 byte words in host memory
+			recv.memSize += uint64(tracegen.PacketSize(captureLen))
+			if recv.captureMemSize > 0 &&
+				recv.memSize > recv.captureMemSize {
+				return errors.New("capture host memory exhausted")
+			}
+
+			// bytes beyond the data stored in the trace are zero, like
+			// the bytes appended by the hardware before transmission
+			var data []byte
+			if pkt.data != nil {
+				data = make([]byte, captureLen)
+				copy(data, pkt.data)
+			}
+
+			recv.pkts = append(recv.pkts, &gofluent10g.CapturePacket{
+				Data:        data,
+				WireLength:  pkt.wireLen,
+				ArrivalTime: tInterArrival,
+				Latency:     latency,
+			})
+		}
+
+		recv.nPktsCaptured++
+	}
+
+	return nil
+}
+
+// returns the total DRAM bandwidth required by the configured traces. Every
+// replayed and captured bit is written to and read from DRAM once.
+func (nt *simNetworkTester) memBandwidth() float64 {
+	memBandwidth := 0.0
+	for i, gen := range nt.gens {
+		if gen.trace == nil {
+			continue
+		}
+		bw := 2.0 * 8.0 * float64(gen.trace.GetSize()) /
+			gen.trace.GetDuration().Seconds()
+		memBandwidth += bw
+		if nt.recvs[i^1].captureEnabled {
+			memBandwidth += bw
+		}
+	}
+	return memBandwidth
+}
+
+// returns a random packet latency in seconds. latency is quantized to the
+// timestamp clock period like on the hardware
+func (nt *simNetworkTester) latency() float64 {
+	latency := nt.cfg.Latency.Seconds() +
+		nt.cfg.LatencyJitter.Seconds()*nt.rnd.NormFloat64()
+	if latency < 0.0 {
+		latency = 0.0
+	}
+	return math.Floor(latency*gofluent10g.FREQ_SFP+0.5) / gofluent10g.FREQ_SFP
+}
+
+func (gen *simGenerator) SetTrace(trace *gofluent10g.Trace) {
+	gen.trace = trace
+	gen.buf = nil
+	gen.nReplays = 1
+}
+
+// returns the packets replayed by the generator
+func (gen *simGenerator) packets() ([]simPacket, error) {
+	if gen.buf == nil {
+		// the model does not know the individual inter-packet times of the
+		// trace, so packets are evenly distributed over the trace duration
+		nPkts := gen.trace.GetPacketCount()
+		if nPkts == 0 {
+			return nil, nil
+		}
+		tInterPacket := gen.trace.GetDuration().Seconds() / float64(nPkts)
+
+		pkts := make([]simPacket, nPkts)
+		for i := range pkts {
+			pkts[i].tSend = float64(i) * tInterPacket
+		}
+		return pkts, nil
+	}
+
+	var pkts []simPacket
+
+	// clock cycles elapsed since the replay started. accumulated as integer
+	// to avoid rounding errors
+	var cycles uint64
+
+	for i := 0; i < gen.nReplays; i++ {
+		d := tracegen.DecoderCreate(gen.buf)
+		for {
+			pkt, err := d.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			pkts = append(pkts, simPacket{
+				tSend:   float64(cycles) / gofluent10g.FREQ_SFP,
+				wireLen: pkt.WireLen,
+				data:    pkt.Data,
+			})
+			cycles += pkt.CyclesInterPacket
+		}
+	}
+
+	return pkts, nil
+}
+
+func (recv *simReceiver) EnableCapture(enable bool) {
+	recv.captureEnabled = enable
+}
+
+func (recv *simReceiver) SetCaptureMaxLen(maxLen int) {
+	recv.captureMaxLen = maxLen
+}
+
+func (recv *simReceiver) SetCaptureDiscard(discard bool) {
+	recv.captureDiscard = discard
+}
+
+func (recv *simReceiver) SetCaptureHostMemSize(size uint64) {
+	recv.captureMemSize = size
+}
+
+func (recv *simReceiver) GetCapture() Capture {
+	return &simCapture{recv.pkts}
+}
+
+func (recv *simReceiver) GetPacketCountCaptured() int {
+	return recv.nPktsCaptured
+}
+
+func (iface *simInterface) GetPacketCountTX() int {
+	return iface.nPktsTX
+}
+
+func (capture *simCapture) GetPackets() gofluent10g.CapturePackets {
+	return capture.pkts
+}
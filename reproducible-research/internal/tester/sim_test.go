@@ -0,0 +1,297 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the simulated network tester.
+
+package tester
+
+import (
+	"bytes"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// trace packet used to build test traces
+type testPacket struct {
+	data      []byte
+	wireLen   int
+	gapCycles uint64
+}
+
+func buildTrace(t *testing.T, pkts []testPacket) *tracegen.Data {
+	b := tracegen.BuilderCreate()
+	for _, pkt := range pkts {
+		err := b.AddPacket(pkt.data, pkt.wireLen, pkt.gapCycles)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Finish()
+}
+
+// replays data nReplays times from interface 0 and returns the packets
+// captured on interface 1
+func replay(t *testing.T, cfg SimConfig, data *tracegen.Data, nReplays int,
+	captureMaxLen int, captureMemSize uint64) (gofluent10g.CapturePackets,
+	error) {
+	nt := CreateSim(cfg)
+	nt.SetCheckErrors(false)
+
+	SetTraceData(nt.GetGenerator(0), data.TraceReplays(nReplays), data.Buf,
+		nReplays)
+
+	recv := nt.GetReceiver(1)
+	recv.EnableCapture(true)
+	recv.SetCaptureMaxLen(captureMaxLen)
+	recv.SetCaptureHostMemSize(captureMemSize)
+
+	nt.WriteConfig()
+	nt.StartCapture()
+	nt.StartReplay()
+	nt.StopCapture()
+
+	if n := nt.GetInterface(0).GetPacketCountTX(); n !=
+		nReplays*data.NumPackets {
+		t.Errorf("%d packets transmitted, expected %d", n,
+			nReplays*data.NumPackets)
+	}
+
+	return recv.GetCapture().GetPackets(), nt.CheckErrors()
+}
+
+func TestSimReplay(t *testing.T) {
+	// no latency jitter, so inter-arrival times equal inter-packet times
+	cfg := SimConfigDefault()
+	cfg.LatencyJitter = 0
+
+	tests := []struct {
+		name          string
+		pkts          []testPacket
+		nReplays      int
+		captureMaxLen int
+
+		// expected inter-arrival times in clock cycles and captured bytes
+		cyclesInterArrival []uint64
+		data               [][]byte
+	}{
+		{
+			name:               "empty",
+			nReplays:           1,
+			captureMaxLen:      64,
+			cyclesInterArrival: nil,
+		},
+		{
+			name: "gaps and data",
+			pkts: []testPacket{
+				{[]byte{1, 2, 3}, 60, 10},
+				{[]byte{4, 5, 6, 7}, 1514, 1000},
+				{[]byte{8}, 60, 20},
+			},
+			nReplays:           1,
+			captureMaxLen:      6,
+			cyclesInterArrival: []uint64{0, 10, 1000},
+			data: [][]byte{
+				{1, 2, 3, 0, 0, 0},
+				{4, 5, 6, 7, 0, 0},
+				{8, 0, 0, 0, 0, 0},
+			},
+		},
+		{
+			name: "capture length limited by wire length",
+			pkts: []testPacket{
+				{[]byte{1, 2}, 60, 100},
+			},
+			nReplays:           1,
+			captureMaxLen:      1518,
+			cyclesInterArrival: []uint64{0},
+			data: [][]byte{
+				append([]byte{1, 2}, make([]byte, 58)...),
+			},
+		},
+		{
+			name: "replays",
+			pkts: []testPacket{
+				{nil, 60, 7},
+				{nil, 60, 9},
+			},
+			nReplays:           2,
+			captureMaxLen:      0,
+			cyclesInterArrival: []uint64{0, 7, 9, 7},
+			data:               [][]byte{{}, {}, {}, {}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := buildTrace(t, test.pkts)
+			pkts, err := replay(t, cfg, data, test.nReplays,
+				test.captureMaxLen, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(pkts) != len(test.cyclesInterArrival) {
+				t.Fatalf("captured %d packets, expected %d", len(pkts),
+					len(test.cyclesInterArrival))
+			}
+			for i, pkt := range pkts {
+				cycles := pkt.ArrivalTime * gofluent10g.FREQ_SFP
+				if math.Abs(cycles-float64(test.cyclesInterArrival[i])) >
+					1e-6 {
+					t.Errorf("packet %d: inter-arrival time %g cycles, "+
+						"expected %d", i, cycles,
+						test.cyclesInterArrival[i])
+				}
+				if !bytes.Equal(pkt.Data, test.data[i]) {
+					t.Errorf("packet %d: data %v, expected %v", i, pkt.Data,
+						test.data[i])
+				}
+				// latency is quantized to the timestamp clock period
+				if math.Abs(pkt.Latency-cfg.Latency.Seconds()) >
+					0.5/gofluent10g.FREQ_SFP {
+					t.Errorf("packet %d: latency %g, expected %g", i,
+						pkt.Latency, cfg.Latency.Seconds())
+				}
+			}
+		})
+	}
+}
+
+func TestSimLoss(t *testing.T) {
+	pkts := make([]testPacket, 1000)
+	for i := range pkts {
+		pkts[i] = testPacket{nil, 60, 100}
+	}
+	data := buildTrace(t, pkts)
+
+	for _, lossRate := range []float64{0.0, 0.1, 1.0} {
+		cfg := SimConfigDefault()
+		cfg.LossRate = lossRate
+
+		captured, err := replay(t, cfg, data, 1, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lost := float64(len(pkts)-len(captured)) / float64(len(pkts))
+		if math.Abs(lost-lossRate) > 0.05 {
+			t.Errorf("loss rate %g: lost %g of the packets", lossRate, lost)
+		}
+	}
+}
+
+func TestSimCaptureMemory(t *testing.T) {
+	data := buildTrace(t, []testPacket{
+		{nil, 60, 100},
+		{nil, 1514, 100},
+	})
+
+	tests := []struct {
+		captureMaxLen  int
+		captureMemSize uint64
+		exhausted      bool
+	}{
+		// 8 bytes meta data + 64 bytes data for each packet
+		{64, 144, false},
+		{64, 143, true},
+		// first packet only occupies 8 + 64 bytes (60 bytes padded)
+		{1518, 8 + 64 + 8 + 1520, false},
+		{1518, 8 + 64 + 8 + 1519, true},
+		// meta data only
+		{0, 16, false},
+		{0, 15, true},
+	}
+
+	for _, test := range tests {
+		_, err := replay(t, SimConfigDefault(), data, 1, test.captureMaxLen,
+			test.captureMemSize)
+		if exhausted := err != nil; exhausted != test.exhausted {
+			t.Errorf("capture length %d, memory size %d: exhausted %v, "+
+				"expected %v", test.captureMaxLen, test.captureMemSize,
+				exhausted, test.exhausted)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		env   map[string]string
+		valid bool
+	}{
+		{map[string]string{BackendEnv: "sim"}, true},
+		{map[string]string{BackendEnv: "foo"}, false},
+		{map[string]string{BackendEnv: "sim",
+			"FLUENT10G_SIM_LATENCY": "1us"}, true},
+		{map[string]string{BackendEnv: "sim",
+			"FLUENT10G_SIM_LATENCY": "1"}, false},
+		{map[string]string{BackendEnv: "sim",
+			"FLUENT10G_SIM_LOSS": "x"}, false},
+		{map[string]string{BackendEnv: "sim",
+			"FLUENT10G_SIM_SEED": "1.5"}, false},
+	}
+
+	for _, test := range tests {
+		for key, value := range test.env {
+			os.Setenv(key, value)
+		}
+
+		nt, err := Create()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%v: valid %v, expected %v (%v)", test.env, valid,
+				test.valid, err)
+		}
+		if err == nil {
+			nt.Close()
+		}
+
+		for key := range test.env {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestSimConfigFromEnv(t *testing.T) {
+	os.Setenv("FLUENT10G_SIM_LATENCY", "2us")
+	os.Setenv("FLUENT10G_SIM_SEED", "42")
+	defer os.Unsetenv("FLUENT10G_SIM_LATENCY")
+	defer os.Unsetenv("FLUENT10G_SIM_SEED")
+
+	cfg, err := SimConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Latency != 2*time.Microsecond || cfg.Seed != 42 {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+	if cfg.LatencyJitter != SimConfigDefault().LatencyJitter {
+		t.Errorf("jitter %s overridden", cfg.LatencyJitter)
+	}
+}
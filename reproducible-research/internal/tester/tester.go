@@ -0,0 +1,139 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package tester abstracts the network tester the measurement programs talk
+// to. The default backend is the NetFPGA-SUME hardware accessed through
+// gofluent10g, a software model can be selected to run the programs on
+// machines without a network tester board.
+
+package tester
+
+import (
+	"fmt"
+	"github.com/aoeldemann/gofluent10g"
+	"os"
+)
+
+// BackendEnv is the environment variable selecting the network tester backend
+// ("hardware" or "sim")
+const BackendEnv = "FLUENT10G_BACKEND"
+
+// HardwareVersionEnv is the environment variable describing the bitstream
+// loaded onto the FPGA (e.g. the fluent10g commit it has been built from). It
+// is reported as hardware version if gofluent10g does not provide one.
+const HardwareVersionEnv = "FLUENT10G_HW_VERSION"
+
+// NetworkTester is the subset of the gofluent10g network tester API used by
+// the measurement programs
+type NetworkTester interface {
+	Close()
+
+	GetGenerator(id int) Generator
+	GetGenerators() Generators
+	GetReceiver(id int) Receiver
+	GetReceivers() Receivers
+	GetInterface(id int) Interface
+
+	SetTimestampMode(mode gofluent10g.TimestampMode)
+	SetTimestampPos(pos int)
+	SetTimestampWidth(width int)
+
+	SetCheckErrors(check bool)
+	CheckErrors() error
+
+	WriteConfig()
+	StartReplay()
+	StartCapture()
+	StopCapture()
+	FreeHostMemory()
+
+	// returns a description of the hardware/bitstream version
+	GetVersion() string
+}
+
+// Generator replays a trace on a network interface
+type Generator interface {
+	SetTrace(trace *gofluent10g.Trace)
+}
+
+// Generators is a slice of generators
+type Generators []Generator
+
+// Receiver captures packets arriving on a network interface
+type Receiver interface {
+	EnableCapture(enable bool)
+	SetCaptureMaxLen(maxLen int)
+	SetCaptureDiscard(discard bool)
+	SetCaptureHostMemSize(size uint64)
+	GetCapture() Capture
+	GetPacketCountCaptured() int
+}
+
+// Receivers is a slice of receivers
+type Receivers []Receiver
+
+// Capture holds the packets captured by a receiver
+type Capture interface {
+	GetPackets() gofluent10g.CapturePackets
+}
+
+// Interface provides the packet counters of a network interface
+type Interface interface {
+	GetPacketCountTX() int
+}
+
+// Create opens the network tester backend selected by the FLUENT10G_BACKEND
+// environment variable. If the variable is not set, the hardware is opened.
+func Create() (NetworkTester, error) {
+	switch backend := os.Getenv(BackendEnv); backend {
+	case "", "hardware":
+		return CreateHardware(), nil
+	case "sim":
+		cfg, err := SimConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return CreateSim(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown network tester backend '%s'",
+			backend)
+	}
+}
+
+// SetTraceData assigns trace to the generator gen like gen.SetTrace. buf is
+// the data in the hardware trace format the trace has been created from and
+// nReplays the number of times it is replayed. The hardware only needs the
+// trace, the simulated network tester decodes buf to model the inter-packet
+// times and the data of the replayed packets.
+func SetTraceData(gen Generator, trace *gofluent10g.Trace, buf []byte,
+	nReplays int) {
+	gen.SetTrace(trace)
+	if gen, ok := gen.(*simGenerator); ok {
+		gen.buf = buf
+		gen.nReplays = nReplays
+	}
+}
@@ -0,0 +1,178 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Builder assembles traces in the hardware trace format. Each packet consists
+// of an 8 byte meta data word (inter-packet clock cycles | capture length <<
+// 32 | wire length << 48, little endian) followed by the captured packet data
+// padded to 8 byte words. The trace is padded to a multiple of 64 bytes with
+// 0xFFFFFFFFFFFFFFFF words.
+
+package tracegen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// trace format limits
+const (
+	// maximum number of clock cycles between two packets
+	CyclesInterPacketMax = 4294967295
+
+	// minimum wire length of a packet (without FCS). MACs pad shorter
+	// frames
+	PktlenMin = 60
+
+	// maximum wire length (without FCS) and capture length of a packet: a
+	// maximum size ethernet frame with one VLAN tag
+	PktlenMax = 1518
+)
+
+// Builder assembles a trace packet by packet
+type Builder struct {
+	buf        []byte
+	numPackets int
+	cycles     uint64
+}
+
+// BuilderCreate creates an empty trace builder
+func BuilderCreate() *Builder {
+	return &Builder{}
+}
+
+// PacketSize returns the number of trace bytes occupied by a packet with a
+// capture length of captureLen bytes (meta data + padded packet data)
+func PacketSize(captureLen int) int {
+	return 8 + 8*((captureLen+7)/8)
+}
+
+// Reserve allocates trace memory for nPkts further packets with a capture
+// length of captureLen bytes, so that large traces are not reallocated while
+// they are built
+func (b *Builder) Reserve(nPkts, captureLen int) {
+	size := len(b.buf) + nPkts*PacketSize(captureLen) + 64
+	if size > cap(b.buf) {
+		buf := make([]byte, len(b.buf), size)
+		copy(buf, b.buf)
+		b.buf = buf
+	}
+}
+
+// AddPacket appends a packet to the trace. data are the first bytes of the
+// packet that are transferred to the hardware (the capture length is
+// len(data)), the hardware appends zero bytes up to the wire length wireLen
+// (without FCS) before transmission. gapCycles is the number of clock cycles
+// between the start of this packet and the start of the next packet.
+func (b *Builder) AddPacket(data []byte, wireLen int, gapCycles uint64) error {
+	if wireLen < PktlenMin || wireLen > PktlenMax {
+		return fmt.Errorf("packet %d: wire length %d out of range (%d-%d)",
+			b.numPackets, wireLen, PktlenMin, PktlenMax)
+	}
+	if len(data) > wireLen {
+		return fmt.Errorf("packet %d: capture length %d exceeds wire "+
+			"length %d", b.numPackets, len(data), wireLen)
+	}
+	if gapCycles > CyclesInterPacketMax {
+		return fmt.Errorf("packet %d: %d inter-packet clock cycles exceed "+
+			"hardware limit of %d", b.numPackets, gapCycles,
+			uint64(CyclesInterPacketMax))
+	}
+
+	// assemble and write meta data
+	meta := gapCycles
+	meta |= uint64(len(data)) << 32
+	meta |= uint64(wireLen) << 48
+
+	// the decoder would take the packet for the padding at the end of the
+	// trace. cannot happen within the wire length limits
+	if meta == metaPadding {
+		return fmt.Errorf("packet %d: meta data matches trace padding",
+			b.numPackets)
+	}
+
+	addr := len(b.buf)
+	b.buf = append(b.buf, make([]byte, PacketSize(len(data)))...)
+	binary.LittleEndian.PutUint64(b.buf[addr:addr+8], meta)
+
+	// write packet data (padding bytes stay zero)
+	copy(b.buf[addr+8:], data)
+
+	b.numPackets++
+	b.cycles += gapCycles
+
+	return nil
+}
+
+// AddPackets appends all packets produced by src to the trace
+func (b *Builder) AddPackets(src PacketSource) error {
+	for {
+		data, wireLen, gapCycles, err := src.NextPacket()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := b.AddPacket(data, wireLen, gapCycles); err != nil {
+			return err
+		}
+	}
+}
+
+// NumPackets returns the number of packets added so far
+func (b *Builder) NumPackets() int {
+	return b.numPackets
+}
+
+// Duration returns the replay duration of the packets added so far
+func (b *Builder) Duration() time.Duration {
+	return cyclesDuration(b.cycles)
+}
+
+// Finish adds the padding for 64 byte alignment and returns the trace. The
+// builder must not be used afterwards.
+func (b *Builder) Finish() *Data {
+	b.pad()
+
+	data := &Data{
+		Buf:        b.buf,
+		NumPackets: b.numPackets,
+		Duration:   b.Duration(),
+	}
+	b.buf = nil
+
+	return data
+}
+
+// pads the trace data with 0xFFFFFFFFFFFFFFFF words to a multiple of 64 bytes
+func (b *Builder) pad() {
+	for len(b.buf)%64 != 0 {
+		b.buf = append(b.buf, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+}
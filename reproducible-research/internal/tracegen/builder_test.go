@@ -0,0 +1,213 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the trace builder and decoder.
+
+package tracegen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// packet added to a trace
+type testPacket struct {
+	data      []byte
+	wireLen   int
+	gapCycles uint64
+}
+
+// returns n bytes of packet data with the given first byte
+func testData(n int, first byte) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = first + byte(i)
+	}
+	return data
+}
+
+// builds a trace of pkts
+func buildTrace(t *testing.T, pkts []testPacket) *Data {
+	b := BuilderCreate()
+	for _, pkt := range pkts {
+		err := b.AddPacket(pkt.data, pkt.wireLen, pkt.gapCycles)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Finish()
+}
+
+func TestBuilderDecoder(t *testing.T) {
+	tests := []struct {
+		name string
+		pkts []testPacket
+
+		// size of the trace data including padding
+		size int
+	}{
+		{"meta data only", []testPacket{
+			{nil, PktlenMin, 0},
+		}, 64},
+		{"exactly 64 bytes", []testPacket{
+			{testData(56, 1), 1000, 200},
+		}, 64},
+		{"unaligned capture length", []testPacket{
+			{testData(34, 1), 60, 10},
+			{testData(1, 2), 1518, 1},
+			{testData(60, 3), 60, 0},
+		}, 192},
+		{"limits", []testPacket{
+			{testData(PktlenMax, 4), PktlenMax, CyclesInterPacketMax},
+			{nil, PktlenMin, CyclesInterPacketMax},
+		}, 1536},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := buildTrace(t, test.pkts)
+			if len(data.Buf) != test.size {
+				t.Fatalf("trace size %d, expected %d", len(data.Buf),
+					test.size)
+			}
+			if data.NumPackets != len(test.pkts) {
+				t.Errorf("%d packets, expected %d", data.NumPackets,
+					len(test.pkts))
+			}
+
+			var cycles uint64
+			d := DecoderCreate(data.Buf)
+			for i, expected := range test.pkts {
+				pkt, err := d.Next()
+				if err != nil {
+					t.Fatalf("packet %d: %s", i, err.Error())
+				}
+				if pkt.CaptureLen != len(expected.data) ||
+					!bytes.Equal(pkt.Data, expected.data) {
+					t.Errorf("packet %d: data differs", i)
+				}
+				if pkt.WireLen != expected.wireLen {
+					t.Errorf("packet %d: wire length %d, expected %d", i,
+						pkt.WireLen, expected.wireLen)
+				}
+				if pkt.CyclesInterPacket != expected.gapCycles {
+					t.Errorf("packet %d: %d inter-packet clock cycles, "+
+						"expected %d", i, pkt.CyclesInterPacket,
+						expected.gapCycles)
+				}
+				cycles += expected.gapCycles
+			}
+			if _, err := d.Next(); err != io.EOF {
+				t.Errorf("expected end of trace, got %v", err)
+			}
+
+			// the rest of the trace is padding
+			for offset := d.Offset(); offset < len(data.Buf); offset += 8 {
+				word := binary.LittleEndian.Uint64(data.Buf[offset:])
+				if word != metaPadding {
+					t.Errorf("invalid padding %016x at offset %d", word,
+						offset)
+				}
+			}
+
+			if data.Duration != cyclesDuration(cycles) {
+				t.Errorf("duration %s, expected %s", data.Duration,
+					cyclesDuration(cycles))
+			}
+
+			decoded, err := Decode(data.Buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.NumPackets != data.NumPackets ||
+				decoded.Duration != data.Duration {
+				t.Errorf("decoded %d packets (%s), expected %d (%s)",
+					decoded.NumPackets, decoded.Duration, data.NumPackets,
+					data.Duration)
+			}
+		})
+	}
+}
+
+func TestBuilderLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  testPacket
+		ok   bool
+	}{
+		{"minimum wire length", testPacket{nil, PktlenMin, 0}, true},
+		{"wire length too short", testPacket{nil, PktlenMin - 1, 0}, false},
+		{"zero wire length", testPacket{nil, 0, 0}, false},
+		{"maximum wire length", testPacket{nil, PktlenMax, 0}, true},
+		{"wire length too long", testPacket{nil, PktlenMax + 1, 0}, false},
+		{"capture length equals wire length",
+			testPacket{testData(64, 0), 64, 0}, true},
+		{"capture length exceeds wire length",
+			testPacket{testData(65, 0), 64, 0}, false},
+		{"maximum gap", testPacket{nil, 64, CyclesInterPacketMax}, true},
+		{"gap too long", testPacket{nil, 64, CyclesInterPacketMax + 1},
+			false},
+	}
+
+	for _, test := range tests {
+		b := BuilderCreate()
+		err := b.AddPacket(test.pkt.data, test.pkt.wireLen,
+			test.pkt.gapCycles)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: error %v, expected success %v", test.name, err,
+				test.ok)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	meta := func(gapCycles uint64, captureLen, wireLen int) []byte {
+		buf := make([]byte, 64)
+		binary.LittleEndian.PutUint64(buf, gapCycles|
+			uint64(captureLen)<<32|uint64(wireLen)<<48)
+		return buf
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"truncated meta data", []byte{1, 2, 3}},
+		{"wire length too short", meta(0, 0, PktlenMin-1)},
+		{"wire length too long", meta(0, 0, PktlenMax+1)},
+		{"capture length exceeds wire length", meta(0, 61, 60)},
+		{"truncated packet data", meta(0, 60, 60)},
+	}
+
+	for _, test := range tests {
+		if _, err := Decode(test.buf); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
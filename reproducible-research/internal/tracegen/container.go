@@ -0,0 +1,423 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Trace container files. A container holds the trace data in the hardware
+// trace format together with a header describing the trace (number of
+// packets, duration, replay count, seed, generator parameters and checksum),
+// so that a trace can be generated once, archived and replayed identically
+// later on.
+//
+// All integers are little-endian. The header is padded to a multiple of 4096
+// bytes, so that the trace data can be memory-mapped:
+//
+//	offset  size  field
+//	     0     8  magic "FL10GTRC"
+//	     8     4  format version (1)
+//	    12     4  header size in bytes (offset of the trace data)
+//	    16     8  number of packets
+//	    24     8  replay duration of a single replay in ns
+//	    32     4  replay count
+//	    36     4  size of the generator parameters in bytes
+//	    40     8  seed
+//	    48     8  size of the trace data in bytes
+//	    56    32  SHA-256 hash of the trace data
+//	    88     n  generator parameters (JSON object)
+
+package tracegen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ContainerVersion is the version of the trace container format
+const ContainerVersion = 1
+
+const (
+	containerMagic      = "FL10GTRC"
+	containerFixedSize  = 88
+	containerHeaderSize = 4096
+)
+
+// Meta holds the meta data of a trace stored in a container file
+type Meta struct {
+	// number of times the trace is replayed (default: 1)
+	ReplayCount int
+
+	// seed the trace has been generated with
+	Seed int64
+
+	// parameters of the trace generator
+	Params map[string]interface{}
+
+	// SHA-256 hash of the trace data as hex string, set when loading a
+	// container
+	Checksum string
+}
+
+// Verify returns an error if the checksum of data does not match the
+// checksum stored in the container
+func (meta *Meta) Verify(data *Data) error {
+	if checksum := data.Checksum(); checksum != meta.Checksum {
+		return fmt.Errorf("trace checksum mismatch: expected %s, got %s",
+			meta.Checksum, checksum)
+	}
+	return nil
+}
+
+// container header
+type containerHeader struct {
+	size        int
+	numPackets  int
+	duration    time.Duration
+	replayCount int
+	seed        int64
+	dataSize    uint64
+	checksum    [sha256.Size]byte
+	params      map[string]interface{}
+}
+
+// encodes the header, padded to a multiple of containerHeaderSize bytes
+func (hdr *containerHeader) encode() ([]byte, error) {
+	params := []byte("{}")
+	if hdr.params != nil {
+		var err error
+		params, err = json.Marshal(hdr.params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := containerHeaderSize *
+		((containerFixedSize + len(params) + containerHeaderSize - 1) /
+			containerHeaderSize)
+	buf := make([]byte, size)
+
+	copy(buf[0:8], containerMagic)
+	binary.LittleEndian.PutUint32(buf[8:12], ContainerVersion)
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(size))
+	binary.LittleEndian.PutUint64(buf[16:24], uint64(hdr.numPackets))
+	binary.LittleEndian.PutUint64(buf[24:32], uint64(hdr.duration))
+	binary.LittleEndian.PutUint32(buf[32:36], uint32(hdr.replayCount))
+	binary.LittleEndian.PutUint32(buf[36:40], uint32(len(params)))
+	binary.LittleEndian.PutUint64(buf[40:48], uint64(hdr.seed))
+	binary.LittleEndian.PutUint64(buf[48:56], hdr.dataSize)
+	copy(buf[56:88], hdr.checksum[:])
+	copy(buf[88:], params)
+
+	return buf, nil
+}
+
+// reads the header from r. afterwards, r is positioned at the start of the
+// trace data
+func readContainerHeader(r io.Reader) (*containerHeader, error) {
+	buf := make([]byte, containerFixedSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("could not read container header: %s",
+			err.Error())
+	}
+
+	if string(buf[0:8]) != containerMagic {
+		return nil, errors.New("not a trace container file")
+	}
+	if version := binary.LittleEndian.Uint32(buf[8:12]); version !=
+		ContainerVersion {
+		return nil, fmt.Errorf("unsupported trace container version %d",
+			version)
+	}
+
+	hdr := &containerHeader{
+		size:        int(binary.LittleEndian.Uint32(buf[12:16])),
+		numPackets:  int(binary.LittleEndian.Uint64(buf[16:24])),
+		duration:    time.Duration(binary.LittleEndian.Uint64(buf[24:32])),
+		replayCount: int(binary.LittleEndian.Uint32(buf[32:36])),
+		seed:        int64(binary.LittleEndian.Uint64(buf[40:48])),
+		dataSize:    binary.LittleEndian.Uint64(buf[48:56]),
+	}
+	copy(hdr.checksum[:], buf[56:88])
+	paramsLen := int(binary.LittleEndian.Uint32(buf[36:40]))
+
+	if hdr.size%containerHeaderSize != 0 ||
+		containerFixedSize+paramsLen > hdr.size {
+		return nil, fmt.Errorf("invalid container header size %d", hdr.size)
+	}
+	if hdr.dataSize%64 != 0 {
+		return nil, fmt.Errorf("invalid trace data size %d", hdr.dataSize)
+	}
+
+	rest := make([]byte, hdr.size-containerFixedSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("could not read container header: %s",
+			err.Error())
+	}
+	if err := json.Unmarshal(rest[:paramsLen], &hdr.params); err != nil {
+		return nil, fmt.Errorf("invalid generator parameters: %s",
+			err.Error())
+	}
+
+	return hdr, nil
+}
+
+// returns the meta data stored in the header
+func (hdr *containerHeader) meta() *Meta {
+	replayCount := hdr.replayCount
+	if replayCount == 0 {
+		replayCount = 1
+	}
+	return &Meta{
+		ReplayCount: replayCount,
+		Seed:        hdr.seed,
+		Params:      hdr.params,
+		Checksum:    hex.EncodeToString(hdr.checksum[:]),
+	}
+}
+
+// returns true if buf starts with the magic of a container file. Raw trace
+// data can never start with the magic, its capture length would exceed its
+// wire length
+func isContainer(buf []byte) bool {
+	return len(buf) >= len(containerMagic) &&
+		string(buf[0:len(containerMagic)]) == containerMagic
+}
+
+// IsContainerFile returns true if the file is a trace container file and false
+// if it holds raw trace data
+func IsContainerFile(filename string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, len(containerMagic))
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return isContainer(buf[:n]), nil
+}
+
+// Save writes the trace data and its meta data to a container file
+func (data *Data) Save(filename string, meta Meta) error {
+	hdr := &containerHeader{
+		numPackets:  data.NumPackets,
+		duration:    data.Duration,
+		replayCount: meta.ReplayCount,
+		seed:        meta.Seed,
+		dataSize:    uint64(len(data.Buf)),
+		checksum:    sha256.Sum256(data.Buf),
+		params:      meta.Params,
+	}
+	buf, err := hdr.encode()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(buf)
+	if err == nil {
+		_, err = file.Write(data.Buf)
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// SaveStream writes all remaining chunks of the stream s and the meta data to
+// a container file. The trace data is never held in memory completely. It
+// returns the size of the trace data.
+func SaveStream(filename string, s *Stream, meta Meta) (int64, error) {
+	hdr := &containerHeader{
+		replayCount: meta.ReplayCount,
+		seed:        meta.Seed,
+		params:      meta.Params,
+	}
+
+	// header is written again when the trace data is complete, its size does
+	// not change
+	buf, err := hdr.encode()
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	_, err = file.Write(buf)
+	if err == nil {
+		n, err = s.WriteTo(file)
+	}
+	if err == nil {
+		hdr.numPackets = s.NumPackets()
+		hdr.duration = s.Duration()
+		hdr.dataSize = uint64(n)
+		copy(hdr.checksum[:], s.hash.Sum(nil))
+		buf, err = hdr.encode()
+	}
+	if err == nil {
+		_, err = file.WriteAt(buf, 0)
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return n, err
+}
+
+// Load reads a container file into memory and verifies the checksum of the
+// trace data
+func Load(filename string) (*Data, *Meta, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	hdr, err := readContainerHeader(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	buf := make([]byte, hdr.dataSize)
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return nil, nil, fmt.Errorf("%s: could not read trace data: %s",
+			filename, err.Error())
+	}
+
+	data := &Data{
+		Buf:        buf,
+		NumPackets: hdr.numPackets,
+		Duration:   hdr.duration,
+	}
+	meta := hdr.meta()
+	if err := meta.Verify(data); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	return data, meta, nil
+}
+
+// MappedTrace is a trace memory-mapped from a container file
+type MappedTrace struct {
+	Data *Data
+	Meta *Meta
+
+	// releases the mapping
+	unmap func() error
+}
+
+// Close releases the memory mapping. The trace data must not be used
+// afterwards.
+func (t *MappedTrace) Close() error {
+	if t.unmap == nil {
+		return nil
+	}
+	err := t.unmap()
+	t.unmap = nil
+	return err
+}
+
+// LoadMmap maps the trace data of a container file into memory instead of
+// reading it, so that traces larger than the page cache can be loaded quickly.
+// The mapping is private: the trace data may be modified, changes are not
+// written back to the file. The checksum is not verified (see Meta.Verify).
+// On platforms without mmap support, the file is read with Load.
+func LoadMmap(filename string) (*MappedTrace, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hdr, err := readContainerHeader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	if info, err := file.Stat(); err != nil {
+		return nil, err
+	} else if uint64(info.Size()) < uint64(hdr.size)+hdr.dataSize {
+		return nil, fmt.Errorf("%s: truncated trace data", filename)
+	}
+
+	buf, unmap, err := mmapFile(file, int64(hdr.size), int(hdr.dataSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	return &MappedTrace{
+		Data: &Data{
+			Buf:        buf,
+			NumPackets: hdr.numPackets,
+			Duration:   hdr.duration,
+		},
+		Meta:  hdr.meta(),
+		unmap: unmap,
+	}, nil
+}
+
+// returns the trace data stored in buf, which holds either a container file
+// or raw trace data
+func decodeFile(buf []byte) (*Data, error) {
+	if !isContainer(buf) {
+		return Decode(buf)
+	}
+
+	r := bytes.NewReader(buf)
+	hdr, err := readContainerHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(r.Len()) < hdr.dataSize {
+		return nil, errors.New("truncated trace data")
+	}
+
+	data := &Data{
+		Buf:        buf[hdr.size : uint64(hdr.size)+hdr.dataSize],
+		NumPackets: hdr.numPackets,
+		Duration:   hdr.duration,
+	}
+	if err := hdr.meta().Verify(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
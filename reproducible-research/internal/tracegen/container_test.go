@@ -0,0 +1,249 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of trace container files.
+
+package tracegen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracegen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	traffic := Traffic{
+		Datarate:   5e9,
+		CaptureLen: 34,
+		Duration:   time.Millisecond,
+	}
+	data, err := Generate(GenTraffic(traffic), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		meta Meta
+
+		// replay count expected after loading
+		replayCount int
+	}{
+		{"no parameters", Meta{Seed: 3}, 1},
+		{"parameters", Meta{
+			ReplayCount: 5,
+			Seed:        -3,
+			Params: map[string]interface{}{
+				"datarate_mean": 5e9,
+				"pktlen_dist":   "imix",
+			},
+		}, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(dir, "trace.bin")
+			if err := data.Save(filename, test.meta); err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(name string, loaded *Data, meta *Meta) {
+				if !bytes.Equal(loaded.Buf, data.Buf) ||
+					loaded.NumPackets != data.NumPackets ||
+					loaded.Duration != data.Duration {
+					t.Errorf("%s: trace differs", name)
+				}
+				if meta.ReplayCount != test.replayCount ||
+					meta.Seed != test.meta.Seed ||
+					meta.Checksum != data.Checksum() {
+					t.Errorf("%s: meta data differs: %+v", name, meta)
+				}
+				if test.meta.Params != nil &&
+					!reflect.DeepEqual(meta.Params, test.meta.Params) {
+					t.Errorf("%s: parameters differ: %v", name,
+						meta.Params)
+				}
+			}
+
+			loaded, meta, err := Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("Load", loaded, meta)
+
+			mapped, err := LoadMmap(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mapped.Meta.Verify(mapped.Data); err != nil {
+				t.Error(err)
+			}
+			check("LoadMmap", mapped.Data, mapped.Meta)
+			if err := mapped.Close(); err != nil {
+				t.Error(err)
+			}
+
+			read, err := ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("ReadFile", read, meta)
+
+			// a streamed trace results in the same file
+			src, err := StreamTraffic(rand.New(rand.NewSource(3)), traffic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filenameStream := filepath.Join(dir, "trace_stream.bin")
+			_, err = SaveStream(filenameStream, StreamCreate(src, 4096),
+				test.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, _ := ioutil.ReadFile(filename)
+			bufStream, _ := ioutil.ReadFile(filenameStream)
+			if !bytes.Equal(buf, bufStream) {
+				t.Error("streamed container file differs")
+			}
+		})
+	}
+}
+
+func TestContainerMmapPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracegen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := buildTrace(t, []testPacket{
+		{testData(60, 1), 60, 10},
+		{testData(34, 2), 1518, 20},
+	})
+	filename := filepath.Join(dir, "trace.bin")
+	if err := data.Save(filename, Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := LoadMmap(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	// writes to the mapping are neither visible in the file nor in other
+	// mappings of the file
+	for i := range mapped.Data.Buf {
+		mapped.Data.Buf[i] = 0xAB
+	}
+	mappedOther, err := LoadMmap(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mappedOther.Close()
+	if !bytes.Equal(mappedOther.Data.Buf, data.Buf) {
+		t.Error("write to mapping visible in other mapping")
+	}
+	if err := mapped.Close(); err != nil {
+		t.Error(err)
+	}
+
+	written, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, file) {
+		t.Error("write to mapping changed the file")
+	}
+}
+
+func TestContainerCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracegen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := buildTrace(t, []testPacket{{testData(34, 1), 60, 100}})
+	filename := filepath.Join(dir, "trace.bin")
+	if err := data.Save(filename, Meta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a bit of the trace data
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[containerHeaderSize+8] ^= 1
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Load(filename); err == nil {
+		t.Error("Load: checksum mismatch not detected")
+	}
+	if _, err := ReadFile(filename); err == nil {
+		t.Error("ReadFile: checksum mismatch not detected")
+	}
+
+	mapped, err := LoadMmap(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	if err := mapped.Meta.Verify(mapped.Data); err == nil {
+		t.Error("LoadMmap: checksum mismatch not detected")
+	}
+
+	// truncated trace data
+	err = ioutil.WriteFile(filename, buf[:len(buf)-64], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(filename); err == nil {
+		t.Error("Load: truncated trace data not detected")
+	}
+	if _, err := LoadMmap(filename); err == nil {
+		t.Error("LoadMmap: truncated trace data not detected")
+	}
+}
@@ -0,0 +1,168 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Decoder walks traces in the hardware trace format packet by packet (see
+// builder.go for the format), e.g. to inspect traces saved to disk.
+
+package tracegen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// meta data word marking the padding at the end of the trace
+const metaPadding = 0xFFFFFFFFFFFFFFFF
+
+// Packet is a decoded trace packet
+type Packet struct {
+	// number of clock cycles between the start of this packet and the start
+	// of the next packet
+	CyclesInterPacket uint64
+
+	// number of packet data bytes stored in the trace
+	CaptureLen int
+
+	// length of the packet on the wire (without FCS)
+	WireLen int
+
+	// packet data stored in the trace (CaptureLen bytes)
+	Data []byte
+}
+
+// TimeInterPacket returns the time between the start of this packet and the
+// start of the next packet
+func (pkt *Packet) TimeInterPacket() time.Duration {
+	return cyclesDuration(pkt.CyclesInterPacket)
+}
+
+// Decoder decodes a trace packet by packet
+type Decoder struct {
+	buf    []byte
+	offset int
+	index  int
+}
+
+// DecoderCreate creates a decoder for the trace data buf
+func DecoderCreate(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// Next returns the next packet of the trace. It returns io.EOF when the end of
+// the trace or the padding at the end of the trace is reached. The packet
+// data references the trace data, it is not copied.
+func (d *Decoder) Next() (*Packet, error) {
+	if d.offset+8 > len(d.buf) {
+		if d.offset != len(d.buf) {
+			return nil, fmt.Errorf("packet %d: truncated meta data at "+
+				"offset %d", d.index, d.offset)
+		}
+		return nil, io.EOF
+	}
+
+	meta := binary.LittleEndian.Uint64(d.buf[d.offset : d.offset+8])
+	if meta == metaPadding {
+		return nil, io.EOF
+	}
+
+	pkt := &Packet{
+		CyclesInterPacket: meta & 0xFFFFFFFF,
+		CaptureLen:        int((meta >> 32) & 0xFFFF),
+		WireLen:           int(meta >> 48),
+	}
+
+	if pkt.WireLen < PktlenMin || pkt.WireLen > PktlenMax {
+		return nil, fmt.Errorf("packet %d: wire length %d out of range "+
+			"(%d-%d) at offset %d", d.index, pkt.WireLen, PktlenMin,
+			PktlenMax, d.offset)
+	}
+	if pkt.CaptureLen > pkt.WireLen {
+		return nil, fmt.Errorf("packet %d: capture length %d exceeds wire "+
+			"length %d at offset %d", d.index, pkt.CaptureLen, pkt.WireLen,
+			d.offset)
+	}
+
+	size := PacketSize(pkt.CaptureLen)
+	if d.offset+size > len(d.buf) {
+		return nil, fmt.Errorf("packet %d: truncated packet data at "+
+			"offset %d", d.index, d.offset)
+	}
+	pkt.Data = d.buf[d.offset+8 : d.offset+8+pkt.CaptureLen]
+
+	d.offset += size
+	d.index++
+
+	return pkt, nil
+}
+
+// Offset returns the offset of the next packet in the trace data. After Next
+// returned io.EOF, it is the size of the trace data without padding.
+func (d *Decoder) Offset() int {
+	return d.offset
+}
+
+// Decode decodes the trace data buf and returns the trace with its number of
+// packets and replay duration
+func Decode(buf []byte) (*Data, error) {
+	var cycles uint64
+	nPkts := 0
+
+	d := DecoderCreate(buf)
+	for {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		cycles += pkt.CyclesInterPacket
+		nPkts++
+	}
+
+	return &Data{
+		Buf:        buf,
+		NumPackets: nPkts,
+		Duration:   cyclesDuration(cycles),
+	}, nil
+}
+
+// ReadFile reads and decodes trace data saved with WriteFile or Save
+func ReadFile(filename string) (*Data, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFile(buf)
+}
+
+// WriteFile saves the trace data to a file
+func (data *Data) WriteFile(filename string) error {
+	return ioutil.WriteFile(filename, data.Buf, 0644)
+}
@@ -0,0 +1,327 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Multi-flow traces. The packets of several random flows, each with its own
+// data rate, packet size distribution, gap model, headers and start/stop
+// time, are merged into one time-ordered trace.
+
+package tracegen
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/aoeldemann/gofluent10g"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Flow is a flow of a multi-flow trace
+type Flow struct {
+	// name of the flow, used in statistics
+	Name string
+
+	// traffic of the flow. The duration of the traffic is ignored, it is
+	// derived from Start and Stop.
+	Traffic Traffic
+
+	// time the flow starts and stops sending, relative to the start of the
+	// trace. If Stop is zero, the flow sends until the end of the trace
+	Start time.Duration
+	Stop  time.Duration
+}
+
+// FlowStats holds the expected packet counts of a flow of a multi-flow trace
+type FlowStats struct {
+	Name string `json:"name"`
+
+	// flow ID of the sequence tags of the flow, if the flow is tagged
+	FlowID *uint32 `json:"flow_id,omitempty"`
+
+	// number of packets of the flow in the trace
+	NumPackets int `json:"packets"`
+
+	// number of bytes of the flow on the wire (including FCS)
+	BytesWire uint64 `json:"bytes_wire"`
+
+	// number of packets sent later than scheduled, because a packet of
+	// another flow was transmitted at the same time
+	NumDelayed int `json:"delayed"`
+}
+
+// FlowSource merges the packets of multiple flows into one time-ordered
+// packet source. Departure times are tracked in clock cycles, when packets
+// of two flows overlap, the later packet is delayed until the earlier packet
+// has been transmitted at line rate.
+type FlowSource struct {
+	// flows that still have packets, ordered by the departure time of their
+	// next packet
+	pending flowHeap
+
+	stats []FlowStats
+
+	// packet returned by the next call of NextPacket and its departure time
+	// in clock cycles since the start of the trace
+	cur    *flowState
+	curDep float64
+	curLen int
+
+	// packet data of the current packet. Two buffers are used alternately,
+	// because returned data must stay valid until the next call
+	bufs [2][]byte
+	nBuf int
+	data []byte
+
+	rounder CycleRounder
+
+	// number of inter-packet times cut to the hardware limit of 2**32-1
+	// clock cycles
+	numGapsCapped int
+}
+
+// state of a single flow
+type flowState struct {
+	idx int
+	src *randomSource
+
+	// next packet of the flow, its scheduled departure time in clock cycles
+	// since the start of the trace and the number of clock cycles until the
+	// flow's following packet
+	data      []byte
+	wireLen   int
+	t         float64
+	gapCycles uint64
+}
+
+// advances the flow to its next packet. returns false if the flow has no
+// packets left
+func (f *flowState) advance() (bool, error) {
+	data, wireLen, gapCycles, err := f.src.NextPacket()
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	f.t += float64(f.gapCycles)
+	f.data = data
+	f.wireLen = wireLen
+	f.gapCycles = gapCycles
+	return true, nil
+}
+
+type flowHeap []*flowState
+
+func (h flowHeap) Len() int { return len(h) }
+
+func (h flowHeap) Less(i, j int) bool {
+	if h[i].t == h[j].t {
+		return h[i].idx < h[j].idx
+	}
+	return h[i].t < h[j].t
+}
+
+func (h flowHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *flowHeap) Push(x interface{}) { *h = append(*h, x.(*flowState)) }
+
+func (h *flowHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
+
+// FlowSourceCreate creates a packet source merging the packets of flows. The
+// trace has a duration of duration. Each flow draws its random numbers from a
+// private random number generator seeded from rnd.
+func FlowSourceCreate(rnd *rand.Rand, flows []Flow,
+	duration time.Duration) (*FlowSource, error) {
+	if len(flows) == 0 {
+		return nil, errors.New("no flows specified")
+	}
+
+	s := &FlowSource{
+		stats: make([]FlowStats, len(flows)),
+	}
+	for i := range s.bufs {
+		s.bufs[i] = make([]byte, 0, PktlenMax)
+	}
+
+	for i, flow := range flows {
+		s.stats[i].Name = flow.Name
+		if flow.Traffic.SeqTag != nil {
+			flowID := flow.Traffic.SeqTag.FlowID
+			s.stats[i].FlowID = &flowID
+		}
+
+		stop := flow.Stop
+		if stop == 0 {
+			stop = duration
+		}
+		if flow.Start < 0 || stop <= flow.Start || stop > duration {
+			return nil, fmt.Errorf("invalid start (%s) or stop (%s) time of "+
+				"flow '%s'", flow.Start, flow.Stop, flow.Name)
+		}
+
+		t := flow.Traffic
+		t.Duration = stop - flow.Start
+		src, err := newRandomSource(rand.New(rand.NewSource(rnd.Int63())), t)
+		if err != nil {
+			return nil, fmt.Errorf("flow '%s': %s", flow.Name, err.Error())
+		}
+
+		f := &flowState{
+			idx: i,
+			src: src,
+			t:   flow.Start.Seconds() * gofluent10g.FREQ_SFP,
+		}
+		ok, err := f.advance()
+		if err != nil {
+			return nil, fmt.Errorf("flow '%s': %s", flow.Name, err.Error())
+		}
+		if ok {
+			s.pending = append(s.pending, f)
+		}
+	}
+	heap.Init(&s.pending)
+
+	if err := s.pop(0.0); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// removes the packet with the earliest departure time from the pending flows
+// and makes it the current packet. the packet departs at its scheduled time,
+// but not before tEarliest (in clock cycles)
+func (s *FlowSource) pop(tEarliest float64) error {
+	if len(s.pending) == 0 {
+		s.cur = nil
+		return nil
+	}
+
+	f := s.pending[0]
+	s.cur = f
+
+	s.curDep = f.t
+	if s.curDep < tEarliest {
+		s.curDep = tEarliest
+		s.stats[f.idx].NumDelayed++
+	}
+
+	s.stats[f.idx].NumPackets++
+	s.stats[f.idx].BytesWire += uint64(f.wireLen + 4)
+
+	// copy packet data, the flow's packet source overwrites it when
+	// advancing
+	s.nBuf = (s.nBuf + 1) % 2
+	s.data = append(s.bufs[s.nBuf][:0], f.data...)
+	s.curLen = f.wireLen
+
+	// the flow's last gap is kept for the last packet of the trace
+	gapCycles := f.gapCycles
+
+	ok, err := f.advance()
+	if err != nil {
+		return fmt.Errorf("flow '%s': %s", s.stats[f.idx].Name, err.Error())
+	}
+	if ok {
+		heap.Fix(&s.pending, 0)
+	} else {
+		heap.Pop(&s.pending)
+		f.gapCycles = gapCycles
+	}
+
+	return nil
+}
+
+// NextPacket returns the next packet of the merged trace (see PacketSource)
+func (s *FlowSource) NextPacket() ([]byte, int, uint64, error) {
+	if s.cur == nil {
+		return nil, 0, 0, io.EOF
+	}
+
+	data, wireLen, dep := s.data, s.curLen, s.curDep
+	last := s.cur
+
+	// the next packet cannot depart before this packet has been transmitted
+	// at line rate
+	if err := s.pop(dep + tTransfer(wireLen)*gofluent10g.FREQ_SFP); err != nil {
+		return nil, 0, 0, err
+	}
+
+	// last packet of the trace keeps the gap of its flow
+	cycles := float64(last.gapCycles)
+	if s.cur != nil {
+		cycles = s.curDep - dep
+	}
+
+	// hardware does not support inter-packet times larger than 2**32-1
+	// clock cycles, so cut if necessary
+	if cycles > CyclesInterPacketMax {
+		s.numGapsCapped++
+		cycles = CyclesInterPacketMax
+	}
+
+	return data, wireLen, s.rounder.Round(cycles), nil
+}
+
+// Stats returns the statistics of all flows of the packets returned so far
+func (s *FlowSource) Stats() []FlowStats {
+	return s.stats
+}
+
+// NumGapsCapped returns the number of inter-packet times cut to the hardware
+// limit of 2**32-1 clock cycles so far
+func (s *FlowSource) NumGapsCapped() int {
+	return s.numGapsCapped
+}
+
+// GenFlows returns a generator merging the packets of flows into a trace of
+// the given duration (see FlowSourceCreate). The statistics of the flows are
+// returned with the trace. The generator returns an error if a flow is
+// invalid.
+func GenFlows(flows []Flow, duration time.Duration) Generator {
+	return func(rnd *rand.Rand) (*Data, error) {
+		src, err := FlowSourceCreate(rnd, flows, duration)
+		if err != nil {
+			return nil, err
+		}
+
+		b := BuilderCreate()
+		if err := b.AddPackets(src); err != nil {
+			return nil, err
+		}
+
+		data := b.Finish()
+		data.Flows = src.Stats()
+		return data, nil
+	}
+}
@@ -0,0 +1,618 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Inter-packet gap models: exponential (Poisson traffic), heavy-tailed
+// Pareto, on/off bursts, Markov-modulated Poisson and periodic microbursts.
+// All models are scaled to the mean gap required to hit the target data rate.
+
+package tracegen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GapModel describes the distribution of the gaps between the end of a packet
+// and the start of the next packet
+type GapModel interface {
+	// checks the parameters of the model that do not depend on the data
+	// rate
+	validate() error
+
+	// returns a sampler drawing gaps with a mean of tGapMean seconds.
+	// tTransferMean is the mean transfer time of a packet at line rate
+	sampler(tGapMean, tTransferMean float64) (gapSampler, error)
+
+	// String returns the model in the format accepted by ParseGapModel
+	String() string
+}
+
+// draws the gaps of a trace one after another
+type gapSampler interface {
+	// returns the gap following a packet with transfer time tTransfer. The
+	// gap is never negative, so packets are never sent faster than line
+	// rate.
+	gap(rnd *rand.Rand, tTransfer float64) float64
+
+	// returns the (approximate) fraction of gaps longer than tGap seconds
+	exceed(tGap float64) float64
+}
+
+// GapExceedProb returns the probability that the gap model draws a gap
+// longer than tGap for traffic with a mean data rate of datarate bps and a
+// mean packet size of pktlenMean bytes (including FCS), e.g. to estimate how
+// many inter-packet times exceed the hardware limit. The data rate includes
+// preamble, SOD and inter-frame gap of each packet (see Traffic).
+func GapExceedProb(model GapModel, datarate, pktlenMean float64,
+	tGap time.Duration) (float64, error) {
+	// add 20 bytes for preamble, SOD and inter-frame gap
+	tTransferMean := 8 * (pktlenMean + 20) / 10e9
+	tGapMean := 8*(pktlenMean+20)/datarate - tTransferMean
+
+	s, err := model.sampler(tGapMean, tTransferMean)
+	if err != nil {
+		return 0.0, err
+	}
+	return s.exceed(tGap.Seconds()), nil
+}
+
+// GapExponential draws exponentially distributed gaps (Poisson traffic)
+type GapExponential struct{}
+
+// GapPareto draws Pareto distributed gaps. The smaller the shape parameter
+// Alpha (must be larger than 1), the heavier the tail of the distribution.
+type GapPareto struct {
+	Alpha float64
+}
+
+// GapOnOff sends bursts of BurstLen packets separated by Idle time. Packets
+// of a burst are sent with constant gaps, chosen such that the target data
+// rate is met on average. If Idle is zero, bursts are sent at line rate and
+// the idle time is chosen to meet the target data rate.
+type GapOnOff struct {
+	BurstLen int
+	Idle     time.Duration
+}
+
+// GapMMPP is a Markov-modulated Poisson process. The process cycles through
+// its states, the dwell time in state i is exponentially distributed with a
+// mean of Dwell[i]. Within a state gaps are exponentially distributed, the
+// packet rate of state i is proportional to Rates[i]. Rates are scaled, such
+// that the target data rate is met on average.
+type GapMMPP struct {
+	Rates []float64
+	Dwell []time.Duration
+}
+
+// GapMicroburst inserts a burst of BurstLen packets sent back-to-back at line
+// rate every Period. Gaps of the background traffic in between are
+// exponentially distributed, chosen such that the target data rate is met on
+// average.
+type GapMicroburst struct {
+	Period   time.Duration
+	BurstLen int
+}
+
+// ParseGapModel returns the gap model described by spec. spec is the name of
+// the model, optionally followed by a colon and comma-separated parameters:
+//
+//   - "exponential"
+//   - "pareto:alpha=1.5"
+//   - "onoff:burst=32,idle=10us" (idle optional)
+//   - "mmpp:rates=1/4,dwell=1ms/100us"
+//   - "microburst:period=100us,burst=64"
+func ParseGapModel(spec string) (GapModel, error) {
+	fields := strings.SplitN(spec, ":", 2)
+	name := fields[0]
+
+	params := make(map[string]string)
+	if len(fields) == 2 {
+		for _, param := range strings.Split(fields[1], ",") {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid gap model parameter '%s'",
+					param)
+			}
+			params[kv[0]] = kv[1]
+		}
+	}
+
+	p := gapParams{params: params}
+
+	var model GapModel
+	switch name {
+	case "exponential":
+		model = GapExponential{}
+	case "pareto":
+		model = GapPareto{Alpha: p.float("alpha", 1.5)}
+	case "onoff":
+		model = GapOnOff{
+			BurstLen: p.int("burst", 0),
+			Idle:     p.duration("idle", 0),
+		}
+	case "mmpp":
+		model = GapMMPP{
+			Rates: p.floats("rates"),
+			Dwell: p.durations("dwell"),
+		}
+	case "microburst":
+		model = GapMicroburst{
+			Period:   p.duration("period", 0),
+			BurstLen: p.int("burst", 0),
+		}
+	default:
+		return nil, fmt.Errorf("unknown gap model '%s'", name)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	for key := range params {
+		if !p.used[key] {
+			return nil, fmt.Errorf("unknown parameter '%s' of gap model "+
+				"'%s'", key, name)
+		}
+	}
+
+	if err := model.validate(); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// parses gap model parameters, remembers the first error
+type gapParams struct {
+	params map[string]string
+	used   map[string]bool
+	err    error
+}
+
+func (p *gapParams) get(key string) (string, bool) {
+	if p.used == nil {
+		p.used = make(map[string]bool)
+	}
+	p.used[key] = true
+	value, ok := p.params[key]
+	return value, ok
+}
+
+func (p *gapParams) fail(key, value string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("invalid value '%s' of gap model parameter '%s'",
+			value, key)
+	}
+}
+
+func (p *gapParams) float(key string, def float64) float64 {
+	value, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(key, value)
+	}
+	return v
+}
+
+func (p *gapParams) int(key string, def int) int {
+	value, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		p.fail(key, value)
+	}
+	return v
+}
+
+func (p *gapParams) duration(key string, def time.Duration) time.Duration {
+	value, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		p.fail(key, value)
+	}
+	return v
+}
+
+// lists are separated by slashes
+func (p *gapParams) floats(key string) []float64 {
+	value, ok := p.get(key)
+	if !ok {
+		return nil
+	}
+	var vs []float64
+	for _, str := range strings.Split(value, "/") {
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			p.fail(key, value)
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func (p *gapParams) durations(key string) []time.Duration {
+	value, ok := p.get(key)
+	if !ok {
+		return nil
+	}
+	var vs []time.Duration
+	for _, str := range strings.Split(value, "/") {
+		v, err := time.ParseDuration(str)
+		if err != nil {
+			p.fail(key, value)
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func (m GapExponential) String() string {
+	return "exponential"
+}
+
+func (m GapExponential) validate() error {
+	return nil
+}
+
+func (m GapExponential) sampler(tGapMean, tTransferMean float64) (gapSampler,
+	error) {
+	return &exponentialSampler{tGapMean: tGapMean}, nil
+}
+
+type exponentialSampler struct {
+	tGapMean float64
+}
+
+func (s *exponentialSampler) gap(rnd *rand.Rand, tTransfer float64) float64 {
+	return s.tGapMean * rnd.ExpFloat64()
+}
+
+func (s *exponentialSampler) exceed(tGap float64) float64 {
+	return expExceed(s.tGapMean, tGap)
+}
+
+// returns the probability that an exponentially distributed value with mean
+// mean is larger than x
+func expExceed(mean, x float64) float64 {
+	if mean <= 0.0 {
+		return 0.0
+	}
+	return math.Exp(-x / mean)
+}
+
+func (m GapPareto) String() string {
+	return fmt.Sprintf("pareto:alpha=%g", m.Alpha)
+}
+
+func (m GapPareto) validate() error {
+	// the mean of the distribution is infinite for alpha <= 1
+	if m.Alpha <= 1.0 {
+		return fmt.Errorf("pareto shape parameter alpha must be larger "+
+			"than 1, got %g", m.Alpha)
+	}
+	return nil
+}
+
+func (m GapPareto) sampler(tGapMean, tTransferMean float64) (gapSampler,
+	error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	// choose scale (minimum gap), such that the mean gap is tGapMean
+	return &paretoSampler{
+		alpha: m.Alpha,
+		tMin:  tGapMean * (m.Alpha - 1.0) / m.Alpha,
+	}, nil
+}
+
+type paretoSampler struct {
+	alpha float64
+	tMin  float64
+}
+
+func (s *paretoSampler) gap(rnd *rand.Rand, tTransfer float64) float64 {
+	// inverse transform sampling, 1-U is in (0, 1]
+	return s.tMin * math.Pow(1.0-rnd.Float64(), -1.0/s.alpha)
+}
+
+func (s *paretoSampler) exceed(tGap float64) float64 {
+	if tGap <= s.tMin {
+		return 1.0
+	}
+	return math.Pow(s.tMin/tGap, s.alpha)
+}
+
+func (m GapOnOff) String() string {
+	return fmt.Sprintf("onoff:burst=%d,idle=%s", m.BurstLen, m.Idle)
+}
+
+func (m GapOnOff) validate() error {
+	if m.BurstLen < 1 {
+		return fmt.Errorf("invalid burst length %d", m.BurstLen)
+	}
+	if m.Idle < 0 {
+		return fmt.Errorf("invalid idle time %s", m.Idle)
+	}
+	return nil
+}
+
+func (m GapOnOff) sampler(tGapMean, tTransferMean float64) (gapSampler,
+	error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	// bursts at line rate if no idle time is configured
+	tIdle := m.Idle.Seconds()
+	if m.Idle == 0 {
+		tIdle = float64(m.BurstLen) * tGapMean
+	}
+
+	// the idle time replaces the gaps of the packets in a burst
+	tGapBurst := tGapMean - tIdle/float64(m.BurstLen)
+	if tGapBurst < 0.0 {
+		return nil, fmt.Errorf("idle time %s too long for the data rate, "+
+			"bursts would exceed line rate", m.Idle)
+	}
+
+	return &onOffSampler{
+		burstLen:  m.BurstLen,
+		tGapBurst: tGapBurst,
+		tIdle:     tIdle,
+	}, nil
+}
+
+type onOffSampler struct {
+	burstLen  int
+	tGapBurst float64
+	tIdle     float64
+
+	// number of packets of the current burst sent so far
+	i int
+}
+
+func (s *onOffSampler) gap(rnd *rand.Rand, tTransfer float64) float64 {
+	s.i++
+	if s.i < s.burstLen {
+		return s.tGapBurst
+	}
+
+	// last packet of the burst
+	s.i = 0
+	return s.tGapBurst + s.tIdle
+}
+
+func (s *onOffSampler) exceed(tGap float64) float64 {
+	if s.tGapBurst > tGap {
+		return 1.0
+	}
+	// only the last packet of a burst is followed by the idle time
+	if s.tGapBurst+s.tIdle > tGap {
+		return 1.0 / float64(s.burstLen)
+	}
+	return 0.0
+}
+
+func (m GapMMPP) String() string {
+	rates := make([]string, len(m.Rates))
+	for i, rate := range m.Rates {
+		rates[i] = strconv.FormatFloat(rate, 'g', -1, 64)
+	}
+	dwell := make([]string, len(m.Dwell))
+	for i, d := range m.Dwell {
+		dwell[i] = d.String()
+	}
+	return fmt.Sprintf("mmpp:rates=%s,dwell=%s", strings.Join(rates, "/"),
+		strings.Join(dwell, "/"))
+}
+
+func (m GapMMPP) validate() error {
+	if len(m.Rates) < 2 || len(m.Rates) != len(m.Dwell) {
+		return errors.New("mmpp requires the same number of rates and " +
+			"dwell times for at least two states")
+	}
+	for i, rate := range m.Rates {
+		if rate <= 0.0 {
+			return fmt.Errorf("invalid rate %g of mmpp state %d", rate, i)
+		}
+		if m.Dwell[i] <= 0 {
+			return fmt.Errorf("invalid dwell time %s of mmpp state %d",
+				m.Dwell[i], i)
+		}
+	}
+	return nil
+}
+
+func (m GapMMPP) sampler(tGapMean, tTransferMean float64) (gapSampler,
+	error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	// mean relative rate, weighted by the dwell times of the states
+	var rateSum, dwellSum float64
+	for i, rate := range m.Rates {
+		rateSum += rate * m.Dwell[i].Seconds()
+		dwellSum += m.Dwell[i].Seconds()
+	}
+	rateMean := rateSum / dwellSum
+
+	// scale inter-packet times of all states, such that the mean data rate
+	// is met
+	s := &mmppSampler{}
+	for i, rate := range m.Rates {
+		tInterPacket := (tGapMean + tTransferMean) * rateMean / rate
+		if tInterPacket < tTransferMean {
+			return nil, fmt.Errorf("data rate of mmpp state %d exceeds "+
+				"line rate", i)
+		}
+		s.tGapMean = append(s.tGapMean, tInterPacket-tTransferMean)
+		s.tDwell = append(s.tDwell, m.Dwell[i].Seconds())
+		s.tInterPacketMean = append(s.tInterPacketMean, tInterPacket)
+	}
+	s.state = -1
+
+	return s, nil
+}
+
+type mmppSampler struct {
+	// mean gap, mean dwell time and mean inter-packet time of each state
+	tGapMean         []float64
+	tDwell           []float64
+	tInterPacketMean []float64
+
+	// current state and time left until the next state is entered
+	state int
+	tLeft float64
+}
+
+func (s *mmppSampler) gap(rnd *rand.Rand, tTransfer float64) float64 {
+	for s.tLeft <= 0.0 {
+		s.state = (s.state + 1) % len(s.tGapMean)
+		s.tLeft += s.tDwell[s.state] * rnd.ExpFloat64()
+	}
+
+	gap := s.tGapMean[s.state] * rnd.ExpFloat64()
+	s.tLeft -= tTransfer + gap
+	return gap
+}
+
+func (s *mmppSampler) exceed(tGap float64) float64 {
+	// the number of packets sent in a state is proportional to its mean
+	// dwell time divided by its mean inter-packet time
+	var p, nPkts float64
+	for i, tGapMean := range s.tGapMean {
+		n := s.tDwell[i] / s.tInterPacketMean[i]
+		p += n * expExceed(tGapMean, tGap)
+		nPkts += n
+	}
+	return p / nPkts
+}
+
+func (m GapMicroburst) String() string {
+	return fmt.Sprintf("microburst:period=%s,burst=%d", m.Period,
+		m.BurstLen)
+}
+
+func (m GapMicroburst) validate() error {
+	if m.BurstLen < 1 {
+		return fmt.Errorf("invalid burst length %d", m.BurstLen)
+	}
+	if m.Period <= 0 {
+		return fmt.Errorf("invalid microburst period %s", m.Period)
+	}
+	return nil
+}
+
+func (m GapMicroburst) sampler(tGapMean, tTransferMean float64) (gapSampler,
+	error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	// mean number of packets per period and the number of packets of the
+	// background traffic
+	tPeriod := m.Period.Seconds()
+	nPkts := tPeriod / (tGapMean + tTransferMean)
+	nBackground := nPkts - float64(m.BurstLen)
+
+	// time available for the background traffic
+	tBackground := tPeriod - float64(m.BurstLen)*tTransferMean
+
+	if nBackground <= 0.0 || tBackground/nBackground < tTransferMean {
+		return nil, fmt.Errorf("microbursts of %d packets every %s exceed "+
+			"the data rate", m.BurstLen, m.Period)
+	}
+
+	return &microburstSampler{
+		burstLen: m.BurstLen,
+		tPeriod:  tPeriod,
+		tGapMean: tBackground/nBackground - tTransferMean,
+	}, nil
+}
+
+type microburstSampler struct {
+	burstLen int
+	tPeriod  float64
+
+	// mean gap of the background traffic
+	tGapMean float64
+
+	// time since the start of the current period
+	tElapsed float64
+
+	// number of packets of the current burst not sent yet
+	burstLeft int
+}
+
+func (s *microburstSampler) gap(rnd *rand.Rand, tTransfer float64) float64 {
+	if s.burstLeft > 0 {
+		s.burstLeft--
+	}
+
+	// packets of a burst are sent back-to-back
+	gap := 0.0
+	if s.burstLeft == 0 {
+		gap = s.tGapMean * rnd.ExpFloat64()
+	}
+
+	tInterPacket := tTransfer + gap
+	if s.burstLeft == 0 && s.tElapsed+tInterPacket >= s.tPeriod {
+		// period is over, next packet starts a burst at the beginning of
+		// the next period (or immediately, if this packet is still being
+		// transferred)
+		gap = math.Max(0.0, s.tPeriod-s.tElapsed-tTransfer)
+		tInterPacket = tTransfer + gap
+		s.tElapsed += tInterPacket - s.tPeriod
+		s.burstLeft = s.burstLen
+		return gap
+	}
+
+	s.tElapsed += tInterPacket
+	return gap
+}
+
+func (s *microburstSampler) exceed(tGap float64) float64 {
+	// the next burst starts at the latest one period later
+	if tGap >= s.tPeriod {
+		return 0.0
+	}
+	return expExceed(s.tGapMean, tGap)
+}
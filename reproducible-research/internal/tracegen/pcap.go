@@ -0,0 +1,294 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Import of PCAP and PCAPNG files and export of traces to PCAP files. On
+// import, packet timestamps are converted to inter-packet clock cycles,
+// packet data is truncated to a configurable capture length while the
+// original wire length is preserved.
+
+package tracegen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/aoeldemann/gofluent10g"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"os"
+	"time"
+)
+
+// magic number of the section header block starting a PCAPNG file
+const pcapngMagic = 0x0A0D0D0A
+
+// PcapOptions configures the import of a PCAP/PCAPNG file
+type PcapOptions struct {
+	// number of bytes of each packet transferred to the hardware, the
+	// hardware appends zero bytes up to the original wire length. if zero,
+	// all captured bytes are transferred
+	CaptureLen int
+
+	// replay speed relative to the original capture (e.g. 2.0 replays twice
+	// as fast). inter-packet times are divided by it. if zero, the original
+	// speed is kept
+	Speedup float64
+
+	// ignore the original timestamps and replay the packets back-to-back at
+	// 10 Gbps line rate
+	LineRate bool
+}
+
+// PcapStats describes an imported PCAP/PCAPNG file
+type PcapStats struct {
+	// number of imported packets
+	NumPackets int
+
+	// sum of the wire lengths (without FCS) of all packets
+	BytesWire uint64
+
+	// time between the first and last packet of the original capture
+	DurationOrig time.Duration
+
+	// number of packets sent later than in the original capture (after
+	// rescaling), because they would have exceeded the 10 Gbps line rate
+	NumLineRateLimited int
+
+	// number of inter-packet times cut to the hardware limit of 2**32-1
+	// clock cycles
+	NumGapsCapped int
+
+	// number of packets shorter than the minimum ethernet frame size, they
+	// are padded by the hardware
+	NumPadded int
+}
+
+// source of packets read from a PCAP or PCAPNG file
+type pcapSource interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// ImportPcap reads a PCAP or PCAPNG file containing ethernet frames and
+// converts it into a trace. The inter-packet times are rounded to clock
+// cycles such that the original timing is met on average (see CycleRounder).
+func ImportPcap(filename string, opts PcapOptions) (*Data, *PcapStats, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	src, err := openPcap(bufio.NewReader(file))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	if src.LinkType() != layers.LinkTypeEthernet {
+		return nil, nil, fmt.Errorf("%s: unsupported link type %s",
+			filename, src.LinkType())
+	}
+
+	speedup := opts.Speedup
+	if speedup == 0.0 {
+		speedup = 1.0
+	}
+
+	b := BuilderCreate()
+	stats := &PcapStats{}
+
+	var rounder CycleRounder
+
+	// a packet is added to the trace when the timestamp of the next packet
+	// is known
+	var (
+		pending        []byte
+		pendingWireLen int
+		pendingTime    time.Time
+		firstTime      time.Time
+	)
+
+	addPending := func(tInterPacket float64) error {
+		// we cannot send faster than 10 Gbps
+		if tInterPacket < tTransfer(pendingWireLen) {
+			if !opts.LineRate {
+				stats.NumLineRateLimited++
+			}
+			tInterPacket = tTransfer(pendingWireLen)
+		}
+
+		// hardware does not support inter-packet times larger than 2**32-1
+		// clock cycles, so cut if necessary
+		if tInterPacket > tInterPacketMax {
+			stats.NumGapsCapped++
+			tInterPacket = tInterPacketMax
+		}
+
+		return b.AddPacket(pending, pendingWireLen,
+			rounder.Round(tInterPacket*gofluent10g.FREQ_SFP))
+	}
+
+	for i := 0; ; i++ {
+		// captures that have been cut off (e.g. capture was aborted) end
+		// with an incomplete packet, which is ignored
+		data, ci, err := src.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%s: packet %d: %s", filename, i,
+				err.Error())
+		}
+
+		if i > 0 {
+			tInterPacket := ci.Timestamp.Sub(pendingTime).Seconds() / speedup
+			if opts.LineRate {
+				tInterPacket = 0.0
+			}
+			if err := addPending(tInterPacket); err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+			}
+		} else {
+			firstTime = ci.Timestamp
+		}
+
+		// wire length is preserved even if the packet was captured with a
+		// limited snap length
+		pendingWireLen = ci.Length
+		if pendingWireLen < PktlenMin {
+			pendingWireLen = PktlenMin
+			stats.NumPadded++
+		}
+
+		captureLen := len(data)
+		if opts.CaptureLen > 0 && opts.CaptureLen < captureLen {
+			captureLen = opts.CaptureLen
+		}
+		if captureLen > pendingWireLen {
+			captureLen = pendingWireLen
+		}
+		pending = append(pending[:0], data[:captureLen]...)
+		pendingTime = ci.Timestamp
+
+		stats.NumPackets++
+		stats.BytesWire += uint64(pendingWireLen)
+	}
+
+	if stats.NumPackets == 0 {
+		return nil, nil, fmt.Errorf("%s: no packets found", filename)
+	}
+
+	// last packet is followed by the minimum gap
+	if err := addPending(0.0); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	stats.DurationOrig = pendingTime.Sub(firstTime)
+
+	return b.Finish(), stats, nil
+}
+
+// WritePcap writes the trace to a PCAP file with nanosecond timestamps. Each
+// packet is timestamped with its scheduled departure time (start plus the
+// inter-packet times of all preceding packets) and zero padded to its wire
+// length, as done by the hardware before transmission.
+func (data *Data) WritePcap(filename string, start time.Time) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bufWriter := bufio.NewWriter(file)
+	w := pcapgo.NewWriterNanos(bufWriter)
+	err = w.WriteFileHeader(PktlenMax, layers.LinkTypeEthernet)
+	if err != nil {
+		return err
+	}
+
+	var cycles uint64
+	pktData := make([]byte, PktlenMax)
+
+	d := DecoderCreate(data.Buf)
+	for {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// restore original packet length
+		copy(pktData, pkt.Data)
+		for i := pkt.CaptureLen; i < pkt.WireLen; i++ {
+			pktData[i] = 0
+		}
+
+		ci := gopacket.CaptureInfo{
+			Timestamp: start.Add(time.Duration(float64(cycles)/
+				gofluent10g.FREQ_SFP*1e9 + 0.5)),
+			CaptureLength: pkt.WireLen,
+			Length:        pkt.WireLen,
+		}
+		if err := w.WritePacket(ci, pktData[:pkt.WireLen]); err != nil {
+			return err
+		}
+
+		cycles += pkt.CyclesInterPacket
+	}
+
+	if err := bufWriter.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// detects whether the file is a PCAP or PCAPNG file and opens it
+func openPcap(r *bufio.Reader) (pcapSource, error) {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, errors.New("not a PCAP or PCAPNG file")
+	}
+
+	// the block type of the section header block is a palindrome, so the
+	// byte order does not matter
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		ngReader, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, err
+		}
+		return ngReader, nil
+	}
+
+	reader, err := pcapgo.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
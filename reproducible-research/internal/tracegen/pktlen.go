@@ -0,0 +1,235 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Packet size distributions: standard IMIX profiles, weighted packet size
+// tables and empirical distributions loaded from histogram files.
+
+package tracegen
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IMIX profiles. Packet sizes include the FCS. Test equipment vendors do not
+// agree on a single IMIX definition, use a weighted packet size table (see
+// ParsePktlenDist) if the profile of a particular tester must be matched.
+var IMIXProfiles = map[string]struct {
+	Pktlens []int
+	Weights []float64
+}{
+	// simple IMIX: 7:4:1 mix of small, medium and large packets (mean packet
+	// size 361.83 bytes)
+	"imix": {[]int{64, 594, 1518}, []float64{7, 4, 1}},
+
+	// 7:4:1 mix with 570 byte medium-sized packets as configured by the IMIX
+	// presets of Agilent and Spirent testers (mean packet size 353.83 bytes)
+	"imix-agilent": {[]int{64, 570, 1518}, []float64{7, 4, 1}},
+
+	// IMIX defined by the Tolly Group (mean packet size 486.16 bytes)
+	"imix-tolly": {[]int{64, 78, 576, 1518}, []float64{55, 5, 17, 23}},
+}
+
+// PktlenDist is a discrete packet size distribution
+type PktlenDist struct {
+	// packet sizes (including FCS) in ascending order
+	pktlens []int
+
+	// cumulative probabilities of the packet sizes
+	cdf []float64
+
+	// mean packet size (including FCS)
+	mean float64
+}
+
+// PktlenDistCreate creates a distribution of the packet sizes pktlens
+// (including FCS) occurring with the relative frequencies weights. Weights do
+// not have to add up to one.
+func PktlenDistCreate(pktlens []int, weights []float64) (*PktlenDist, error) {
+	if len(pktlens) == 0 || len(pktlens) != len(weights) {
+		return nil, errors.New("number of packet sizes and weights does " +
+			"not match")
+	}
+
+	// sort packet sizes and merge duplicates
+	sum := make(map[int]float64)
+	for i, pktlen := range pktlens {
+		if pktlen-4 < PktlenMin || pktlen-4 > PktlenMax {
+			return nil, fmt.Errorf("invalid packet size %d", pktlen)
+		}
+		if weights[i] < 0.0 {
+			return nil, fmt.Errorf("invalid weight %f of packet size %d",
+				weights[i], pktlen)
+		}
+		sum[pktlen] += weights[i]
+	}
+
+	d := &PktlenDist{}
+	for pktlen, weight := range sum {
+		if weight > 0.0 {
+			d.pktlens = append(d.pktlens, pktlen)
+		}
+	}
+	if len(d.pktlens) == 0 {
+		return nil, errors.New("sum of packet size weights is zero")
+	}
+	sort.Ints(d.pktlens)
+
+	var total float64
+	for _, pktlen := range d.pktlens {
+		total += sum[pktlen]
+	}
+
+	var acc float64
+	d.cdf = make([]float64, len(d.pktlens))
+	for i, pktlen := range d.pktlens {
+		acc += sum[pktlen]
+		d.cdf[i] = acc / total
+		d.mean += float64(pktlen) * sum[pktlen] / total
+	}
+
+	// make sure rounding errors do not prevent drawing the largest packet
+	// size
+	d.cdf[len(d.cdf)-1] = 1.0
+
+	return d, nil
+}
+
+// IMIX returns the distribution of an IMIX profile (see IMIXProfiles)
+func IMIX(name string) (*PktlenDist, error) {
+	profile, ok := IMIXProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown IMIX profile '%s'", name)
+	}
+	return PktlenDistCreate(profile.Pktlens, profile.Weights)
+}
+
+// ReadPktlenHistogram loads an empirical packet size distribution from a
+// histogram file containing "<packet size> <number of packets>" lines.
+// Packet sizes include the FCS.
+func ReadPktlenHistogram(filename string) (*PktlenDist, error) {
+	rows, err := datfile.ReadColumns(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pktlens := make([]int, len(rows))
+	weights := make([]float64, len(rows))
+	for i, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("%s: expected 2 columns, got %d",
+				filename, len(row))
+		}
+		pktlens[i] = int(row[0])
+		weights[i] = row[1]
+	}
+
+	d, err := PktlenDistCreate(pktlens, weights)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return d, nil
+}
+
+// ParsePktlenDist returns the packet size distribution described by spec,
+// which is either
+//
+//   - the name of an IMIX profile (e.g. "imix", see IMIXProfiles),
+//   - a weighted packet size table "<size>:<weight>,..." (e.g.
+//     "64:7,594:4,1518:1") or
+//   - the name of a histogram file (see ReadPktlenHistogram).
+func ParsePktlenDist(spec string) (*PktlenDist, error) {
+	if _, ok := IMIXProfiles[spec]; ok {
+		return IMIX(spec)
+	}
+
+	if strings.Contains(spec, ":") {
+		if _, err := os.Stat(spec); os.IsNotExist(err) {
+			return parsePktlenTable(spec)
+		}
+	}
+
+	return ReadPktlenHistogram(spec)
+}
+
+func parsePktlenTable(spec string) (*PktlenDist, error) {
+	var pktlens []int
+	var weights []float64
+	for _, entry := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid packet size table entry '%s'",
+				entry)
+		}
+
+		pktlen, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid packet size '%s'", fields[0])
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight '%s'", fields[1])
+		}
+
+		pktlens = append(pktlens, pktlen)
+		weights = append(weights, weight)
+	}
+
+	return PktlenDistCreate(pktlens, weights)
+}
+
+// Mean returns the mean packet size (including FCS)
+func (d *PktlenDist) Mean() float64 {
+	return d.mean
+}
+
+// Min returns the smallest packet size (including FCS)
+func (d *PktlenDist) Min() int {
+	return d.pktlens[0]
+}
+
+// Draw returns a random packet size (including FCS)
+func (d *PktlenDist) Draw(rnd *rand.Rand) int {
+	return d.pktlens[sort.SearchFloat64s(d.cdf, rnd.Float64())]
+}
+
+// String returns the distribution as weighted packet size table
+func (d *PktlenDist) String() string {
+	entries := make([]string, len(d.pktlens))
+	prev := 0.0
+	for i, pktlen := range d.pktlens {
+		entries[i] = fmt.Sprintf("%d:%.4g", pktlen, d.cdf[i]-prev)
+		prev = d.cdf[i]
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,304 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Random traffic: uniformly distributed packet sizes (or packet sizes drawn
+// from a PktlenDist) and exponentially distributed inter-packet gaps (or gaps
+// drawn from a GapModel).
+
+package tracegen
+
+import (
+	"fmt"
+	"github.com/aoeldemann/gofluent10g"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// HeadersLenDefault is the length of the ethernet and ipv4 header of packets
+// generated without header template
+const HeadersLenDefault = 34
+
+// Traffic describes random traffic
+type Traffic struct {
+	// mean data rate in bps (including 24 bytes of FCS, preamble, SOD and
+	// inter-frame gap per packet)
+	Datarate float64
+
+	// number of bytes of each packet (ethernet and ipv4 header, zero padded)
+	// transferred to the hardware, which restores the original packet length
+	// before transmission
+	CaptureLen int
+
+	// duration of the trace
+	Duration time.Duration
+
+	// packet size distribution. Packet sizes are uniformly distributed
+	// between 64 and 1518 bytes if nil
+	Pktlens *PktlenDist
+
+	// inter-packet gap model. Gaps are exponentially distributed if nil
+	Gaps GapModel
+
+	// packet headers. Packets consist of an ethernet and an ipv4 header with
+	// fixed addresses if nil
+	Headers *HeaderTemplate
+
+	// sequence tags embedded into the packets. Packets are not tagged if nil
+	SeqTag *SeqTag
+}
+
+// GenTraffic returns a generator for the random traffic t. The generator
+// returns an error if the gap model cannot meet the data rate (see
+// Traffic.Check).
+func GenTraffic(t Traffic) Generator {
+	return func(rnd *rand.Rand) (*Data, error) {
+		src, err := newRandomSource(rnd, t)
+		if err != nil {
+			return nil, err
+		}
+
+		b := BuilderCreate()
+		b.Reserve(src.nPkts, t.CaptureLen)
+		if err := b.AddPackets(src); err != nil {
+			return nil, err
+		}
+
+		return b.Finish(), nil
+	}
+}
+
+// StreamTraffic returns a packet source producing the same packets as
+// GenTraffic
+func StreamTraffic(rnd *rand.Rand, t Traffic) (PacketSource, error) {
+	src, err := newRandomSource(rnd, t)
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// Check returns an error if the gap model cannot meet the data rate of the
+// traffic without exceeding the line rate
+func (t Traffic) Check() error {
+	_, err := newRandomSource(nil, t)
+	return err
+}
+
+// packet source of random traffic
+type randomSource struct {
+	rnd *rand.Rand
+
+	// packet length is uniformly distributed between pktlenMin and
+	// pktlenMax if dist is nil
+	pktlenMin int
+	pktlenMax int
+	dist      *PktlenDist
+
+	// draws the gaps between packets
+	gaps gapSampler
+
+	// generates the packet headers if a header template is configured
+	headers *Headers
+
+	// sequence tag embedded into the packets, may be nil
+	seqTag *SeqTag
+
+	// number of packets to generate and number of packets generated so far
+	nPkts int
+	i     int
+
+	// we will reuse the same ethernet and ipv4 header for all packets
+	hdrEth *layers.Ethernet
+	hdrIP  *layers.IPv4
+	bufPkt gopacket.SerializeBuffer
+
+	// packet data transferred to the hardware (zero padded headers)
+	pktData []byte
+
+	rounder CycleRounder
+}
+
+func newRandomSource(rnd *rand.Rand, t Traffic) (*randomSource, error) {
+	// packet length is uniformly distributed between 64 and 1518 bytes.
+	// Since MAC will append FCS, the packets we generate here are 4 bytes
+	// shorter
+	src := &randomSource{
+		rnd:       rnd,
+		pktlenMin: 60,
+		pktlenMax: 1514,
+		dist:      t.Pktlens,
+		seqTag:    t.SeqTag,
+		pktData:   make([]byte, t.CaptureLen),
+		bufPkt:    gopacket.NewSerializeBuffer(),
+	}
+	pktlenMean := float64((src.pktlenMin + src.pktlenMax) / 2)
+	if t.Pktlens != nil {
+		pktlenMean = t.Pktlens.Mean() - 4
+	}
+
+	// calculate the average time of the gap between two packets. the
+	// transfer time grows linearly with the packet length, so the mean
+	// inter-packet time is the transfer time of a packet of mean length plus
+	// the mean gap
+	tTransferMean := 8 * (pktlenMean + 24) / 10e9
+	tGapMean := 8*(pktlenMean+24)/t.Datarate - tTransferMean
+
+	var gaps GapModel = GapExponential{}
+	if t.Gaps != nil {
+		gaps = t.Gaps
+	}
+
+	var err error
+	src.gaps, err = gaps.sampler(tGapMean, tTransferMean)
+	if err != nil {
+		return nil, fmt.Errorf("gap model '%s' at %.2f bps: %s", gaps,
+			t.Datarate, err.Error())
+	}
+
+	// calculate the number of packets we will generate
+	src.nPkts = round(t.Duration.Seconds() * t.Datarate /
+		(8 * (pktlenMean + 24)))
+
+	pktlenMin := src.pktlenMin
+	if t.Pktlens != nil {
+		pktlenMin = t.Pktlens.Min() - 4
+	}
+	if t.SeqTag != nil {
+		if err := t.SeqTag.check(t.CaptureLen, pktlenMin); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Headers != nil {
+		// each source compiles its own headers, so that field modifiers
+		// start over
+		src.headers, err = t.Headers.Compile()
+		if err != nil {
+			return nil, err
+		}
+
+		if pktlenMin < src.headers.Len() {
+			return nil, fmt.Errorf("%d bytes of packet headers do not fit "+
+				"into packets of size %d", src.headers.Len(), pktlenMin+4)
+		}
+		if t.SeqTag != nil {
+			if err := t.SeqTag.CheckOffset(src.headers.Len()); err != nil {
+				return nil, err
+			}
+		}
+
+		return src, nil
+	}
+
+	// ethernet and ipv4 header
+	if t.SeqTag != nil {
+		if err := t.SeqTag.CheckOffset(HeadersLenDefault); err != nil {
+			return nil, err
+		}
+	}
+
+	macSrc, _ := net.ParseMAC("53:00:00:00:00:01")
+	macDst, _ := net.ParseMAC("53:00:00:00:00:02")
+	src.hdrEth = &layers.Ethernet{
+		SrcMAC:       macSrc,
+		DstMAC:       macDst,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	src.hdrIP = &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+	}
+
+	return src, nil
+}
+
+func (src *randomSource) NextPacket() ([]byte, int, uint64, error) {
+	if src.i == src.nPkts {
+		return nil, 0, 0, io.EOF
+	}
+	src.i++
+
+	// determine packet length according to uniform distribution or draw it
+	// from the packet size distribution (without FCS)
+	var lenWire int
+	if src.dist == nil {
+		lenWire = src.rnd.Intn(src.pktlenMax-src.pktlenMin+1) + src.pktlenMin
+	} else {
+		lenWire = src.dist.Draw(src.rnd) - 4
+	}
+
+	// inter-packet time is transfer time plus random gap. hardware does not
+	// support inter-packet times larger than 2**32-1 clock cycles, so cut if
+	// necessary
+	tTransferPkt := tTransfer(lenWire)
+	tInterPacket := tTransferPkt + src.gaps.gap(src.rnd, tTransferPkt)
+	if tInterPacket > tInterPacketMax {
+		tInterPacket = tInterPacketMax
+	}
+
+	cyclesInterPacket := src.rounder.Round(tInterPacket * gofluent10g.FREQ_SFP)
+
+	// serialize packet headers
+	var hdrs []byte
+	if src.headers != nil {
+		var err error
+		hdrs, err = src.headers.Next(src.rnd, lenWire)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	} else {
+		src.hdrIP.Length = uint16(lenWire - 14)
+		err := gopacket.SerializeLayers(src.bufPkt,
+			gopacket.SerializeOptions{ComputeChecksums: true}, src.hdrEth,
+			src.hdrIP)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		hdrs = src.bufPkt.Bytes()
+	}
+
+	// only the first captureLen bytes are transferred to the hardware
+	copy(src.pktData, hdrs)
+	data := src.pktData
+	if len(data) > lenWire {
+		data = data[:lenWire]
+	}
+
+	if src.seqTag != nil {
+		src.seqTag.embed(data, uint64(src.i-1))
+	}
+
+	return data, lenWire, cyclesInterPacket, nil
+}
@@ -0,0 +1,159 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Sequence tags. Each packet of a flow carries a tag with its flow ID and
+// sequence number in the bytes transferred to the hardware, so that lost,
+// reordered, duplicated and corrupted packets can be identified in the
+// capture (see internal/integrity). All fields are big-endian:
+//
+//	offset  size  field
+//	     0     4  flow ID
+//	     4     8  sequence number (starting at zero)
+//	    12     2  number of bytes following the tag protected by the CRC
+//	    14     4  CRC-32 (IEEE) of bytes 0-13 and the protected bytes
+//	    18     2  checksum compensation
+//
+// The protected bytes are the remaining bytes transferred to the hardware.
+// The compensation makes the 16 bit ones' complement sum of the tag zero, so
+// that TCP and UDP checksums of header templates (computed for a zero
+// payload) stay valid. Tags start at an even byte offset: transport layer
+// headers start at even offsets as well, so the 16 bit words of the tag are
+// words of the checksummed transport layer segment.
+
+package tracegen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// SeqTagLen is the length of a sequence tag in bytes
+const SeqTagLen = 20
+
+// errors returned by ParseSeqTag
+var (
+	// packet data ends before the tag or the protected bytes
+	ErrSeqTagTruncated = errors.New("sequence tag truncated")
+
+	// CRC of the tag does not match
+	ErrSeqTagCorrupted = errors.New("sequence tag corrupted")
+)
+
+// SeqTag configures the sequence tags embedded into the packets of a flow
+type SeqTag struct {
+	// byte offset of the tag in the packet. Must be even and must not
+	// overlap the packet headers or the hardware timestamp
+	Offset int
+
+	// flow ID stored in the tag
+	FlowID uint32
+}
+
+// returns an error if the tag does not fit into packets of which captureLen
+// bytes are transferred to the hardware and that are at least pktlenMin
+// bytes long (without FCS)
+func (tag *SeqTag) check(captureLen, pktlenMin int) error {
+	end := tag.Offset + SeqTagLen
+	if tag.Offset < 0 || end > captureLen || end > pktlenMin {
+		return fmt.Errorf("%d byte sequence tag at byte offset %d does not "+
+			"fit into the %d bytes transferred of packets of size %d",
+			SeqTagLen, tag.Offset, captureLen, pktlenMin+4)
+	}
+	return nil
+}
+
+// CheckOffset returns an error if the tag starts at an odd byte offset or
+// overlaps the first hdrLen bytes of the packet holding the packet headers
+func (tag *SeqTag) CheckOffset(hdrLen int) error {
+	if tag.Offset%2 != 0 {
+		return fmt.Errorf("sequence tag at odd byte offset %d (must be "+
+			"aligned to the 16 bit words of the transport layer checksum)",
+			tag.Offset)
+	}
+	if tag.Offset < hdrLen {
+		return fmt.Errorf("sequence tag at byte offset %d overlaps the %d "+
+			"bytes of packet headers", tag.Offset, hdrLen)
+	}
+	return nil
+}
+
+// embeds the tag with the sequence number seq into the packet data, which
+// holds all bytes of the packet transferred to the hardware
+func (tag *SeqTag) embed(data []byte, seq uint64) {
+	t := data[tag.Offset : tag.Offset+SeqTagLen]
+	protected := data[tag.Offset+SeqTagLen:]
+	if len(protected) > 0xFFFF {
+		protected = protected[:0xFFFF]
+	}
+
+	binary.BigEndian.PutUint32(t[0:4], tag.FlowID)
+	binary.BigEndian.PutUint64(t[4:12], seq)
+	binary.BigEndian.PutUint16(t[12:14], uint16(len(protected)))
+
+	crc := crc32.NewIEEE()
+	crc.Write(t[0:14])
+	crc.Write(protected)
+	binary.BigEndian.PutUint32(t[14:18], crc.Sum32())
+
+	// ones' complement sum of all other 16 bit words of the tag
+	var sum uint32
+	for i := 0; i < 18; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(t[i : i+2]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	binary.BigEndian.PutUint16(t[18:20], ^uint16(sum))
+}
+
+// ParseSeqTag extracts flow ID and sequence number of the tag at the byte
+// offset of the packet data. It returns ErrSeqTagTruncated if data does not
+// contain the complete tag and its protected bytes and ErrSeqTagCorrupted if
+// the CRC does not match.
+func ParseSeqTag(data []byte, offset int) (uint32, uint64, error) {
+	if offset < 0 || len(data) < offset+SeqTagLen {
+		return 0, 0, ErrSeqTagTruncated
+	}
+	t := data[offset : offset+SeqTagLen]
+
+	nProtected := int(binary.BigEndian.Uint16(t[12:14]))
+	if len(data) < offset+SeqTagLen+nProtected {
+		return 0, 0, ErrSeqTagTruncated
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(t[0:14])
+	crc.Write(data[offset+SeqTagLen : offset+SeqTagLen+nProtected])
+	if crc.Sum32() != binary.BigEndian.Uint32(t[14:18]) {
+		return 0, 0, ErrSeqTagCorrupted
+	}
+
+	return binary.BigEndian.Uint32(t[0:4]), binary.BigEndian.Uint64(t[4:12]),
+		nil
+}
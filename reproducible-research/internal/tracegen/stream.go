@@ -0,0 +1,168 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Streaming trace generation. Packet sources produce the packets of a trace
+// one after another, a Stream assembles them to trace data in chunks of a
+// fixed size, so that traces larger than host memory can be generated.
+
+package tracegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"time"
+)
+
+// ChunkSizeDefault is the default chunk size of a Stream
+const ChunkSizeDefault = 4 * 1024 * 1024
+
+// PacketSource produces the packets of a trace one after another
+type PacketSource interface {
+	// NextPacket returns the data transferred to the hardware (capture
+	// length is len(data)), the wire length (without FCS) and the number of
+	// clock cycles until the next packet starts. It returns io.EOF after the
+	// last packet. data may be overwritten by the next call.
+	NextPacket() (data []byte, wireLen int, gapCycles uint64, err error)
+}
+
+// Stream assembles the packets of a source to trace data chunk by chunk. The
+// concatenated chunks are byte-identical to the trace assembled by a Builder
+// from the same packets.
+type Stream struct {
+	src       PacketSource
+	b         *Builder
+	chunkSize int
+
+	// number of bytes of the builder's buffer returned by the last call of
+	// Next
+	returned int
+
+	// true if all packets have been read from the source
+	eof bool
+
+	// hash of all trace data returned so far
+	hash hash.Hash
+}
+
+// StreamCreate creates a stream producing chunks of chunkSize bytes (rounded
+// up to a multiple of 64 bytes, ChunkSizeDefault if zero). Only the last
+// chunk may be smaller.
+func StreamCreate(src PacketSource, chunkSize int) *Stream {
+	if chunkSize <= 0 {
+		chunkSize = ChunkSizeDefault
+	}
+	chunkSize = 64 * ((chunkSize + 63) / 64)
+
+	s := &Stream{
+		src:       src,
+		b:         BuilderCreate(),
+		chunkSize: chunkSize,
+		hash:      sha256.New(),
+	}
+	s.b.buf = make([]byte, 0, chunkSize+PacketSize(PktlenMax))
+
+	return s
+}
+
+// Next returns the next chunk of trace data. It returns io.EOF after the last
+// chunk, which contains the padding at the end of the trace. The chunk is
+// only valid until the next call.
+func (s *Stream) Next() ([]byte, error) {
+	// remove the chunk returned by the previous call from the buffer
+	if s.returned > 0 {
+		n := copy(s.b.buf, s.b.buf[s.returned:])
+		s.b.buf = s.b.buf[:n]
+		s.returned = 0
+	}
+
+	for !s.eof && len(s.b.buf) < s.chunkSize {
+		data, wireLen, gapCycles, err := s.src.NextPacket()
+		if err == io.EOF {
+			s.eof = true
+			s.b.pad()
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := s.b.AddPacket(data, wireLen, gapCycles); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.b.buf) == 0 {
+		return nil, io.EOF
+	}
+
+	s.returned = s.chunkSize
+	if s.returned > len(s.b.buf) {
+		s.returned = len(s.b.buf)
+	}
+
+	chunk := s.b.buf[:s.returned]
+	s.hash.Write(chunk)
+
+	return chunk, nil
+}
+
+// WriteTo writes all remaining chunks to w
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for {
+		chunk, err := s.Next()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		nChunk, err := w.Write(chunk)
+		n += int64(nChunk)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// NumPackets returns the number of packets streamed so far
+func (s *Stream) NumPackets() int {
+	return s.b.NumPackets()
+}
+
+// Duration returns the replay duration of the packets streamed so far
+func (s *Stream) Duration() time.Duration {
+	return s.b.Duration()
+}
+
+// Checksum returns the SHA-256 hash of the trace data returned so far as hex
+// string. After the last chunk it equals the checksum of the complete trace
+// (see Data.Checksum).
+func (s *Stream) Checksum() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
@@ -0,0 +1,110 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of streaming trace generation.
+
+package tracegen
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	traffic := Traffic{
+		Datarate:   8e9,
+		CaptureLen: 34,
+		Duration:   2 * time.Millisecond,
+	}
+
+	// trace assembled by the builder
+	data, err := Generate(GenTraffic(traffic), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		chunkSize int
+
+		// size of all chunks but the last
+		chunkSizeExpected int
+	}{
+		{"64 bytes", 64, 64},
+		{"rounded up", 100, 128},
+		{"64 KiB", 64 * 1024, 64 * 1024},
+		{"default", 0, ChunkSizeDefault},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src, err := StreamTraffic(rand.New(rand.NewSource(1)), traffic)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf []byte
+			var chunkSizeLast int
+			s := StreamCreate(src, test.chunkSize)
+			for {
+				chunk, err := s.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if chunkSizeLast != 0 &&
+					chunkSizeLast != test.chunkSizeExpected {
+					t.Fatalf("chunk of %d bytes, expected %d bytes",
+						chunkSizeLast, test.chunkSizeExpected)
+				}
+				chunkSizeLast = len(chunk)
+				buf = append(buf, chunk...)
+			}
+
+			if !bytes.Equal(buf, data.Buf) {
+				t.Errorf("concatenated chunks (%d bytes) differ from "+
+					"builder trace (%d bytes)", len(buf), len(data.Buf))
+			}
+			if s.NumPackets() != data.NumPackets {
+				t.Errorf("%d packets, expected %d", s.NumPackets(),
+					data.NumPackets)
+			}
+			if s.Duration() != data.Duration {
+				t.Errorf("duration %s, expected %s", s.Duration(),
+					data.Duration)
+			}
+			if s.Checksum() != data.Checksum() {
+				t.Errorf("checksum %s, expected %s", s.Checksum(),
+					data.Checksum())
+			}
+		})
+	}
+}
@@ -0,0 +1,646 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Packet header templates. A template describes the L2-L4 headers (VLAN/QinQ,
+// MPLS, IPv4/IPv6, UDP/TCP) of the packets of a trace. Field modifiers vary
+// MAC addresses, IP addresses, VLAN ids, MPLS labels and ports from packet to
+// packet to create many flows. Lengths and checksums of the headers always
+// match the wire length of the packet.
+
+package tracegen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+// HeaderTemplate describes the packet headers of a trace. It can be loaded
+// from the [headers] section of an experiment configuration file.
+type HeaderTemplate struct {
+	// ethernet addresses
+	SrcMAC string `toml:"src_mac" json:"src_mac"`
+	DstMAC string `toml:"dst_mac" json:"dst_mac"`
+
+	// VLAN ids, outermost first. Two VLAN ids result in a QinQ (802.1ad)
+	// header
+	VLANs []int `toml:"vlans,omitempty" json:"vlans,omitempty"`
+
+	// MPLS labels, top of the stack first
+	MPLS []int `toml:"mpls,omitempty" json:"mpls,omitempty"`
+
+	// IPv4 or IPv6 addresses, both must have the same address family
+	SrcIP string `toml:"src_ip" json:"src_ip"`
+	DstIP string `toml:"dst_ip" json:"dst_ip"`
+
+	// "udp" (default) or "tcp"
+	Proto string `toml:"proto,omitempty" json:"proto,omitempty"`
+
+	// transport layer ports
+	SrcPort int `toml:"src_port" json:"src_port"`
+	DstPort int `toml:"dst_port" json:"dst_port"`
+
+	// IPv4 TTL or IPv6 hop limit (default: 64)
+	TTL int `toml:"ttl,omitempty" json:"ttl,omitempty"`
+
+	// field modifiers, applied to every packet
+	Modifiers []FieldModifier `toml:"modifiers,omitempty" json:"modifiers"`
+}
+
+// FieldModifier varies a header field from packet to packet
+type FieldModifier struct {
+	// modified field: "src_mac", "dst_mac", "vlan" (outer VLAN id),
+	// "inner_vlan", "mpls" (top label), "src_ip", "dst_ip", "src_port" or
+	// "dst_port"
+	Field string `toml:"field" json:"field"`
+
+	// "increment": add Step to the template value for each packet, start
+	// over after Count packets. "random": add a random multiple of Step
+	// between 0 and Count-1 to the template value. "list": cycle through
+	// Values.
+	Mode string `toml:"mode" json:"mode"`
+
+	// step size (default: 1)
+	Step int `toml:"step,omitempty" json:"step,omitempty"`
+
+	// number of distinct values (increment: default is the full range of
+	// the field)
+	Count int `toml:"count,omitempty" json:"count,omitempty"`
+
+	// field values of list modifiers
+	Values []string `toml:"values,omitempty" json:"values,omitempty"`
+}
+
+// modifiable header fields
+type headerField int
+
+const (
+	fieldSrcMAC headerField = iota
+	fieldDstMAC
+	fieldVLAN
+	fieldInnerVLAN
+	fieldMPLS
+	fieldSrcIP
+	fieldDstIP
+	fieldSrcPort
+	fieldDstPort
+	numHeaderFields
+)
+
+var headerFieldNames = map[string]headerField{
+	"src_mac":    fieldSrcMAC,
+	"dst_mac":    fieldDstMAC,
+	"vlan":       fieldVLAN,
+	"inner_vlan": fieldInnerVLAN,
+	"mpls":       fieldMPLS,
+	"src_ip":     fieldSrcIP,
+	"dst_ip":     fieldDstIP,
+	"src_port":   fieldSrcPort,
+	"dst_port":   fieldDstPort,
+}
+
+// field modifier modes
+const (
+	modeIncrement = iota
+	modeRandom
+	modeList
+)
+
+// compiled field modifier
+type modifier struct {
+	field headerField
+	mode  int
+	step  uint64
+	count uint64
+
+	// values of list modifiers
+	values []uint64
+
+	// number of packets modified so far
+	n uint64
+}
+
+// Headers generates the packet headers described by a HeaderTemplate. The
+// headers are serialized once when the template is compiled. For each packet,
+// only the modified fields, the length fields and the checksums are patched.
+type Headers struct {
+	// headers serialized with the template values
+	template []byte
+
+	// template values of the modifiable fields. only the lower 64 bits of
+	// IPv6 addresses can be modified
+	base [numHeaderFields]uint64
+
+	// bit widths of the modifiable fields
+	width [numHeaderFields]uint
+
+	// byte offsets of the modifiable fields
+	offset [numHeaderFields]int
+
+	// fields changed by at least one modifier
+	modified []headerField
+
+	// byte offsets of the IP and transport layer headers
+	offIP int
+	offL4 int
+
+	isIPv4 bool
+	isUDP  bool
+
+	modifiers []*modifier
+
+	// length of all headers in bytes
+	len int
+
+	buf []byte
+}
+
+// Compile checks the template and returns the header generator
+func (t *HeaderTemplate) Compile() (*Headers, error) {
+	h := &Headers{}
+
+	// layers in serialization order
+	var hdrs []gopacket.SerializableLayer
+
+	srcMAC, err := net.ParseMAC(t.SrcMAC)
+	if err != nil || len(srcMAC) != 6 {
+		return nil, fmt.Errorf("invalid source MAC address '%s'", t.SrcMAC)
+	}
+	dstMAC, err := net.ParseMAC(t.DstMAC)
+	if err != nil || len(dstMAC) != 6 {
+		return nil, fmt.Errorf("invalid destination MAC address '%s'",
+			t.DstMAC)
+	}
+	hdrEth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC}
+	h.base[fieldSrcMAC] = macToUint(srcMAC)
+	h.base[fieldDstMAC] = macToUint(dstMAC)
+	h.width[fieldSrcMAC] = 48
+	h.width[fieldDstMAC] = 48
+	h.offset[fieldDstMAC] = 0
+	h.offset[fieldSrcMAC] = 6
+	hdrs = append(hdrs, hdrEth)
+	h.len += 14
+
+	srcIP := net.ParseIP(t.SrcIP)
+	dstIP := net.ParseIP(t.DstIP)
+	if srcIP == nil {
+		return nil, fmt.Errorf("invalid source IP address '%s'", t.SrcIP)
+	}
+	if dstIP == nil {
+		return nil, fmt.Errorf("invalid destination IP address '%s'",
+			t.DstIP)
+	}
+	h.isIPv4 = srcIP.To4() != nil
+	if h.isIPv4 != (dstIP.To4() != nil) {
+		return nil, errors.New("source and destination IP address must " +
+			"have the same address family")
+	}
+
+	// ethernet type of the layer following the ethernet header or the
+	// last VLAN tag
+	etherType := layers.EthernetTypeIPv6
+	if h.isIPv4 {
+		etherType = layers.EthernetTypeIPv4
+	}
+	if len(t.MPLS) > 0 {
+		etherType = layers.EthernetTypeMPLSUnicast
+	}
+
+	// VLAN tags, the outer tag of QinQ headers has ethernet type 0x88a8
+	if len(t.VLANs) > 2 {
+		return nil, fmt.Errorf("at most two VLAN tags supported, got %d",
+			len(t.VLANs))
+	}
+	hdrEth.EthernetType = etherType
+	var hdrsVLAN []*layers.Dot1Q
+	for i, vlan := range t.VLANs {
+		if vlan < 0 || vlan > 4095 {
+			return nil, fmt.Errorf("invalid VLAN id %d", vlan)
+		}
+		hdr := &layers.Dot1Q{VLANIdentifier: uint16(vlan), Type: etherType}
+		if i == 0 {
+			hdrEth.EthernetType = layers.EthernetTypeDot1Q
+			if len(t.VLANs) == 2 {
+				hdrEth.EthernetType = layers.EthernetTypeQinQ
+			}
+		} else {
+			hdrsVLAN[i-1].Type = layers.EthernetTypeDot1Q
+		}
+		hdrsVLAN = append(hdrsVLAN, hdr)
+		hdrs = append(hdrs, hdr)
+		h.len += 4
+	}
+	if len(t.VLANs) > 0 {
+		h.base[fieldVLAN] = uint64(t.VLANs[0])
+		h.width[fieldVLAN] = 12
+		h.offset[fieldVLAN] = 14
+	}
+	if len(t.VLANs) > 1 {
+		h.base[fieldInnerVLAN] = uint64(t.VLANs[1])
+		h.width[fieldInnerVLAN] = 12
+		h.offset[fieldInnerVLAN] = 18
+	}
+
+	ttl := t.TTL
+	if ttl == 0 {
+		ttl = 64
+	}
+	if ttl < 0 || ttl > 255 {
+		return nil, fmt.Errorf("invalid TTL %d", ttl)
+	}
+
+	// MPLS label stack
+	if len(t.MPLS) > 0 {
+		h.base[fieldMPLS] = uint64(t.MPLS[0])
+		h.width[fieldMPLS] = 20
+		h.offset[fieldMPLS] = h.len
+	}
+	for i, label := range t.MPLS {
+		if label < 0 || label >= 1<<20 {
+			return nil, fmt.Errorf("invalid MPLS label %d", label)
+		}
+		hdrs = append(hdrs, &layers.MPLS{
+			Label:       uint32(label),
+			TTL:         uint8(ttl),
+			StackBottom: i == len(t.MPLS)-1,
+		})
+		h.len += 4
+	}
+
+	proto := layers.IPProtocolUDP
+	switch t.Proto {
+	case "", "udp":
+	case "tcp":
+		proto = layers.IPProtocolTCP
+	default:
+		return nil, fmt.Errorf("unsupported transport protocol '%s'",
+			t.Proto)
+	}
+	h.isUDP = proto == layers.IPProtocolUDP
+
+	var ip gopacket.NetworkLayer
+	h.offIP = h.len
+	if h.isIPv4 {
+		hdrIPv4 := &layers.IPv4{
+			Version:  4,
+			IHL:      5,
+			TTL:      uint8(ttl),
+			Protocol: proto,
+			SrcIP:    srcIP.To4(),
+			DstIP:    dstIP.To4(),
+		}
+		h.base[fieldSrcIP] = uint64(binary.BigEndian.Uint32(srcIP.To4()))
+		h.base[fieldDstIP] = uint64(binary.BigEndian.Uint32(dstIP.To4()))
+		h.width[fieldSrcIP] = 32
+		h.width[fieldDstIP] = 32
+		h.offset[fieldSrcIP] = h.offIP + 12
+		h.offset[fieldDstIP] = h.offIP + 16
+		hdrs = append(hdrs, hdrIPv4)
+		h.len += 20
+		ip = hdrIPv4
+	} else {
+		hdrIPv6 := &layers.IPv6{
+			Version:    6,
+			NextHeader: proto,
+			HopLimit:   uint8(ttl),
+			SrcIP:      srcIP,
+			DstIP:      dstIP,
+		}
+		h.base[fieldSrcIP] = binary.BigEndian.Uint64(srcIP[8:16])
+		h.base[fieldDstIP] = binary.BigEndian.Uint64(dstIP[8:16])
+		h.width[fieldSrcIP] = 64
+		h.width[fieldDstIP] = 64
+		h.offset[fieldSrcIP] = h.offIP + 16
+		h.offset[fieldDstIP] = h.offIP + 32
+		hdrs = append(hdrs, hdrIPv6)
+		h.len += 40
+		ip = hdrIPv6
+	}
+
+	if t.SrcPort < 0 || t.SrcPort > 65535 {
+		return nil, fmt.Errorf("invalid source port %d", t.SrcPort)
+	}
+	if t.DstPort < 0 || t.DstPort > 65535 {
+		return nil, fmt.Errorf("invalid destination port %d", t.DstPort)
+	}
+	h.base[fieldSrcPort] = uint64(t.SrcPort)
+	h.base[fieldDstPort] = uint64(t.DstPort)
+	h.width[fieldSrcPort] = 16
+	h.width[fieldDstPort] = 16
+
+	h.offL4 = h.len
+	h.offset[fieldSrcPort] = h.offL4
+	h.offset[fieldDstPort] = h.offL4 + 2
+	if h.isUDP {
+		hdrUDP := &layers.UDP{
+			SrcPort: layers.UDPPort(t.SrcPort),
+			DstPort: layers.UDPPort(t.DstPort),
+		}
+		hdrUDP.SetNetworkLayerForChecksum(ip)
+		hdrs = append(hdrs, hdrUDP)
+		h.len += 8
+	} else {
+		hdrTCP := &layers.TCP{
+			SrcPort:    layers.TCPPort(t.SrcPort),
+			DstPort:    layers.TCPPort(t.DstPort),
+			DataOffset: 5,
+			ACK:        true,
+			Window:     65535,
+		}
+		hdrTCP.SetNetworkLayerForChecksum(ip)
+		hdrs = append(hdrs, hdrTCP)
+		h.len += 20
+	}
+
+	if h.len > PktlenMax {
+		return nil, fmt.Errorf("headers too long (%d bytes)", h.len)
+	}
+
+	// serialize the headers once. lengths and checksums are patched for
+	// each packet
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}, hdrs...)
+	if err != nil {
+		return nil, err
+	}
+	h.template = buf.Bytes()[:h.len]
+	h.buf = make([]byte, h.len)
+
+	for i := range t.Modifiers {
+		m, err := h.compileModifier(&t.Modifiers[i])
+		if err != nil {
+			return nil, err
+		}
+		h.modifiers = append(h.modifiers, m)
+
+		isModified := false
+		for _, field := range h.modified {
+			isModified = isModified || field == m.field
+		}
+		if !isModified {
+			h.modified = append(h.modified, m.field)
+		}
+	}
+
+	return h, nil
+}
+
+func (h *Headers) compileModifier(fm *FieldModifier) (*modifier, error) {
+	field, ok := headerFieldNames[fm.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown header field '%s'", fm.Field)
+	}
+	if h.width[field] == 0 {
+		return nil, fmt.Errorf("header field '%s' is not part of the "+
+			"template", fm.Field)
+	}
+
+	m := &modifier{field: field, step: 1}
+	if fm.Step < 0 {
+		return nil, fmt.Errorf("invalid step size %d of field '%s'",
+			fm.Step, fm.Field)
+	} else if fm.Step > 0 {
+		m.step = uint64(fm.Step)
+	}
+	if fm.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d of field '%s'", fm.Count,
+			fm.Field)
+	}
+	m.count = uint64(fm.Count)
+
+	switch fm.Mode {
+	case "increment":
+		m.mode = modeIncrement
+	case "random":
+		m.mode = modeRandom
+		if m.count == 0 {
+			return nil, fmt.Errorf("random modifier of field '%s' requires "+
+				"a count", fm.Field)
+		}
+	case "list":
+		m.mode = modeList
+		if len(fm.Values) == 0 {
+			return nil, fmt.Errorf("list modifier of field '%s' requires "+
+				"values", fm.Field)
+		}
+		for _, str := range fm.Values {
+			value, err := h.parseFieldValue(field, str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value '%s' of field '%s'",
+					str, fm.Field)
+			}
+			m.values = append(m.values, value)
+		}
+	default:
+		return nil, fmt.Errorf("unknown modifier mode '%s'", fm.Mode)
+	}
+
+	return m, nil
+}
+
+// parses the value of a list modifier
+func (h *Headers) parseFieldValue(field headerField, str string) (uint64,
+	error) {
+	switch field {
+	case fieldSrcMAC, fieldDstMAC:
+		mac, err := net.ParseMAC(str)
+		if err != nil || len(mac) != 6 {
+			return 0, errors.New("invalid MAC address")
+		}
+		return macToUint(mac), nil
+	case fieldSrcIP, fieldDstIP:
+		ip := net.ParseIP(str)
+		if ip == nil || (ip.To4() != nil) != h.isIPv4 {
+			return 0, errors.New("invalid IP address")
+		}
+		if h.isIPv4 {
+			return uint64(binary.BigEndian.Uint32(ip.To4())), nil
+		}
+		return binary.BigEndian.Uint64(ip[8:16]), nil
+	default:
+		value, err := strconv.ParseUint(str, 10, int(h.width[field]))
+		if err != nil {
+			return 0, err
+		}
+		return value, nil
+	}
+}
+
+// Len returns the length of the headers in bytes
+func (h *Headers) Len() int {
+	return h.len
+}
+
+// Next returns the headers of the next packet of length wireLen (without
+// FCS). Modifiers draw random numbers from rnd. The returned slice is only
+// valid until the next call.
+func (h *Headers) Next(rnd *rand.Rand, wireLen int) ([]byte, error) {
+	if wireLen < h.len {
+		return nil, fmt.Errorf("packet length %d too short for %d bytes of "+
+			"headers", wireLen, h.len)
+	}
+
+	values := h.base
+	for _, m := range h.modifiers {
+		values[m.field] = m.apply(rnd, values[m.field], h.width[m.field])
+	}
+
+	b := h.buf
+	copy(b, h.template)
+	for _, field := range h.modified {
+		h.putField(b, field, values[field])
+	}
+
+	// the hardware appends zero bytes to restore the wire length. length
+	// fields and checksums must match the packet on the wire. the zero
+	// payload does not contribute to the transport layer checksum
+	ipHdr := b[h.offIP:h.offL4]
+	if h.isIPv4 {
+		binary.BigEndian.PutUint16(ipHdr[2:], uint16(wireLen-h.offIP))
+		binary.BigEndian.PutUint16(ipHdr[10:], 0)
+		binary.BigEndian.PutUint16(ipHdr[10:], checksum(ipHdr, 0))
+	} else {
+		binary.BigEndian.PutUint16(ipHdr[4:], uint16(wireLen-h.offL4))
+	}
+
+	l4Hdr := b[h.offL4:]
+	l4Len := uint32(wireLen - h.offL4)
+	offChecksum := 16
+	if h.isUDP {
+		binary.BigEndian.PutUint16(l4Hdr[4:], uint16(l4Len))
+		offChecksum = 6
+	}
+
+	// pseudo header: addresses, protocol and transport layer length
+	var csum uint32
+	if h.isIPv4 {
+		csum = sum16(ipHdr[12:20])
+	} else {
+		csum = sum16(ipHdr[8:40])
+	}
+	if h.isUDP {
+		csum += uint32(layers.IPProtocolUDP)
+	} else {
+		csum += uint32(layers.IPProtocolTCP)
+	}
+	csum += l4Len
+	binary.BigEndian.PutUint16(l4Hdr[offChecksum:], 0)
+	l4Checksum := checksum(l4Hdr, csum)
+	if h.isUDP && l4Checksum == 0 {
+		// a zero UDP checksum indicates that no checksum has been computed,
+		// a computed zero checksum is transmitted as all ones (RFC 768)
+		l4Checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(l4Hdr[offChecksum:], l4Checksum)
+
+	return b, nil
+}
+
+// writes the value of a modifiable field to the headers b
+func (h *Headers) putField(b []byte, field headerField, value uint64) {
+	f := b[h.offset[field]:]
+	switch field {
+	case fieldSrcMAC, fieldDstMAC:
+		var mac [8]byte
+		binary.BigEndian.PutUint64(mac[:], value)
+		copy(f, mac[2:])
+	case fieldVLAN, fieldInnerVLAN:
+		// keep priority and drop eligible indicator
+		tci := binary.BigEndian.Uint16(f)
+		binary.BigEndian.PutUint16(f, tci&^0xfff|uint16(value))
+	case fieldMPLS:
+		// keep traffic class, bottom of stack flag and TTL
+		word := binary.BigEndian.Uint32(f)
+		binary.BigEndian.PutUint32(f, word&0xfff|uint32(value)<<12)
+	case fieldSrcIP, fieldDstIP:
+		if h.isIPv4 {
+			binary.BigEndian.PutUint32(f, uint32(value))
+		} else {
+			binary.BigEndian.PutUint64(f, value)
+		}
+	case fieldSrcPort, fieldDstPort:
+		binary.BigEndian.PutUint16(f, uint16(value))
+	}
+}
+
+// returns the sum of the 16 bit words of b (even length)
+func sum16(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	return sum
+}
+
+// returns the internet checksum of b (even length), csum is added to the sum
+// of its 16 bit words
+func checksum(b []byte, csum uint32) uint16 {
+	csum += sum16(b)
+	for csum > 0xffff {
+		csum = csum>>16 + csum&0xffff
+	}
+	return ^uint16(csum)
+}
+
+// returns the modified field value
+func (m *modifier) apply(rnd *rand.Rand, value uint64, width uint) uint64 {
+	var offset uint64
+	switch m.mode {
+	case modeIncrement:
+		offset = m.n
+		if m.count > 0 {
+			offset %= m.count
+		}
+		offset *= m.step
+	case modeRandom:
+		offset = uint64(rnd.Int63n(int64(m.count))) * m.step
+	case modeList:
+		value = m.values[m.n%uint64(len(m.values))]
+	}
+	m.n++
+
+	// wrap around at the field width
+	value += offset
+	if width < 64 {
+		value &= 1<<width - 1
+	}
+	return value
+}
+
+func macToUint(mac net.HardwareAddr) uint64 {
+	var b [8]byte
+	copy(b[2:], mac)
+	return binary.BigEndian.Uint64(b[:])
+}
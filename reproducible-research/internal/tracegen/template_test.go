@@ -0,0 +1,275 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the packet header templates.
+
+package tracegen
+
+import (
+	"bytes"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// decodes the headers hdrs of a packet of length wireLen (without FCS).
+// gopacket may fail to decode the zero payload based on the port numbers,
+// only the headers up to the transport layer must be valid
+func decodeHeaders(t *testing.T, hdrs []byte, wireLen int) gopacket.Packet {
+	data := make([]byte, wireLen)
+	copy(data, hdrs)
+	pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet,
+		gopacket.Default)
+	if pkt.TransportLayer() == nil {
+		t.Fatalf("invalid headers %x", hdrs)
+	}
+	return pkt
+}
+
+func TestHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl HeaderTemplate
+	}{
+		{"ipv4 udp", HeaderTemplate{
+			SrcMAC: "02:00:00:00:00:01", DstMAC: "02:00:00:00:00:02",
+			SrcIP: "10.0.0.1", DstIP: "10.0.0.2",
+			SrcPort: 1000, DstPort: 2000,
+			Modifiers: []FieldModifier{
+				{Field: "src_ip", Mode: "increment", Count: 100},
+				{Field: "dst_port", Mode: "random", Count: 5000},
+				{Field: "src_mac", Mode: "increment", Step: 3},
+			},
+		}},
+		{"qinq ipv6 tcp", HeaderTemplate{
+			SrcMAC: "02:00:00:00:00:01", DstMAC: "02:00:00:00:00:02",
+			VLANs: []int{100, 200}, SrcIP: "fd00::1",
+			DstIP: "fd00::ffff:ffff:ffff:fff0", Proto: "tcp",
+			SrcPort: 65535, DstPort: 80, TTL: 3,
+			Modifiers: []FieldModifier{
+				{Field: "dst_ip", Mode: "increment", Count: 100},
+				{Field: "vlan", Mode: "list", Values: []string{"1", "4095"}},
+				{Field: "inner_vlan", Mode: "random", Count: 4096},
+				{Field: "src_port", Mode: "increment"},
+			},
+		}},
+		{"vlan mpls ipv4 tcp", HeaderTemplate{
+			SrcMAC: "ff:ff:ff:ff:ff:ff", DstMAC: "02:00:00:00:00:02",
+			VLANs: []int{7}, MPLS: []int{1048575, 16},
+			SrcIP: "192.168.1.1", DstIP: "255.255.255.255", Proto: "tcp",
+			Modifiers: []FieldModifier{
+				{Field: "mpls", Mode: "increment", Step: 7},
+				{Field: "dst_mac", Mode: "list",
+					Values: []string{"00:00:00:00:00:00",
+						"ff:ff:ff:ff:ff:fe"}},
+				{Field: "src_ip", Mode: "random", Count: 1 << 20},
+			},
+		}},
+		{"mpls ipv6 udp", HeaderTemplate{
+			SrcMAC: "02:00:00:00:00:01", DstMAC: "02:00:00:00:00:02",
+			MPLS: []int{5}, SrcIP: "::1", DstIP: "::2",
+			SrcPort: 1, DstPort: 2,
+			Modifiers: []FieldModifier{
+				{Field: "src_port", Mode: "random", Count: 65536},
+				{Field: "dst_port", Mode: "random", Count: 65536},
+			},
+		}},
+	}
+
+	serializeOpts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := test.tmpl.Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the patched headers must equal the headers gopacket
+			// serializes from the decoded layers
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				wireLen := h.Len() + rnd.Intn(PktlenMax-4-h.Len()+1)
+				hdrs, err := h.Next(rnd, wireLen)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(hdrs) != h.Len() {
+					t.Fatalf("%d bytes of headers, expected %d", len(hdrs),
+						h.Len())
+				}
+
+				pkt := decodeHeaders(t, hdrs, wireLen)
+				var serializable []gopacket.SerializableLayer
+				for _, layer := range pkt.Layers() {
+					serializable = append(serializable,
+						layer.(gopacket.SerializableLayer))
+					if layer == pkt.TransportLayer() {
+						break
+					}
+				}
+				udp, isUDP := pkt.TransportLayer().(*layers.UDP)
+				switch l := pkt.TransportLayer().(type) {
+				case *layers.UDP:
+					l.SetNetworkLayerForChecksum(pkt.NetworkLayer())
+				case *layers.TCP:
+					l.SetNetworkLayerForChecksum(pkt.NetworkLayer())
+				}
+				serializable = append(serializable,
+					gopacket.Payload(make([]byte, wireLen-h.Len())))
+				buf := gopacket.NewSerializeBuffer()
+				err = gopacket.SerializeLayers(buf, serializeOpts,
+					serializable...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// gopacket does not transmit a computed zero UDP checksum
+				// as all ones
+				if isUDP && udp.Checksum == 0 {
+					off := h.Len() - 2
+					buf.Bytes()[off], buf.Bytes()[off+1] = 0xff, 0xff
+				}
+				if !bytes.Equal(hdrs, buf.Bytes()[:h.Len()]) {
+					t.Fatalf("packet %d (%d bytes): headers %x, expected "+
+						"%x", i, wireLen, hdrs, buf.Bytes()[:h.Len()])
+				}
+			}
+		})
+	}
+}
+
+func TestHeadersUDPChecksumZero(t *testing.T) {
+	tmpl := HeaderTemplate{
+		SrcMAC: "02:00:00:00:00:01", DstMAC: "02:00:00:00:00:02",
+		SrcIP: "10.0.0.1", DstIP: "10.0.0.2", DstPort: 2000,
+		Modifiers: []FieldModifier{
+			{Field: "src_port", Mode: "increment", Count: 65536},
+		},
+	}
+	h, err := tmpl.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one of the source ports results in a computed zero checksum, which
+	// must be transmitted as all ones
+	rnd := rand.New(rand.NewSource(1))
+	var nAllOnes int
+	for i := 0; i < 65536; i++ {
+		hdrs, err := h.Next(rnd, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		udp := decodeHeaders(t, hdrs, 64).TransportLayer().(*layers.UDP)
+		switch udp.Checksum {
+		case 0x0000:
+			t.Fatalf("source port %d: zero checksum", udp.SrcPort)
+		case 0xffff:
+			nAllOnes++
+		}
+	}
+	if nAllOnes == 0 {
+		t.Error("no checksum transmitted as all ones")
+	}
+}
+
+func TestHeaderModifiers(t *testing.T) {
+	tmpl := HeaderTemplate{
+		SrcMAC: "02:00:00:00:00:fe", DstMAC: "02:00:00:00:00:01",
+		VLANs: []int{4094}, MPLS: []int{1048574, 16},
+		SrcIP: "10.0.0.255", DstIP: "10.0.1.1",
+		SrcPort: 1000, DstPort: 2000,
+		Modifiers: []FieldModifier{
+			{Field: "src_mac", Mode: "increment", Count: 3},
+			{Field: "vlan", Mode: "increment"},
+			{Field: "mpls", Mode: "increment", Step: 2},
+			{Field: "src_ip", Mode: "increment", Count: 2},
+			{Field: "dst_port", Mode: "list", Values: []string{"80", "443"}},
+		},
+	}
+
+	expected := []struct {
+		srcMAC  string
+		vlan    uint16
+		label   uint32
+		srcIP   string
+		dstPort layers.UDPPort
+	}{
+		{"02:00:00:00:00:fe", 4094, 1048574, "10.0.0.255", 80},
+		{"02:00:00:00:00:ff", 4095, 0, "10.0.1.0", 443},
+		{"02:00:00:00:01:00", 0, 2, "10.0.0.255", 80},
+		{"02:00:00:00:00:fe", 1, 4, "10.0.1.0", 443},
+	}
+
+	h, err := tmpl.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i, e := range expected {
+		hdrs, err := h.Next(rnd, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkt := decodeHeaders(t, hdrs, 100)
+
+		eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		vlan := pkt.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+		ip := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		udp := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if eth.SrcMAC.String() != e.srcMAC || vlan.VLANIdentifier != e.vlan ||
+			!ip.SrcIP.Equal(net.ParseIP(e.srcIP)) || udp.DstPort != e.dstPort {
+			t.Errorf("packet %d: %s %d %s %d, expected %s %d %s %d", i,
+				eth.SrcMAC, vlan.VLANIdentifier, ip.SrcIP, udp.DstPort,
+				e.srcMAC, e.vlan, e.srcIP, e.dstPort)
+		}
+
+		// only the top label of the stack is modified
+		var labels []uint32
+		for _, layer := range pkt.Layers() {
+			if mpls, ok := layer.(*layers.MPLS); ok {
+				labels = append(labels, mpls.Label)
+			}
+		}
+		if len(labels) != 2 || labels[0] != e.label || labels[1] != 16 {
+			t.Errorf("packet %d: MPLS labels %v, expected [%d 16]", i,
+				labels, e.label)
+		}
+
+		// unmodified fields keep their template values
+		if eth.DstMAC.String() != "02:00:00:00:00:01" ||
+			udp.SrcPort != 1000 || ip.TTL != 64 {
+			t.Errorf("packet %d: unmodified fields changed", i)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Package tracegen generates traces in the hardware trace format. All random
+// generators draw from an explicitly seeded private random number generator,
+// so the same seed always yields a byte-identical trace.
+
+package tracegen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/aoeldemann/gofluent10g"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Data is a trace in the hardware trace format
+type Data struct {
+	// trace data (meta data + packet data of all packets, 64 byte aligned)
+	Buf []byte
+
+	// number of packets in the trace
+	NumPackets int
+
+	// replay duration of the trace
+	Duration time.Duration
+
+	// statistics of the flows of traces generated by GenFlows, nil for
+	// other traces
+	Flows []FlowStats
+}
+
+// Generator generates a trace drawing random numbers from rnd
+type Generator func(rnd *rand.Rand) (*Data, error)
+
+// Generate runs the generator gen with a random number generator seeded with
+// seed
+func Generate(gen Generator, seed int64) (*Data, error) {
+	return gen(rand.New(rand.NewSource(seed)))
+}
+
+// CheckReproducible generates the trace again with the same seed and makes
+// sure it is byte-identical to data
+func CheckReproducible(gen Generator, seed int64, data *Data) error {
+	regen, err := Generate(gen, seed)
+	if err != nil {
+		return err
+	}
+	if regen.NumPackets != data.NumPackets ||
+		!bytes.Equal(regen.Buf, data.Buf) {
+		return errors.New("regenerated trace differs from original trace")
+	}
+	return nil
+}
+
+// Trace creates a gofluent10g trace replayed once
+func (data *Data) Trace() *gofluent10g.Trace {
+	return data.TraceReplays(1)
+}
+
+// TraceReplays creates a gofluent10g trace replayed nReplays times
+func (data *Data) TraceReplays(nReplays int) *gofluent10g.Trace {
+	return gofluent10g.TraceCreateFromData(data.Buf, data.NumPackets,
+		data.Duration, nReplays)
+}
+
+// Checksum returns the SHA-256 hash of the trace data as hex string
+func (data *Data) Checksum() string {
+	sum := sha256.Sum256(data.Buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// CycleRounder rounds floating-point inter-packet clock cycles to integer
+// values.
+//
+// the number of clock cycles between two packets is a floating-point
+// number, but clock cycles must always be integer values. If we always round
+// up we are sending too slow, if we always round down we are sending too
+// fast. Sending too fast at full line-rate causes timing errors (we cannot
+// send faster than 10 Gbps!). We start by rounding up and accumulate the
+// resulting rounding error. If the accumulated error becomes larger than one
+// full clock cycle, we round down and decrease the accumulated error. On
+// average we will hit the target mean data rate.
+type CycleRounder struct {
+	accErr float64
+}
+
+// Round returns the rounded number of clock cycles
+func (r *CycleRounder) Round(cycles float64) uint64 {
+	if r.accErr < 1.0 {
+		// not enough rounding error accumulated yet -> round up
+		r.accErr += math.Ceil(cycles) - cycles
+		return uint64(math.Ceil(cycles))
+	}
+
+	// enough rounding error accumulated -> round down
+	r.accErr -= cycles - math.Floor(cycles)
+	return uint64(math.Floor(cycles))
+}
+
+// maximum inter-packet time supported by the hardware (2**32-1 clock cycles)
+const tInterPacketMax = CyclesInterPacketMax / gofluent10g.FREQ_SFP
+
+// returns the time it takes to transmit a packet of length lenWire (without
+// FCS) at 10 Gbps. add 24 bytes for FCS, preamble, SOD and inter-frame gap
+func tTransfer(lenWire int) float64 {
+	return float64(8*(lenWire+24)) / 10e9
+}
+
+// converts a number of clock cycles to time
+func cyclesDuration(cycles uint64) time.Duration {
+	return time.Duration(float64(cycles) / gofluent10g.FREQ_SFP * 1e9)
+}
+
+func round(x float64) int {
+	return int(math.Floor(x + 0.5))
+}
@@ -0,0 +1,183 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of reproducible trace generation.
+
+package tracegen
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCheckReproducible(t *testing.T) {
+	tests := []struct {
+		name    string
+		traffic Traffic
+	}{
+		{"uniform", Traffic{}},
+		{"imix", Traffic{Pktlens: mustParsePktlenDist(t, "imix")}},
+		{"pareto", Traffic{Gaps: GapPareto{Alpha: 1.5}}},
+		{"seq tag", Traffic{SeqTag: &SeqTag{Offset: 34, FlowID: 7}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.traffic.Datarate = 5e9
+			test.traffic.CaptureLen = 34
+			test.traffic.Duration = time.Millisecond
+			if test.traffic.SeqTag != nil {
+				test.traffic.CaptureLen += SeqTagLen
+			}
+			gen := GenTraffic(test.traffic)
+
+			data, err := Generate(gen, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.NumPackets == 0 {
+				t.Fatal("no packets generated")
+			}
+
+			// regenerate from the same seed and compare byte by byte
+			regen, err := Generate(gen, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(regen.Buf, data.Buf) {
+				t.Error("regenerated trace differs")
+			}
+			if err := CheckReproducible(gen, 42, data); err != nil {
+				t.Error(err)
+			}
+
+			// a different seed yields a different trace
+			if err := CheckReproducible(gen, 43, data); err == nil {
+				t.Error("trace of seed 43 matches trace of seed 42")
+			}
+		})
+	}
+}
+
+func TestGenTrafficError(t *testing.T) {
+	tests := []struct {
+		name       string
+		captureLen int
+		seqTag     *SeqTag
+	}{
+		{"sequence tag beyond the transferred bytes", 34,
+			&SeqTag{Offset: 34}},
+		{"sequence tag overlaps the headers", 60, &SeqTag{Offset: 20}},
+		{"sequence tag at odd offset", 60, &SeqTag{Offset: 35}},
+	}
+
+	for _, test := range tests {
+		gen := GenTraffic(Traffic{
+			Datarate:   5e9,
+			CaptureLen: test.captureLen,
+			Duration:   time.Millisecond,
+			SeqTag:     test.seqTag,
+		})
+		if _, err := Generate(gen, 1); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestGenFlowsStats(t *testing.T) {
+	traffic := Traffic{Datarate: 1e9, CaptureLen: 34 + SeqTagLen}
+	flows := []Flow{
+		{Name: "a", Traffic: traffic},
+		{Name: "b", Traffic: traffic},
+	}
+	flows[1].Traffic.SeqTag = &SeqTag{Offset: 34, FlowID: 7}
+
+	data, err := Generate(GenFlows(flows, 10*time.Millisecond), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Flows) != 2 {
+		t.Fatalf("statistics of %d flows, expected 2", len(data.Flows))
+	}
+	if data.Flows[0].FlowID != nil || data.Flows[1].FlowID == nil ||
+		*data.Flows[1].FlowID != 7 {
+		t.Error("invalid flow IDs")
+	}
+	if n := data.Flows[0].NumPackets + data.Flows[1].NumPackets; n == 0 ||
+		n != data.NumPackets {
+		t.Errorf("flows hold %d packets, trace holds %d", n,
+			data.NumPackets)
+	}
+
+	// traces of a single flow do not carry statistics
+	data, err = Generate(GenTraffic(Traffic{
+		Datarate:   1e9,
+		CaptureLen: 34,
+		Duration:   time.Millisecond,
+	}), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Flows != nil {
+		t.Error("statistics of a single flow trace")
+	}
+}
+
+func TestGenFlowsError(t *testing.T) {
+	traffic := Traffic{Datarate: 1e9, CaptureLen: 34}
+	tests := []struct {
+		name  string
+		flows []Flow
+	}{
+		{"no flows", nil},
+		{"stop before start", []Flow{
+			{Name: "a", Traffic: traffic, Start: 2 * time.Millisecond,
+				Stop: time.Millisecond},
+		}},
+		{"sequence tag beyond the transferred bytes", []Flow{
+			{Name: "a", Traffic: traffic},
+			{Name: "b", Traffic: Traffic{Datarate: 1e9, CaptureLen: 34,
+				SeqTag: &SeqTag{Offset: 34}}},
+		}},
+	}
+
+	for _, test := range tests {
+		gen := GenFlows(test.flows, 10*time.Millisecond)
+		if _, err := Generate(gen, 1); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func mustParsePktlenDist(t *testing.T, s string) *PktlenDist {
+	dist, err := ParsePktlenDist(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dist
+}
@@ -0,0 +1,94 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Merges latency histogram files (e.g. of several runs or receiver
+// interfaces) into one histogram, optionally with a different binning, and
+// writes the merged histogram and/or its cumulative distribution. Does not
+// require any hardware.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/datfile"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"os"
+)
+
+func main() {
+	binningSpec := flag.String("binning", "", "binning of the merged "+
+		"histogram, e.g. clock:cycles=2 or log:bins=100 (default: bins of "+
+		"the input files)")
+	out := flag.String("out", "", "write merged histogram to file")
+	cdf := flag.String("cdf", "", "write cumulative distribution to file")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <histogram file>...\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*out == "" && *cdf == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	binning, err := stats.ParseBinning(*binningSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	hist := stats.HistogramCreate(binning)
+	for _, filename := range flag.Args() {
+		bins, err := datfile.ReadHistogram(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		for _, bin := range bins {
+			hist.AddCount(bin.Latency, bin.Occurrences)
+		}
+	}
+
+	if *out != "" {
+		if err := hist.WriteFile(*out); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if *cdf != "" {
+		if err := hist.WriteCDFFile(*cdf); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("merged %d files: %d packets in %d bins\n", flag.NArg(),
+		hist.Count(), len(hist.Bins()))
+}
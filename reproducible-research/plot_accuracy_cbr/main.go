@@ -31,175 +31,169 @@ package main
 
 import (
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/harness"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
 	"os"
-	"sort"
+	"path/filepath"
 	"time"
 )
 
 var (
-	// measurement data rates
-	datarates = []float64{100e6, 1e9, 5e9, 10e9}
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// measurement data rates
+		Datarates: []float64{100e6, 1e9, 5e9, 10e9},
 
-	// meausrement packet sizes
-	pktlens = []int{64, 1518}
+		// meausrement packet sizes
+		Pktlens: []int{64, 1518},
 
-	// generator interface id
-	ifGen = 0
+		// generator interface id
+		IfGen: 0,
 
-	// receiver interface id
-	ifRecv = 1
+		// receiver interface id
+		IfRecv: 1,
 
-	// measurement duration
-	duration = 10 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// 24 bit timestamp at the beginning of the packet
+		Timestamp: config.Timestamp{Pos: 0, Width: 24},
+
+		// output directory
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagPktlens|cli.FlagDuration|
+		cli.FlagInterfaces|cli.FlagLatency|cli.FlagSaveCaptures)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
 
-	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
-	defer nt.Close()
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan().Print(os.Stdout)
+		return
+	}
 
-	// get generator and receivers
-	gen := nt.GetGenerator(ifGen)
-	recv := nt.GetReceiver(ifRecv)
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("plot_accuracy_cbr", &exp)
+	defer man.Close()
 
-	// enable packet capture on receiver interface. since we are only
-	// interested in packet latency, we disable the capturing of packet data
-	recv.EnableCapture(true)
-	recv.SetCaptureMaxLen(0)
+	// open network tester
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
+	defer nt.Close()
+	man.SetTester(nt)
 
 	// set up timestamping
 	nt.SetTimestampMode(gofluent10g.TimestampModeFixedPos)
-	nt.SetTimestampPos(0)
-	nt.SetTimestampWidth(24)
-
-	// iterate over all data rates
-	for i, datarate := range datarates {
-
-		// iterate over all packet sizes
-		for j, pktlen := range pktlens {
-			gofluent10g.Log(gofluent10g.LOG_INFO, "%d/%d: Datarate: %.2f bps, "+
-				"Packet length: %d", (i*len(pktlens) + j + 1),
-				len(datarates)*len(pktlens), datarate, pktlen)
-
-			gofluent10g.LogIncrementIndentLevel()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
-
-			// generate CBR trace data with fixed packet length. Trace duration
-			// is 10 seconds. we only transfer the first 34 bytes of each
-			// packet down to hardware (contains ethernet and ipv4 headers),
-			// hardware will append zero bytes before transmission to restore
-			// the original packet lengths
-			trace := utils.GenTraceCBR(datarate, pktlen, 34, duration, 1)
-
-			// assign trace to generator
-			gen.SetTrace(trace)
-
-			// calculate the host memory size we need to store the capture data.
-			// we only store meta data (8 byte) for each packet, no packet
-			// data
-			captureMemSize := uint64(trace.GetPacketCount()) * 8
-
-			// set receiver capture host memory size
-			recv.SetCaptureHostMemSize(captureMemSize)
-
-			// write config to hardware
-			nt.WriteConfig()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Starting replay and capture ...")
-
-			// start capturing
-			nt.StartCapture()
-
-			// start replay (blocks until replay finished)
-			nt.StartReplay()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Replay done")
-
-			// wait a little to make sure all packets have been captured
-			time.Sleep(time.Second)
-
-			// stop capturing
-			nt.StopCapture()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Capture done")
-
-			// get capture data structure
-			capture := recv.GetCapture()
-
-			// get captured packets
-			pkts := capture.GetPackets()
-
-			// make sure all generated packets arrived back at the receiver
-			if len(pkts) != trace.GetPacketCount() {
-				gofluent10g.Log(gofluent10g.LOG_ERR,
-					"not all generated packets arrived back at the receiver")
-			}
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Calculating latency statistics ...")
+	nt.SetTimestampPos(exp.Timestamp.Pos)
+	nt.SetTimestampWidth(exp.Timestamp.Width)
+
+	// create one measurement point for each data rate and packet size
+	var points []harness.Point
+	for _, datarate := range exp.Datarates {
+		for _, pktlen := range exp.Pktlens {
+			points = append(points, measurementPoint(datarate, pktlen))
+		}
+	}
 
-			// calculate latency mean and std dev
-			latencyMean := utils.CalcLatencyMean(pkts)
-			latencyStd := utils.CalcLatencyStdDev(pkts, latencyMean)
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "plot_accuracy_cbr",
+		exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
 
-			// sort packets in ascending latency order
-			sort.Sort(gofluent10g.CapturePacketsSortByLatency(pkts))
+	h := harness.Create(nt)
+	h.SetResultWriter(resultWriter)
+	if opts.SaveCaptures {
+		h.SetCaptureDir(exp.OutDir)
+	}
 
-			// calculate latency histogram
-			latencyHistogram, _ := utils.CalcLatencyHistogram(pkts)
+	// histogram binning has been validated with the configuration
+	binning, _ := stats.ParseBinning(exp.Histogram.Binning)
+	h.SetHistogram(binning, exp.Histogram.CDF)
+	h.SetLatencySeries(exp.LatencySeries.Packets,
+		exp.LatencySeries.WindowWidths())
 
-			// get minimum and maximum latency in nanoseconds
-			latencyMin := pkts[0].Latency * 1e9
-			latencyMax := pkts[len(pkts)-1].Latency * 1e9
+	h.RunAll(points)
+}
 
-			// calculate latency mean and stddev in nanoseconds
-			latencyMean *= 1e9
-			latencyStd *= 1e9
+func measurementPoint(datarate float64, pktlen int) harness.Point {
+	return harness.Point{
+		Name: fmt.Sprintf("Datarate: %.2f bps, Packet length: %d", datarate,
+			pktlen),
+
+		// generate CBR trace data with fixed packet length. we only transfer
+		// the first 34 bytes of each packet down to hardware (contains
+		// ethernet and ipv4 headers), hardware will append zero bytes before
+		// transmission to restore the original packet lengths
+		GenTrace: func() *gofluent10g.Trace {
+			return utils.GenTraceCBR(datarate, pktlen, 34,
+				exp.Duration.Duration, 1)
+		},
+
+		Params: map[string]interface{}{
+			"datarate": datarate,
+			"pktlen":   pktlen,
+		},
+
+		IfGen:  exp.IfGen,
+		IfRecv: exp.IfRecv,
+
+		// since we are only interested in packet latency, we disable the
+		// capturing of packet data
+		CaptureMaxLen: 0,
+
+		Analyze: func(res *harness.Result) {
+			// assemble output filename for this run
+			filename := filepath.Join(exp.OutDir,
+				fmt.Sprintf("histogram_%d_%d.dat", int(datarate), pktlen))
 
-			// output some infos
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Captured %d packets.", len(pkts))
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Min latency: %.2f ns",
-				latencyMin)
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Max latency: %.2f ns",
-				latencyMax)
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Mean latency: %.2f ns", latencyMean)
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Stddev latency: %.2f ns", latencyStd)
+			harness.WriteLatencyHistogram(res, filename)
+		},
+	}
+}
 
-			// assemble output filename for this run
-			filename := fmt.Sprintf("output/histogram_%d_%d.dat",
-				int(datarate), pktlen)
-
-			// open output file for writing
-			file, err := os.Create(filename)
-			if err != nil {
-				gofluent10g.Log(gofluent10g.LOG_ERR, "could not create file '%s'", filename)
-				return
-			}
-			defer file.Close()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO,
-				"Writing latency histogram to output file '%s' ...", filename)
-
-			// write historam values (after conversion to nanoseconds) to file
-			for _, elem := range latencyHistogram {
-				file.WriteString(fmt.Sprintf("%f %d\n", elem.Latency*1e9,
-					elem.Occurrences))
-			}
-
-			// reset pointers pointing to data we do not need anymore
-			trace = nil
-			capture = nil
-			pkts = nil
-
-			// free memory
-			nt.FreeHostMemory()
-
-			gofluent10g.LogDecrementIndentLevel()
+func measurementPlan() *plan.Plan {
+	p := &plan.Plan{}
+	for _, datarate := range exp.Datarates {
+		for _, pktlen := range exp.Pktlens {
+			p.Add(plan.Point{
+				Name: fmt.Sprintf("Datarate: %.2f bps, Packet length: %d",
+					datarate, pktlen),
+				Datarate:        datarate,
+				Pktlen:          pktlen,
+				TraceCaptureLen: 34,
+				NumGenerators:   1,
+				NumReceivers:    1,
+				CaptureMaxLen:   0,
+				Duration:        exp.Duration.Duration,
+				DrainTime:       harness.DrainTimeDefault,
+			})
 		}
 	}
+	return p
 }
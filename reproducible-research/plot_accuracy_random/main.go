@@ -31,176 +31,365 @@ package main
 
 import (
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/harness"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
 	"github.com/aoeldemann/gofluent10g"
-	"github.com/aoeldemann/gofluent10g/utils"
-	"math/rand"
 	"os"
-	"sort"
+	"path/filepath"
 	"time"
 )
 
 var (
-	// mean measurement data rates
-	dataratesMean = []float64{1e9, 5e9, 8e9}
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// mean measurement data rates
+		Datarates: []float64{1e9, 5e9, 8e9},
 
-	// generator interface id
-	ifGen = 0
+		// generator interface id
+		IfGen: 0,
 
-	// receiver interface id
-	ifRecv = 1
+		// receiver interface id
+		IfRecv: 1,
 
-	// measurement duration
-	duration = 10 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// 24 bit timestamp at the beginning of the packet
+		Timestamp: config.Timestamp{Pos: 0, Width: 24},
+
+		// output directory
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagDuration|
+		cli.FlagInterfaces|cli.FlagTraffic|cli.FlagSeqTag|cli.FlagLatency|
+		cli.FlagSaveTraces|cli.FlagLoadTraces|cli.FlagSaveCaptures|
+		cli.FlagCheckReproducible)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
 
-	// seed the random number generator
-	rand.Seed(time.Now().UTC().UnixNano())
+	// packet size distribution and gap model (uniform packet sizes and
+	// exponential gaps if not configured)
+	traffic, err := trafficConfig()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
 
-	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
-	defer nt.Close()
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan(traffic).Print(os.Stdout)
+		return
+	}
 
-	// get generator and receivers
-	gen := nt.GetGenerator(ifGen)
-	recv := nt.GetReceiver(ifRecv)
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("plot_accuracy_random", &exp)
+	defer man.Close()
 
-	// enable packet capture on receiver interface. since we are only
-	// interested in packet latency, we disable the capturing of packet data
-	recv.EnableCapture(true)
-	recv.SetCaptureMaxLen(0)
+	// open network tester
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
+	defer nt.Close()
+	man.SetTester(nt)
 
 	// set up timestamping
 	nt.SetTimestampMode(gofluent10g.TimestampModeFixedPos)
-	nt.SetTimestampPos(0)
-	nt.SetTimestampWidth(24)
-
-	// iterate over all mean data rates
-	for i, datarateMean := range dataratesMean {
-
-		gofluent10g.Log(gofluent10g.LOG_INFO, "%d/%d: Mean Datarate: %.2f bps",
-			i+1, len(dataratesMean), datarateMean)
-
-		gofluent10g.LogIncrementIndentLevel()
-
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
-
-		// generate random traffic trace with a given mean data rate. packet
-		// sizes are uniform distributed between 64 and 1518 bytes, frame
-		// is generated according to exponential distribution. We only transfer
-		// the first 34 bytes of each packet down to hardware (contains
-		// ethernet and ipv4 headers), hardware will append zero bytes before
-		// transmission to restore the original packet length
-		trace := utils.GenTraceRandom(datarateMean, 34, duration, 1)
-
-		// assign trace to generator
-		gen.SetTrace(trace)
-
-		// calculate the host memory size we need to store the capture data.
-		// we only store meta data (8 byte) for each packet, no packet
-		// data
-		captureMemSize := uint64(trace.GetPacketCount()) * 8
-
-		// set receiver capture host memory size
-		recv.SetCaptureHostMemSize(captureMemSize)
-
-		// write config to hardware
-		nt.WriteConfig()
+	nt.SetTimestampPos(exp.Timestamp.Pos)
+	nt.SetTimestampWidth(exp.Timestamp.Width)
+
+	// create one measurement point for each mean data rate
+	var points []harness.Point
+	for i, datarateMean := range exp.Datarates {
+		// each measurement point draws its trace from a random number
+		// generator with its own seed
+		traffic.Datarate = datarateMean
+		points = append(points, measurementPoint(traffic,
+			exp.Seed+int64(i), opts))
+	}
 
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Starting replay and capture ...")
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "plot_accuracy_random",
+		exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
 
-		// start capturing
-		nt.StartCapture()
+	h := harness.Create(nt)
+	h.SetResultWriter(resultWriter)
+	if opts.SaveCaptures {
+		h.SetCaptureDir(exp.OutDir)
+	}
 
-		// start replay (blocks until replay finished)
-		nt.StartReplay()
+	// histogram binning has been validated with the configuration
+	binning, _ := stats.ParseBinning(exp.Histogram.Binning)
+	h.SetHistogram(binning, exp.Histogram.CDF)
+	h.SetLatencySeries(exp.LatencySeries.Packets,
+		exp.LatencySeries.WindowWidths())
 
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Replay done")
+	h.RunAll(points)
+}
 
-		// wait a little to make sure all packets have been captured
-		time.Sleep(time.Second)
+// returns the random traffic configuration without data rate. We only
+// transfer the first 34 bytes of each packet down to hardware (contains
+// ethernet and ipv4 headers) or the headers of the configured header
+// template, hardware will append zero bytes before transmission to restore
+// the original packet length
+func trafficConfig() (tracegen.Traffic, error) {
+	traffic := tracegen.Traffic{
+		CaptureLen: tracegen.HeadersLenDefault,
+		Duration:   exp.Duration.Duration,
+		Headers:    exp.Headers,
+	}
 
-		// stop capturing
-		nt.StopCapture()
+	// configuration has been validated before
+	var err error
+	if exp.PktlenDist != "" {
+		traffic.Pktlens, err = tracegen.ParsePktlenDist(exp.PktlenDist)
+	}
+	if err == nil && exp.GapModel != "" {
+		traffic.Gaps, err = tracegen.ParseGapModel(exp.GapModel)
+	}
+	if err == nil && exp.Headers != nil {
+		var headers *tracegen.Headers
+		headers, err = exp.Headers.Compile()
+		if err == nil {
+			traffic.CaptureLen = headers.Len()
+		}
+	}
+	if err != nil {
+		return traffic, err
+	}
 
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Capture done")
+	// sequence tags directly follow the headers by default. the tag is
+	// transferred to the hardware as well
+	if exp.SeqTag.Enabled {
+		offset, err := exp.SeqTagOffset()
+		if err != nil {
+			return traffic, err
+		}
+		traffic.SeqTag = &tracegen.SeqTag{Offset: offset}
+		if traffic.CaptureLen < offset+tracegen.SeqTagLen {
+			traffic.CaptureLen = offset + tracegen.SeqTagLen
+		}
+	}
 
-		// get capture data structure
-		capture := recv.GetCapture()
+	return traffic, nil
+}
 
-		// get captured packets
-		pkts := capture.GetPackets()
+// returns the number of bytes captured per packet. since we are only
+// interested in packet latency, we disable the capturing of packet data
+// unless packets carry sequence tags
+func captureMaxLen(traffic tracegen.Traffic) int {
+	if traffic.SeqTag != nil {
+		return traffic.CaptureLen
+	}
+	return 0
+}
 
-		// make sure all generated packets arrived back at the receiver
-		if len(pkts) != trace.GetPacketCount() {
-			gofluent10g.Log(gofluent10g.LOG_ERR,
-				"not all generated packets arrived back at the receiver")
-		}
+func measurementPoint(traffic tracegen.Traffic, seed int64,
+	opts *cli.Options) harness.Point {
+	datarateMean := traffic.Datarate
 
-		gofluent10g.Log(gofluent10g.LOG_INFO,
-			"Calculating latency statistics ...")
+	// file the trace is saved to or loaded from
+	traceFilename := filepath.Join(exp.OutDir,
+		fmt.Sprintf("trace_%d.bin", int(datarateMean)))
 
-		// calculate latency mean and std dev
-		latencyMean := utils.CalcLatencyMean(pkts)
-		latencyStd := utils.CalcLatencyStdDev(pkts, latencyMean)
+	// checksum of the generated or loaded trace data
+	var traceChecksum string
 
-		// sort packets in ascending latency order
-		sort.Sort(gofluent10g.CapturePacketsSortByLatency(pkts))
+	// memory mapping of the loaded trace (see --load-traces)
+	var mappedTrace *tracegen.MappedTrace
 
-		// calculate latency histogram
-		latencyHistogram, _ := utils.CalcLatencyHistogram(pkts)
+	params := map[string]interface{}{
+		"datarate_mean": datarateMean,
+		"seed":          seed,
+	}
+	if traffic.Pktlens != nil {
+		params["pktlen_dist"] = traffic.Pktlens.String()
+	}
+	if traffic.Gaps != nil {
+		params["gap_model"] = traffic.Gaps.String()
+	}
+	if traffic.Headers != nil {
+		params["headers"] = traffic.Headers
+	}
+	if traffic.SeqTag != nil {
+		params["seq_tag_offset"] = traffic.SeqTag.Offset
+	}
 
-		// get minimum and maximum latency in nanoseconds
-		latencyMin := pkts[0].Latency * 1e9
-		latencyMax := pkts[len(pkts)-1].Latency * 1e9
+	return harness.Point{
+		Name: fmt.Sprintf("Mean Datarate: %.2f bps", datarateMean),
 
-		// calculate latency mean and stddev in nanoseconds
-		latencyMean *= 1e9
-		latencyStd *= 1e9
+		// generate random traffic trace with a given mean data rate. packet
+		// sizes are uniform distributed between 64 and 1518 bytes (or drawn
+		// from the configured packet size distribution), frame is generated
+		// according to exponential distribution (or the configured gap
+		// model)
+		GenTraceData: func() (*tracegen.Data, int) {
+			gen := tracegen.GenTraffic(traffic)
+
+			var data *tracegen.Data
+			nReplays := 1
+			if opts.LoadTraces {
+				mappedTrace = loadTrace(traceFilename, seed, datarateMean)
+				data = mappedTrace.Data
+				nReplays = mappedTrace.Meta.ReplayCount
+				traceChecksum = mappedTrace.Meta.Checksum
+			} else {
+				var err error
+				data, err = tracegen.Generate(gen, seed)
+				if err != nil {
+					gofluent10g.Log(gofluent10g.LOG_ERR, "could not "+
+						"generate trace: %s", err.Error())
+				}
+				traceChecksum = data.Checksum()
+			}
+
+			// make sure the trace can be regenerated from the seed. loaded
+			// traces must match the trace generated by this version
+			if opts.CheckReproducible {
+				err := tracegen.CheckReproducible(gen, seed, data)
+				if err != nil {
+					gofluent10g.Log(gofluent10g.LOG_ERR, "trace for seed "+
+						"%d is not reproducible: %s", seed, err.Error())
+				}
+				gofluent10g.Log(gofluent10g.LOG_INFO, "Regenerated trace "+
+					"is byte-identical")
+			}
+
+			// save trace for inspection (see inspect_trace) or to replay it
+			// later on (see --load-traces)
+			if opts.SaveTraces && !opts.LoadTraces {
+				err := data.Save(traceFilename, tracegen.Meta{
+					Seed:   seed,
+					Params: params,
+				})
+				if err != nil {
+					gofluent10g.Log(gofluent10g.LOG_ERR, "could not save "+
+						"trace to '%s': %s", traceFilename, err.Error())
+				}
+			}
+
+			return data, nReplays
+		},
+
+		Params: params,
+
+		IfGen:  exp.IfGen,
+		IfRecv: exp.IfRecv,
+
+		CaptureMaxLen: captureMaxLen(traffic),
+
+		// check captured packets for loss, reordering and duplication
+		SeqTag: traffic.SeqTag,
+
+		Analyze: func(res *harness.Result) {
+			// the trace can be regenerated from the seed, record its
+			// checksum to be able to verify it
+			res.Record.Params["trace_sha256"] = traceChecksum
+
+			// assemble output filename for this run
+			filename := filepath.Join(exp.OutDir,
+				fmt.Sprintf("histogram_%d.dat", int(datarateMean)))
+
+			harness.WriteLatencyHistogram(res, filename)
+		},
+
+		// the loaded trace has been replayed, release its mapping
+		Release: func() {
+			if mappedTrace != nil {
+				mappedTrace.Close()
+				mappedTrace = nil
+			}
+		},
+	}
+}
 
-		// output some infos
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Captured %d packets.", len(pkts))
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Min latency: %.2f ns",
-			latencyMin)
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Max latency: %.2f ns",
-			latencyMax)
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Mean latency: %.2f ns",
-			latencyMean)
-		gofluent10g.Log(gofluent10g.LOG_INFO, "Stddev latency: %.2f ns",
-			latencyStd)
+// maps a trace saved with --save-traces into memory (see tracegen.LoadMmap).
+// The program aborts if the trace data does not match its checksum or if the
+// trace has not been generated for the seed and data rate of the measurement
+// point
+func loadTrace(filename string, seed int64,
+	datarateMean float64) *tracegen.MappedTrace {
+	mappedTrace, err := tracegen.LoadMmap(filename)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not load trace: %s",
+			err.Error())
+	}
+	meta := mappedTrace.Meta
 
-		// assemble output filename for this run
-		filename := fmt.Sprintf("output/histogram_%d.dat", int(datarateMean))
+	// the checksum of the trace data is recorded in the result record,
+	// make sure the data has not been corrupted since it has been saved
+	if err := meta.Verify(mappedTrace.Data); err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "trace '%s' is corrupted: %s",
+			filename, err.Error())
+	}
 
-		// open output file for writing
-		file, err := os.Create(filename)
-		if err != nil {
-			gofluent10g.Log(gofluent10g.LOG_ERR, "could not create file '%s'",
-				filename)
-			return
-		}
-		defer file.Close()
+	datarateMeanSaved, _ := meta.Params["datarate_mean"].(float64)
+	if meta.Seed != seed || datarateMeanSaved != datarateMean {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "trace '%s' has been generated "+
+			"for seed %d and mean data rate %.2f bps, expected seed %d and "+
+			"mean data rate %.2f bps", filename, meta.Seed,
+			datarateMeanSaved, seed, datarateMean)
+	}
 
-		gofluent10g.Log(gofluent10g.LOG_INFO,
-			"Writing latency histogram to output file '%s' ...", filename)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Loaded trace '%s' (%d packets, "+
+		"replayed %d times)", filename, mappedTrace.Data.NumPackets,
+		meta.ReplayCount)
 
-		// write historam values (after conversion to nanoseconds) to file
-		for _, elem := range latencyHistogram {
-			file.WriteString(fmt.Sprintf("%f %d\n", elem.Latency*1e9,
-				elem.Occurrences))
-		}
+	return mappedTrace
+}
 
-		// reset pointers pointing to data we do not need anymore
-		trace = nil
-		capture = nil
-		pkts = nil
+func measurementPlan(traffic tracegen.Traffic) *plan.Plan {
+	// packet sizes are uniformly distributed between 64 and 1518 bytes if no
+	// packet size distribution is configured
+	pktlenMean := (64 + 1518) / 2
+	if traffic.Pktlens != nil {
+		pktlenMean = int(traffic.Pktlens.Mean() + 0.5)
+	}
 
-		// free memory
-		nt.FreeHostMemory()
+	// gaps are exponentially distributed if no gap model is configured
+	var gaps tracegen.GapModel = tracegen.GapExponential{}
+	if traffic.Gaps != nil {
+		gaps = traffic.Gaps
+	}
 
-		gofluent10g.LogDecrementIndentLevel()
+	p := &plan.Plan{}
+	for _, datarateMean := range exp.Datarates {
+		p.Add(plan.Point{
+			Name: fmt.Sprintf("Mean Datarate: %.2f bps",
+				datarateMean),
+			Datarate:        datarateMean,
+			Pktlen:          pktlenMean,
+			Gaps:            gaps,
+			TraceCaptureLen: traffic.CaptureLen,
+			NumGenerators:   1,
+			NumReceivers:    1,
+			CaptureMaxLen:   captureMaxLen(traffic),
+			Duration:        exp.Duration.Duration,
+			DrainTime:       harness.DrainTimeDefault,
+		})
 	}
+	return p
 }
@@ -0,0 +1,107 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Renders the figures of all measurement programs from the result files in
+// their output (or, with --ref, output_ref) directories. Figures are written
+// to the output directory of this program, one file per measurement program.
+// Programs whose result files have not been generated are skipped.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/figures"
+	"gonum.org/v1/plot/vg"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	root := flag.String("root", "..",
+		"directory containing the measurement programs")
+	ref := flag.Bool("ref", false,
+		"plot the reference data located in the output_ref directories")
+	format := flag.String("format", "svg",
+		"output file format (svg, png or pdf)")
+	outDir := flag.String("out-dir", "output", "output directory")
+	width := flag.Float64("width", 16.0, "figure width in cm")
+	rowHeight := flag.Float64("row-height", 6.0,
+		"height of each row of plots in cm")
+	flag.Parse()
+
+	switch *format {
+	case "svg", "png", "pdf":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid output format '%s'\n", *format)
+		os.Exit(1)
+	}
+
+	// plotting data that the user generated or the data that we provide?
+	dataDirName := "output"
+	suffix := ""
+	if *ref {
+		dataDirName = "output_ref"
+		suffix = "_ref"
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "could not create output directory: %s\n",
+			err.Error())
+		os.Exit(1)
+	}
+
+	nFailed := 0
+	for _, fig := range figures.Figures {
+		dataDir := filepath.Join(*root, fig.Dir, dataDirName)
+
+		plots, err := fig.Plot(dataDir)
+		if err == figures.ErrNoData || os.IsNotExist(err) {
+			fmt.Printf("SKIP %s: no data found in %s\n", fig.Dir, dataDir)
+			continue
+		} else if err != nil {
+			fmt.Printf("FAIL %s: %s\n", fig.Dir, err.Error())
+			nFailed++
+			continue
+		}
+
+		filename := filepath.Join(*outDir, fig.Dir+suffix+"."+*format)
+		err = figures.Save(plots, vg.Length(*width)*vg.Centimeter,
+			vg.Length(*rowHeight)*vg.Centimeter, filename)
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", fig.Dir, err.Error())
+			nFailed++
+			continue
+		}
+
+		fmt.Printf("OK   %s: %s\n", fig.Dir, filename)
+	}
+
+	if nFailed > 0 {
+		os.Exit(1)
+	}
+}
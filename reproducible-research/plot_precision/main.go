@@ -32,47 +32,115 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"io"
 	"math"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 var (
-	// target mean data rate
-	datarateMean = 8e9
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// target mean data rate
+		Datarates: []float64{8e9},
 
-	// measurement duration
-	duration = 60 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 60 * time.Second},
 
-	// time between to PTP packet burst insertions
-	ptpInterval = 75 * time.Microsecond
+		// time between to PTP packet burst insertions
+		PTPInterval: config.Duration{Duration: 75 * time.Microsecond},
+
+		// output directory
+		OutDir: "output",
+	}
 )
 
-func genTrace() (*gofluent10g.Trace, []float64) {
+// packet source of the precision measurement trace: random traffic with
+// uniformly distributed packet sizes and exponentially distributed
+// inter-packet gaps, every ptpInterval a burst of four packets is replaced by
+// PTP packets
+type ptpSource struct {
+	rnd *rand.Rand
+
+	// packet length is uniformly distributed between pktlenMin and pktlenMax
+	pktlenMin int
+	pktlenMax int
+
+	// mean time of the gap between two packets
+	tGapMean float64
+
+	// number of packets to generate and number of packets generated so far
+	nPkts int
+	i     int
+
+	// packet data transferred to the hardware
+	bufPktData []byte
+
+	// rounds inter-packet clock cycles to integer values (see
+	// tracegen.CycleRounder)
+	rounder tracegen.CycleRounder
+
+	// ptp interval in clock cycles
+	ptpIntervalCycles int
+
+	// true if a burst of four ptp packets is currently being inserted in the
+	// trace
+	ptpBurstActive bool
+
+	// counts the number of cycles between to ptp packet bursts
+	ptpInterPacketCycleCounter int
+
+	// counts the number of cycles of ptp packets in a burst (0-4)
+	ptpBurstPacketCounter int
+
+	// counts the total number of ptp packets that have been inserted in the
+	// trace
+	ptpPacketCounter int
+
+	// inter-packet times of ptp packets
+	tInterPacketsPTP []float64
+}
+
+// creates the packet source drawing all random numbers from rnd
+func ptpSourceCreate(rnd *rand.Rand, datarateMean float64) *ptpSource {
+	// get target trace duration and ptp interval
+	duration := exp.Duration.Duration
+	ptpInterval := exp.PTPInterval.Duration
+
 	// packet length is uniformly distributed between 64 and 1518 bytes. Since
 	// MAC will append FCS, the packets we generate here are 4 bytes shorter
-	pktlenMin := 60
-	pktlenMax := 1514
-	pktlenMean := (pktlenMin + pktlenMax) / 2
+	src := &ptpSource{
+		rnd:       rnd,
+		pktlenMin: 60,
+		pktlenMax: 1514,
+	}
+	pktlenMean := (src.pktlenMin + src.pktlenMax) / 2
 
 	// calculate the average time of the gap between two packets (add 24 bytes
 	// for FCS, preamble, SOD and inter-frame gap
-	tGapMean := float64(8*(pktlenMean+24))/datarateMean -
+	src.tGapMean = float64(8*(pktlenMean+24))/datarateMean -
 		float64(8*(pktlenMean+24))/10e9
 
 	// calculate the number of packets we will generate. add 24 bytes to the
 	// packet length to account for Ethernet preamble + SOD, inter-frame gap
 	// and FCS
-	nPkts := round(duration.Seconds() * datarateMean /
+	src.nPkts = round(duration.Seconds() * datarateMean /
 		float64(8*(pktlenMean+24)))
 
-	gofluent10g.Log(gofluent10g.LOG_INFO, "Generating %d packets", nPkts)
-
 	// we will reuse the same ethernet header for all packets, generate source
 	// and destination MAC addresses
 	macSrc, _ := net.ParseMAC("53:00:00:00:00:01")
@@ -84,185 +152,187 @@ func genTrace() (*gofluent10g.Trace, []float64) {
 		DstMAC: macDst,
 	}
 
-	// serialize packet data
+	// serialize packet data. for each packet we transfer 16 bytes of packet
+	// data (14 bytes for the ethernet header, two more for the PTP header
+	// fields we need to set)
 	bufPkt := gopacket.NewSerializeBuffer()
 	err := gopacket.SerializeLayers(bufPkt, gopacket.SerializeOptions{},
 		hdrEth)
 	if err != nil {
 		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
 	}
-	bufPktData := bufPkt.Bytes()[0:16]
-
-	// calculate total amount of trace data we will need to write to the
-	// hardware. for each packet we transfer 8 bytes of meta data and 16 bytes
-	// of packet data (14 bytes for the ethernet header, two more for the PTP
-	// header fields we need to set)
-	bufTraceSize := 24 * uint64(nPkts)
-
-	// trace data must be aligned to 64 byte
-	if bufTraceSize%64 != 0 {
-		bufTraceSize = 64 * (bufTraceSize/64 + 1)
-	}
+	src.bufPktData = bufPkt.Bytes()[0:16]
 
-	// allocate memory
-	bufTrace := make([]byte, bufTraceSize)
+	// convert ptp interval time to clock cycles
+	src.ptpIntervalCycles = int(ptpInterval.Nanoseconds() *
+		gofluent10g.FREQ_SFP / 1e9)
 
-	// accumulated inter-packet clock cycle rounding error
-	accCyclesInterPacketRoundErr := 0.0
+	return src
+}
 
-	// accumulated number of clock cycles between packets
-	accCyclesInterPacket := uint64(0)
+// NextPacket returns the next packet of the trace (see
+// tracegen.PacketSource)
+func (src *ptpSource) NextPacket() ([]byte, int, uint64, error) {
+	if src.i == src.nPkts {
+		return nil, 0, 0, io.EOF
+	}
+	src.i++
 
-	// create data structure to save inter-packet times of ptp packets
-	var tInterPacketsPTP []float64
+	// determine packet length according to uniform distribution
+	lenWire := src.rnd.Intn(src.pktlenMax-src.pktlenMin+1) + src.pktlenMin
 
-	// convert ptp interval time to clock cycles
-	ptpIntervalCycles := int(ptpInterval.Nanoseconds() * gofluent10g.FREQ_SFP /
-		1e9)
+	// calculate the time it takes to transmit this packet
+	tTransfer := float64(8*(lenWire+24)) / 10e9
 
-	// true if a burst of four ptp packets is currently being inserted in the
-	// trace
-	ptpBurstActive := false
+	// get a random gap between this and the next packet
+	tGap := src.tGapMean * src.rnd.ExpFloat64()
 
-	// counts the number of cycles between to ptp packet bursts
-	ptpInterPacketCycleCounter := 0
+	// both times added up -> inter-packet time
+	tInterPacket := tTransfer + tGap
 
-	// counts the number of cycles of ptp packets in a burst (0-4)
-	ptpBurstPacketCounter := 0
+	// hardware does not support inter-packet times larger than 2**32-1 *
+	// T_CLK, so cut if necessary
+	tInterPacketMax := tracegen.CyclesInterPacketMax / gofluent10g.FREQ_SFP
+	if tInterPacket > tInterPacketMax {
+		tInterPacket = tInterPacketMax
+	}
 
-	// counts the total number of ptp packets that have been inserted in the
-	// trace
-	ptpPacketCounter := 0
+	// caculate the number of cycles between packets and round them to an
+	// integer value
+	cyclesInterPacket := src.rounder.Round(tInterPacket * gofluent10g.FREQ_SFP)
 
-	for i := 0; i < nPkts; i++ {
-		// determine packet length according to uniform distribution
-		lenWire := rand.Intn(pktlenMax-pktlenMin+1) + pktlenMin
+	if src.ptpBurstActive ||
+		(src.ptpInterPacketCycleCounter > src.ptpIntervalCycles) {
+		// ether we must insert a ptp packet because a ptp burst is currently
+		// active or because the number of clock cycles between to ptp bursts
+		// is reached
 
-		// calculate the time it takes to transmit this packet
-		tTransfer := float64(8*(lenWire+24)) / 10e9
+		if src.ptpBurstPacketCounter == 0 {
+			// starts a new burst
+			src.ptpBurstActive = true
+		}
 
-		// get a random gap between this and the next packet
-		tGap := tGapMean * rand.ExpFloat64()
+		// set ethertype to ieee1588 (0x88F7), changed byte-order
+		binary.LittleEndian.PutUint16(src.bufPktData[12:14], 0xf788)
 
-		// both times added up -> inter-packet time
-		tInterPacket := tTransfer + tGap
+		// set ptp version to 2
+		binary.LittleEndian.PutUint16(src.bufPktData[15:17], 0x2)
 
-		// hardware does not support inter-packet times larger than 2**32-1 *
-		// T_CLK, so cut if necessary
-		if tInterPacket > 4294967295/gofluent10g.FREQ_SFP {
-			tInterPacket = 4294967295 / gofluent10g.FREQ_SFP
+		// save inter-packet time
+		if src.ptpBurstPacketCounter != 3 {
+			src.tInterPacketsPTP = append(src.tInterPacketsPTP, tInterPacket)
 		}
 
-		// caculate the number of cycles between packets (do not round yet)
-		cyclesInterPacket := tInterPacket * gofluent10g.FREQ_SFP
-
-		// the number of clock cycles between two packets is a floating-point
-		// number, but clock cycles must always be integer values. If we
-		// always round up we are sending too slow, if we always round down
-		// we are sending too fast. Sending too fast at full line-rate causes
-		// timing errors (we cannot send faster than 10 Gbps!). We start by
-		// rounding up and accumulate the resulting rounding error. If the
-		// accumulated error becomes larger than one full clock cycle, we
-		// round down and decrease the accumulated error. On average we will
-		// hit the target mean data rate.
-		if accCyclesInterPacketRoundErr < 1.0 {
-			// not enough rounding error accumulated yet -> round up
-			accCyclesInterPacketRoundErr +=
-				math.Ceil(cyclesInterPacket) - cyclesInterPacket
-			cyclesInterPacket = math.Ceil(cyclesInterPacket)
-		} else {
-			// enough rounding error accumulated -> round down
-			accCyclesInterPacketRoundErr -=
-				cyclesInterPacket - math.Floor(cyclesInterPacket)
-			cyclesInterPacket = math.Floor(cyclesInterPacket)
-		}
+		// increment counters
+		src.ptpPacketCounter++
+		src.ptpBurstPacketCounter++
 
-		// accumulate clock cycles between all packets
-		accCyclesInterPacket += uint64(cyclesInterPacket)
-
-		if ptpBurstActive || (ptpInterPacketCycleCounter > ptpIntervalCycles) {
-			// ether we must insert a ptp packet because a ptp burst is
-			// currently active or because the number of clock cycles between
-			// to ptp bursts is reached
-
-			if ptpBurstPacketCounter == 0 {
-				// starts a new burst
-				ptpBurstActive = true
-			}
-
-			// set ethertype to ieee1588 (0x88F7), changed byte-order
-			binary.LittleEndian.PutUint16(bufPktData[12:14], 0xf788)
-
-			// set ptp version to 2
-			binary.LittleEndian.PutUint16(bufPktData[15:17], 0x2)
-
-			// save inter-packet time
-			if ptpBurstPacketCounter != 3 {
-				tInterPacketsPTP = append(tInterPacketsPTP, tInterPacket)
-			}
-
-			// increment counters
-			ptpPacketCounter++
-			ptpBurstPacketCounter++
-
-			if ptpBurstPacketCounter == 4 {
-				// burst is over
-				ptpBurstActive = false
-				ptpBurstPacketCounter = 0
-			}
-			ptpInterPacketCycleCounter = 0
-		} else {
-			// this is not a ptp packet, so set ethertype to ipv4 (reverse
-			// byte order)
-			binary.LittleEndian.PutUint16(bufPktData[12:14], 0x0008)
+		if src.ptpBurstPacketCounter == 4 {
+			// burst is over
+			src.ptpBurstActive = false
+			src.ptpBurstPacketCounter = 0
 		}
+		src.ptpInterPacketCycleCounter = 0
+	} else {
+		// this is not a ptp packet, so set ethertype to ipv4 (reverse byte
+		// order)
+		binary.LittleEndian.PutUint16(src.bufPktData[12:14], 0x0008)
+	}
 
-		ptpInterPacketCycleCounter += int(cyclesInterPacket)
-
-		// assemble meta data
-		meta := uint64(cyclesInterPacket)
-		meta |= uint64(16) << 32 // capture length. eth header + 2 bytes ptp
-		meta |= uint64(lenWire) << 48
+	src.ptpInterPacketCycleCounter += int(cyclesInterPacket)
 
-		// write meta data
-		binary.LittleEndian.PutUint64(bufTrace[i*24:i*24+8], meta)
+	return src.bufPktData, lenWire, cyclesInterPacket, nil
+}
 
-		// write packet data
-		copy(bufTrace[i*24+8:i*24+24], bufPktData)
+// streams the trace drawing all random numbers from rnd to the trace container
+// file filename and maps it into memory, so that the trace is never assembled
+// in host memory. returns the mapped trace and the inter-packet times of the
+// ptp packets
+func genTrace(rnd *rand.Rand, datarateMean float64,
+	filename string) (*tracegen.MappedTrace, []float64, error) {
+	src := ptpSourceCreate(rnd, datarateMean)
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Generating %d packets", src.nPkts)
+
+	// add all packets to the trace chunk by chunk, the stream adds the
+	// padding for 64 byte alignment
+	s := tracegen.StreamCreate(src, tracegen.ChunkSizeDefault)
+	_, err := tracegen.SaveStream(filename, s, tracegen.Meta{
+		Seed: exp.Seed,
+		Params: map[string]interface{}{
+			"datarate_mean": datarateMean,
+			"duration":      exp.Duration.String(),
+			"ptp_interval":  exp.PTPInterval.String(),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// add padding for 64 byte alignment
-	addr := nPkts * 24
-	for addr%64 != 0 {
-		binary.LittleEndian.PutUint64(bufTrace[addr:addr+8], 0xFFFFFFFFFFFFFFFF)
-		addr += 8
+	trace, err := tracegen.LoadMmap(filename)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// calculate actual replay duration after rounding and print it
-	actualDuration :=
-		time.Duration(float64(accCyclesInterPacket)/gofluent10g.FREQ_SFP*1e9) *
-			time.Nanosecond
+	// print actual replay duration after rounding
 	gofluent10g.Log(gofluent10g.LOG_INFO,
 		"Actual trace duration: %s (Target was %s)",
-		actualDuration, duration)
+		trace.Data.Duration, exp.Duration.Duration)
 
-	gofluent10g.Log(gofluent10g.LOG_INFO, "Generated packets: %d", nPkts)
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Generated packets: %d", src.nPkts)
 	gofluent10g.Log(gofluent10g.LOG_INFO, "Generated PTP packets: %d",
-		ptpPacketCounter)
+		src.ptpPacketCounter)
 
-	// create and return trace
-	return gofluent10g.TraceCreateFromData(bufTrace, nPkts, actualDuration, 1), tInterPacketsPTP
+	return trace, src.tInterPacketsPTP, nil
 }
 
 func main() {
+	// parse command line and load experiment configuration
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagDuration|
+		cli.FlagSaveTraces)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+	datarateMean, err := exp.Datarate()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan(datarateMean).Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("plot_precision", &exp)
+	defer man.Close()
+
 	// create a random traffic trace (uniform distributed packet sizes,
 	// expontentially distributed inter-packet gaps) with a mean data rate of
 	// datarateMean. Every ptpInterval, four packets are replaced by PTP
-	// packets for inter-packet time measurements.
-	trace, tInterPacketsPTP := genTrace()
+	// packets for inter-packet time measurements. The trace is fully
+	// determined by the seed. It is streamed to the output directory and
+	// only kept there with --save-traces (see inspect_trace)
+	traceFilename := filepath.Join(exp.OutDir, "trace.bin")
+	if !opts.SaveTraces {
+		defer os.Remove(traceFilename)
+	}
+	mappedTrace, tInterPacketsPTP, err := genTrace(
+		rand.New(rand.NewSource(exp.Seed)), datarateMean, traceFilename)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not generate trace: %s",
+			err.Error())
+		return
+	}
+	defer mappedTrace.Close()
+	traceData := mappedTrace.Data
+	trace := traceData.Trace()
 
 	// set output filename
-	filename := "output/timestamp_diffs_expected.dat"
+	filename := filepath.Join(exp.OutDir, "timestamp_diffs_expected.dat")
 
 	// open file to write inter-packet times of ptp packets
 	file, err := os.Create(filename)
@@ -282,19 +352,71 @@ func main() {
 	}
 
 	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
 	defer nt.Close()
+	man.SetTester(nt)
 
 	// assign trace to generator on interface 0
-	nt.GetGenerator(0).SetTrace(trace)
+	tester.SetTraceData(nt.GetGenerator(0), trace, traceData.Buf, 1)
 
 	// write network tester configuration
 	nt.WriteConfig()
 
 	// start replay
 	nt.StartReplay()
+
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "plot_precision",
+		exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
+	// write result record. packets are captured by the DPDK application, so
+	// we can only provide the generator side
+	rec := results.NewRecord(fmt.Sprintf("Mean Datarate: %.2f bps",
+		datarateMean))
+	rec.Params["datarate_mean"] = datarateMean
+	rec.Params["duration"] = exp.Duration.String()
+	rec.Params["ptp_interval"] = exp.PTPInterval.String()
+	rec.Params["seed"] = exp.Seed
+	rec.Params["trace_sha256"] = mappedTrace.Meta.Checksum
+	rec.Counters = &results.Counters{
+		PacketsTrace: trace.GetPacketCount(),
+		PacketsTX:    nt.GetInterface(0).GetPacketCountTX(),
+	}
+	rec.Values["ptp_inter_packet_times"] = float64(len(tInterPacketsPTP))
+	rec.Files = []string{filename}
+	resultWriter.Write(rec)
 }
 
 func round(x float64) int {
 	return int(math.Floor(x + 0.5))
 }
+
+func measurementPlan(datarateMean float64) *plan.Plan {
+	p := &plan.Plan{}
+
+	// packet sizes are uniformly distributed between 64 and 1518 bytes,
+	// gaps are exponentially distributed. we transfer 16 bytes of each packet
+	// to the hardware, packets are captured by the DPDK application
+	p.Add(plan.Point{
+		Name: fmt.Sprintf("Mean Datarate: %.2f bps",
+			datarateMean),
+		Datarate:        datarateMean,
+		Pktlen:          (64 + 1518) / 2,
+		Gaps:            tracegen.GapExponential{},
+		TraceCaptureLen: 16,
+		NumGenerators:   1,
+		Duration:        exp.Duration.Duration,
+	})
+	return p
+}
@@ -0,0 +1,105 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// Tests of the streamed precision measurement trace.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plot_precision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exp.Duration.Duration = 5 * time.Millisecond
+	exp.PTPInterval.Duration = 100 * time.Microsecond
+	exp.Seed = 5
+
+	filename := filepath.Join(dir, "trace.bin")
+	trace, tInterPacketsPTP, err := genTrace(rand.New(rand.NewSource(5)),
+		8e9, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trace.Close()
+
+	// the streamed trace matches the trace assembled in memory from the
+	// same seed
+	src := ptpSourceCreate(rand.New(rand.NewSource(5)), 8e9)
+	b := tracegen.BuilderCreate()
+	if err := b.AddPackets(src); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Finish()
+
+	if !bytes.Equal(trace.Data.Buf, data.Buf) ||
+		trace.Data.NumPackets != data.NumPackets ||
+		trace.Data.Duration != data.Duration {
+		t.Fatal("streamed trace differs from trace built in memory")
+	}
+	if trace.Meta.Seed != 5 || trace.Meta.Checksum != data.Checksum() {
+		t.Errorf("invalid meta data %+v", trace.Meta)
+	}
+	if !reflect.DeepEqual(tInterPacketsPTP, src.tInterPacketsPTP) {
+		t.Error("inter-packet times of ptp packets differ")
+	}
+
+	// three inter-packet times are recorded per burst of four ptp packets
+	nPTP := 0
+	d := tracegen.DecoderCreate(trace.Data.Buf)
+	for {
+		pkt, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if binary.BigEndian.Uint16(pkt.Data[12:14]) == 0x88F7 {
+			nPTP++
+		}
+	}
+	if nPTP == 0 || nPTP != src.ptpPacketCounter ||
+		len(tInterPacketsPTP) != 3*(nPTP/4)+nPTP%4 {
+		t.Errorf("%d ptp packets, %d inter-packet times", nPTP,
+			len(tInterPacketsPTP))
+	}
+}
@@ -31,32 +31,66 @@ package main
 
 import (
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 )
 
 var (
-	// data rate
-	datarate = 10e9
-
-	// packet sizes
-	pktlens = []int{64, 104, 152, 200, 256, 304, 352, 400, 456, 504, 552, 600,
-		656, 704, 752, 800, 856, 904, 952, 1000, 1056, 1104, 1152, 1200, 1256,
-		1304, 1352, 1400, 1456, 1518}
-
-	// trace duration
-	duration = 10 * time.Second
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// data rates
+		Datarates: []float64{10e9},
+
+		// packet sizes
+		Pktlens: []int{64, 104, 152, 200, 256, 304, 352, 400, 456, 504, 552,
+			600, 656, 704, 752, 800, 856, 904, 952, 1000, 1056, 1104, 1152,
+			1200, 1256, 1304, 1352, 1400, 1456, 1518},
+
+		// trace duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// output directory
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagPktlens|
+		cli.FlagDuration)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+	datarate, err := exp.Datarate()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan(datarate).Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("plot_required_mem_bandwidth_generate_capture", &exp)
+	defer man.Close()
 
 	// open output file for writing
-	filename := "output/required_membandwidth.dat"
+	filename := filepath.Join(exp.OutDir, "required_membandwidth.dat")
 	file, err := os.Create(filename)
 	if err != nil {
 		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create file '%s'",
@@ -67,18 +101,29 @@ func main() {
 	gofluent10g.Log(gofluent10g.LOG_INFO, "Writing results to file '%s'",
 		filename)
 
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir,
+		"plot_required_mem_bandwidth_generate_capture", exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
 	// iterate over all packet sizes
-	for i, pktlen := range pktlens {
+	for i, pktlen := range exp.Pktlens {
 
 		gofluent10g.Log(gofluent10g.LOG_INFO,
 			"%d/%d: Datarate: 4x %.2f bps, Packet Length: %d",
-			i+1, len(pktlens), datarate, pktlen)
+			i+1, len(exp.Pktlens), datarate, pktlen)
 
 		gofluent10g.LogIncrementIndentLevel()
 		gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
 
 		// generate CBR traffic trace
-		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4, duration, 1)
+		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4,
+			exp.Duration.Duration, 1)
 
 		// calculate required memory bandwidth for concurrent replay and capture
 		// on all four network interfaces
@@ -92,6 +137,19 @@ func main() {
 		// write limit to output file
 		file.WriteString(fmt.Sprintf("%d %f\n", pktlen, memBandwidth))
 
+		// write result record
+		rec := results.NewRecord(fmt.Sprintf("Datarate: 4x %.2f bps, "+
+			"Packet Length: %d", datarate, pktlen))
+		rec.Params["datarate"] = datarate
+		rec.Params["pktlen"] = pktlen
+		rec.Counters = &results.Counters{
+			PacketsTrace: trace.GetPacketCount(),
+		}
+		rec.Values["trace_size"] = float64(trace.GetSize())
+		rec.Values["mem_bandwidth"] = memBandwidth
+		rec.Files = []string{filename}
+		resultWriter.Write(rec)
+
 		// free host memory we do not need anymore
 		trace = nil
 		runtime.GC()
@@ -99,3 +157,19 @@ func main() {
 		gofluent10g.LogDecrementIndentLevel()
 	}
 }
+
+func measurementPlan(datarate float64) *plan.Plan {
+	p := &plan.Plan{}
+	for _, pktlen := range exp.Pktlens {
+		// traces are only generated, not replayed
+		p.Add(plan.Point{
+			Name: fmt.Sprintf("Datarate: 4x %.2f bps, Packet Length: %d",
+				datarate, pktlen),
+			Datarate:        datarate,
+			Pktlen:          pktlen,
+			TraceCaptureLen: pktlen - 4,
+			Duration:        exp.Duration.Duration,
+		})
+	}
+	return p
+}
@@ -31,35 +31,76 @@ package main
 
 import (
 	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/harness"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/integrity"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 var (
-	// per-generator data rate (bisection start point, initial step size and
-	// abort condition)
-	datarateMin       = 8e9
-	datarateStepInit  = 2e9
-	datarateStepLimit = 0.01e9
-
-	// packet sizes
-	pktlens = []int{64, 104, 152, 200, 256, 304, 352, 400, 456, 504, 552, 600,
-		656, 704, 752, 800, 856, 904, 952, 1000, 1056, 1104, 1152, 1200, 1256,
-		1304, 1352, 1400, 1456, 1518}
-
-	// measurement duration
-	duration = 10 * time.Second
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// per-generator data rate (bisection start point, initial step size
+		// and abort condition)
+		Bisection: config.Bisection{
+			Start:     8e9,
+			StepInit:  2e9,
+			StepLimit: 0.01e9,
+		},
+
+		// packet sizes
+		Pktlens: []int{64, 104, 152, 200, 256, 304, 352, 400, 456, 504, 552,
+			600, 656, 704, 752, 800, 856, 904, 952, 1000, 1056, 1104, 1152,
+			1200, 1256, 1304, 1352, 1400, 1456, 1518},
+
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// output directory
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp,
+		cli.FlagPktlens|cli.FlagDuration|cli.FlagSeqTag)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan().Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("plot_throughput_generate_capture", &exp)
+	defer man.Close()
 
 	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
 	defer nt.Close()
+	man.SetTester(nt)
 
 	// when the hardware is unable to replay/capture data fast enough it
 	// sets an error register and stops operation. The library continuously
@@ -76,15 +117,19 @@ func main() {
 	gens := nt.GetGenerators()
 	recvs := nt.GetReceivers()
 
+	// sequence tags embedded into the packets (see --seq-tag)
+	seqTag := seqTagConfig()
+
 	// enable packet capture on all receivers. Discard capture data once it has
-	// been transferred from the FPGA to reduce memory footprint
+	// been transferred from the FPGA to reduce memory footprint, unless the
+	// sequence tags of the captured packets are checked
 	for _, recv := range recvs {
 		recv.EnableCapture(true)
-		recv.SetCaptureDiscard(true)
+		recv.SetCaptureDiscard(seqTag == nil)
 	}
 
 	// open output file for writing
-	filename := "output/max_throughput.dat"
+	filename := filepath.Join(exp.OutDir, "max_throughput.dat")
 	file, err := os.Create(filename)
 	if err != nil {
 		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create file '%s'",
@@ -95,31 +140,53 @@ func main() {
 	gofluent10g.Log(gofluent10g.LOG_INFO, "Writing results to file '%s'",
 		filename)
 
-	// set max capture length to 1518
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir,
+		"plot_throughput_generate_capture", exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
+	// set max capture length to 1518 (or the end of the sequence tag)
 	for _, recv := range recvs {
-		recv.SetCaptureMaxLen(1518)
+		recv.SetCaptureMaxLen(captureMaxLen(seqTag))
 	}
 
 	// iterate over all packet sizes
-	for i, pktlen := range pktlens {
+	for i, pktlen := range exp.Pktlens {
 
 		// initialize bisection values
-		datarate := datarateMin
-		datarateStep := datarateStepInit
+		datarate := exp.Bisection.Start
+		datarateStep := exp.Bisection.StepInit
 		memBandwidthMax := 0.0
 		datarateMax := 0.0
 
 		for {
 			gofluent10g.Log(gofluent10g.LOG_INFO,
 				"%d/%d: Datarate: 4x %.2f bps, Packet Length: %d",
-				i+1, len(pktlens), datarate, pktlen)
+				i+1, len(exp.Pktlens), datarate, pktlen)
 
 			gofluent10g.LogIncrementIndentLevel()
 			gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
 
 			// generate CBR traffic trace
-			trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4,
-				duration, 1)
+			var trace *gofluent10g.Trace
+			var data *tracegen.Data
+			if seqTag == nil {
+				trace = utils.GenTraceCBR(datarate, pktlen, pktlen-4,
+					exp.Duration.Duration, 1)
+			} else {
+				data, err = genTraceTagged(datarate, pktlen, seqTag)
+				if err != nil {
+					gofluent10g.Log(gofluent10g.LOG_ERR, "could not "+
+						"generate trace: %s", err.Error())
+					return
+				}
+				trace = data.Trace()
+			}
 
 			// calculate required memory bandwidth to write the trace
 			// to memory (per network interface, per memory read/write
@@ -129,7 +196,20 @@ func main() {
 
 			// assign traces to generators
 			for _, gen := range gens {
-				gen.SetTrace(trace)
+				if data != nil {
+					tester.SetTraceData(gen, trace, data.Buf, 1)
+				} else {
+					gen.SetTrace(trace)
+				}
+			}
+
+			// captured packets are kept in host memory to check their
+			// sequence tags
+			if seqTag != nil {
+				for _, recv := range recvs {
+					recv.SetCaptureHostMemSize(harness.CaptureMemSize(
+						trace.GetPacketCount(), captureMaxLen(seqTag)))
+				}
 			}
 
 			gofluent10g.Log(gofluent10g.LOG_INFO, "Performing measurement ...")
@@ -149,6 +229,13 @@ func main() {
 			// has throughput limit been reached?
 			var limitReached bool
 
+			// result record of this measurement run
+			rec := results.NewRecord(fmt.Sprintf("Datarate: 4x %.2f bps, "+
+				"Packet Length: %d", datarate, pktlen))
+			rec.Params["datarate"] = datarate
+			rec.Params["pktlen"] = pktlen
+			rec.Values["mem_bandwidth"] = memBandwidth
+
 			if err := nt.CheckErrors(); err != nil {
 				// hardware flagged an error, so throughput limit is reached
 				limitReached = true
@@ -167,8 +254,9 @@ func main() {
 					nPktsTotalCaptured += recvs[i].GetPacketCountCaptured()
 				}
 
-				// make sure number of sent and captured packets matches
-				if nPktsTotalTX != nPktsTotalCaptured {
+				// make sure number of sent and captured packets matches.
+				// tagged packets are checked in detail below
+				if nPktsTotalTX != nPktsTotalCaptured && seqTag == nil {
 					gofluent10g.Log(gofluent10g.LOG_ERR,
 						"nPktsTotalTX != nPktsTotalCaptured")
 				}
@@ -177,7 +265,37 @@ func main() {
 					gofluent10g.Log(gofluent10g.LOG_ERR,
 						"not all trace packets have been replayed")
 				}
+
+				rec.Counters = &results.Counters{
+					PacketsTrace:    4 * trace.GetPacketCount(),
+					PacketsTX:       nPktsTotalTX,
+					PacketsCaptured: nPktsTotalCaptured,
+				}
+
+				// the throughput limit is also reached if the packets
+				// have not been captured intact
+				if seqTag != nil &&
+					!checkIntegrity(recvs, seqTag, trace.GetPacketCount(),
+						rec) {
+					limitReached = true
+					gofluent10g.Log(gofluent10g.LOG_INFO, "Throughput "+
+						"limit reached. Packets have been lost, "+
+						"duplicated, reordered or corrupted")
+				}
+			}
+
+			// write result record of this measurement run
+			if limitReached {
+				rec.Values["limit_reached"] = 1.0
+			} else {
+				rec.Values["limit_reached"] = 0.0
 			}
+			resultWriter.Write(rec)
+
+			// free host memory we do not need anymore
+			trace = nil
+			data = nil
+			nt.FreeHostMemory()
 
 			// keep track of the maximum data rate and packets per second
 			// we can achieve
@@ -186,7 +304,8 @@ func main() {
 				memBandwidthMax = memBandwidth
 			}
 
-			if datarateStep <= datarateStepLimit || datarateMax >= 10e9 {
+			if datarateStep <= exp.Bisection.StepLimit ||
+				datarateMax >= 10e9 {
 				// bisection abort condition satisfied
 
 				gofluent10g.Log(gofluent10g.LOG_INFO,
@@ -209,6 +328,15 @@ func main() {
 				file.WriteString(fmt.Sprintf("%d %f %f\n", pktlen,
 					datarateMax, memBandwidthMax))
 
+				// write result record of the bisection
+				rec := results.NewRecord(fmt.Sprintf("Throughput Limit, "+
+					"Packet Length: %d", pktlen))
+				rec.Params["pktlen"] = pktlen
+				rec.Values["datarate_max"] = datarateMax
+				rec.Values["mem_bandwidth_max"] = memBandwidthMax
+				rec.Files = []string{filename}
+				resultWriter.Write(rec)
+
 				// done for this packet length
 				gofluent10g.LogDecrementIndentLevel()
 				break
@@ -222,11 +350,119 @@ func main() {
 				datarateStep /= 2.0
 			}
 
-			// free host memory we do not need anymore
-			trace = nil
-			nt.FreeHostMemory()
-
 			gofluent10g.LogDecrementIndentLevel()
 		}
 	}
 }
+
+// returns the sequence tags embedded into the packets (see --seq-tag) or nil
+// if packets are not tagged. The configuration has been validated before
+func seqTagConfig() *tracegen.SeqTag {
+	if !exp.SeqTag.Enabled {
+		return nil
+	}
+	offset, _ := exp.SeqTagOffset()
+	return &tracegen.SeqTag{Offset: offset}
+}
+
+// returns the maximum number of bytes captured per packet. If packets carry
+// sequence tags, only the bytes up to the end of the tag are captured
+func captureMaxLen(seqTag *tracegen.SeqTag) int {
+	if seqTag != nil {
+		return seqTag.Offset + tracegen.SeqTagLen
+	}
+	return 1518
+}
+
+// generates a CBR trace of packets carrying sequence tags. Only the packet
+// headers and the tag are transferred to the hardware
+func genTraceTagged(datarate float64, pktlen int,
+	seqTag *tracegen.SeqTag) (*tracegen.Data, error) {
+	pktlens, err := tracegen.PktlenDistCreate([]int{pktlen}, []float64{1.0})
+	if err != nil {
+		return nil, err
+	}
+
+	// bursts of a single packet are sent with constant gaps
+	gen := tracegen.GenTraffic(tracegen.Traffic{
+		Datarate:   datarate,
+		CaptureLen: seqTag.Offset + tracegen.SeqTagLen,
+		Duration:   exp.Duration.Duration,
+		Pktlens:    pktlens,
+		Gaps:       tracegen.GapOnOff{BurstLen: 1},
+		Headers:    exp.Headers,
+		SeqTag:     seqTag,
+	})
+	return tracegen.Generate(gen, exp.Seed)
+}
+
+// checks the sequence tags of the packets captured by the receivers, each of
+// which captures the nPkts packets of the trace replayed by its generator.
+// The results of all receivers are summed up and added to the result record.
+// Returns true if all packets have been captured exactly once, in order and
+// without corruption.
+func checkIntegrity(recvs tester.Receivers, seqTag *tracegen.SeqTag,
+	nPkts int, rec *results.Record) bool {
+	ok := true
+	var lost, duplicated, reordered, corrupted, untagged uint64
+	for i, recv := range recvs {
+		report := integrity.Check(recv.GetCapture().GetPackets(),
+			seqTag.Offset, map[uint32]uint64{seqTag.FlowID: uint64(nPkts)})
+
+		gofluent10g.Log(gofluent10g.LOG_INFO, "Interface %d: %d lost, %d "+
+			"duplicated, %d reordered, %d corrupted, %d untagged packets",
+			i, report.Lost(), report.Duplicates(), report.Reordered(),
+			report.Corrupted, report.Untagged)
+
+		lost += report.Lost()
+		duplicated += report.Duplicates()
+		reordered += report.Reordered()
+		corrupted += report.Corrupted
+		untagged += report.Untagged
+		ok = ok && report.OK()
+	}
+
+	rec.Values["packets_lost"] = float64(lost)
+	rec.Values["packets_duplicated"] = float64(duplicated)
+	rec.Values["packets_reordered"] = float64(reordered)
+	rec.Values["packets_corrupted"] = float64(corrupted)
+	rec.Values["packets_untagged"] = float64(untagged)
+
+	return ok
+}
+
+func measurementPlan() *plan.Plan {
+	p := &plan.Plan{}
+
+	seqTag := seqTagConfig()
+
+	// number of measurement runs of the data rate bisection per packet size
+	runs := plan.BisectionRuns(exp.Bisection.StepInit,
+		exp.Bisection.StepLimit)
+
+	for _, pktlen := range exp.Pktlens {
+		// only headers and sequence tags are transferred if packets are
+		// tagged
+		traceCaptureLen := pktlen - 4
+		if seqTag != nil {
+			traceCaptureLen = captureMaxLen(seqTag)
+		}
+
+		// resources are estimated for the highest data rate the bisection
+		// may reach
+		p.Add(plan.Point{
+			Name: fmt.Sprintf("Datarate: up to 4x %.2f bps, Packet Length: %d",
+				10e9, pktlen),
+			Datarate:        10e9,
+			Pktlen:          pktlen,
+			TraceCaptureLen: traceCaptureLen,
+			NumGenerators:   4,
+			NumReceivers:    4,
+			CaptureMaxLen:   captureMaxLen(seqTag),
+			CaptureDiscard:  seqTag == nil,
+			Duration:        exp.Duration.Duration,
+			Runs:            runs,
+		})
+	}
+	return p
+}
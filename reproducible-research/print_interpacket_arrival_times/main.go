@@ -30,145 +30,179 @@
 package main
 
 import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/harness"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
+	"os"
 	"sort"
 	"time"
 )
 
 var (
-	// measurement data rates
-	datarates = []float64{100e6, 1e9, 5e9, 10e9}
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// measurement data rates
+		Datarates: []float64{100e6, 1e9, 5e9, 10e9},
 
-	// meausrement packet sizes
-	pktlens = []int{64, 1518}
+		// meausrement packet sizes
+		Pktlens: []int{64, 1518},
 
-	// generator interface id
-	ifGen = 0
+		// generator interface id
+		IfGen: 0,
 
-	// receiver interface id
-	ifRecv = 1
+		// receiver interface id
+		IfRecv: 1,
 
-	// measurement duration
-	duration = 10 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// output directory (unused, results are only logged)
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
-
-	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
-	defer nt.Close()
-
-	// get generator and receivers
-	gen := nt.GetGenerator(ifGen)
-	recv := nt.GetReceiver(ifRecv)
-
-	// enable packet capture on receiver interface. since we are only
-	// interested in the inter-packet arrival times, we disable the capturing
-	// of packet data
-	recv.EnableCapture(true)
-	recv.SetCaptureMaxLen(0)
-
-	// iterate over all data rates
-	for i, datarate := range datarates {
-
-		// iterate over all packet sizes
-		for j, pktlen := range pktlens {
-			gofluent10g.Log(gofluent10g.LOG_INFO, "%d/%d: Datarate: %.2f bps, "+
-				"Packet length: %d", (i*len(pktlens) + j + 1),
-				len(datarates)*len(pktlens), datarate, pktlen)
-
-			gofluent10g.LogIncrementIndentLevel()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
-
-			// generate CBR trace data with fixed packet length. Trace duration
-			// is 10 seconds. we only transfer the first 34 bytes of each
-			// packet down to hardware (contains ethernet and ipv4 headers),
-			// hardware will append zero bytes before transmission to restore
-			// the original packet lengths
-			trace := utils.GenTraceCBR(datarate, pktlen, 34, duration, 1)
-
-			// assign trace to generator
-			gen.SetTrace(trace)
-
-			// calculate the host memory size we need to store the capture data.
-			// we only store meta data (8 byte) for each packet, no packet
-			// data
-			captureMemSize := uint64(trace.GetPacketCount()) * 8
-
-			// set receiver capture host memory size
-			recv.SetCaptureHostMemSize(captureMemSize)
-
-			// write config to hardware
-			nt.WriteConfig()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Starting replay and capture ...")
-
-			// start capturing
-			nt.StartCapture()
-
-			// start replay (blocks until replay finished)
-			nt.StartReplay()
-
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Replay done")
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagPktlens|
+		cli.FlagDuration|cli.FlagInterfaces|cli.FlagSaveCaptures)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
 
-			// wait a little to make sure all packets have been captured
-			time.Sleep(time.Second)
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan().Print(os.Stdout)
+		return
+	}
 
-			// stop capturing
-			nt.StopCapture()
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("print_interpacket_arrival_times", &exp)
+	defer man.Close()
 
-			gofluent10g.Log(gofluent10g.LOG_INFO, "Capture done")
+	// open network tester
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
+	defer nt.Close()
+	man.SetTester(nt)
 
-			// get capture data structure
-			capture := recv.GetCapture()
+	// create one measurement point for each data rate and packet size
+	var points []harness.Point
+	for _, datarate := range exp.Datarates {
+		for _, pktlen := range exp.Pktlens {
+			points = append(points, measurementPoint(datarate, pktlen))
+		}
+	}
 
-			// get captured packets
-			pkts := capture.GetPackets()
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir,
+		"print_interpacket_arrival_times", exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
 
-			// make sure all generated packets arrived back at the receiver
-			if len(pkts) != trace.GetPacketCount() {
-				gofluent10g.Log(gofluent10g.LOG_ERR,
-					"not all generated packets arrived back at the receiver")
-			}
+	h := harness.Create(nt)
+	h.SetResultWriter(resultWriter)
+	if opts.SaveCaptures {
+		h.SetCaptureDir(exp.OutDir)
+	}
+	h.RunAll(points)
+}
 
-			gofluent10g.Log(gofluent10g.LOG_INFO,
-				"Calculating arrival time statistics ...")
+func measurementPoint(datarate float64, pktlen int) harness.Point {
+	return harness.Point{
+		Name: fmt.Sprintf("Datarate: %.2f bps, Packet length: %d", datarate,
+			pktlen),
+
+		// generate CBR trace data with fixed packet length. we only transfer
+		// the first 34 bytes of each packet down to hardware (contains
+		// ethernet and ipv4 headers), hardware will append zero bytes before
+		// transmission to restore the original packet lengths
+		GenTrace: func() *gofluent10g.Trace {
+			return utils.GenTraceCBR(datarate, pktlen, 34,
+				exp.Duration.Duration, 1)
+		},
+
+		Params: map[string]interface{}{
+			"datarate": datarate,
+			"pktlen":   pktlen,
+		},
+
+		IfGen:  exp.IfGen,
+		IfRecv: exp.IfRecv,
+
+		// since we are only interested in the inter-packet arrival times, we
+		// disable the capturing of packet data
+		CaptureMaxLen: 0,
+
+		Analyze: printArrivalTimeStats,
+	}
+}
 
-			// get packet arrival times
-			arrivalTimes := pkts.GetArrivalTimes()
+func printArrivalTimeStats(res *harness.Result) {
+	gofluent10g.Log(gofluent10g.LOG_INFO,
+		"Calculating arrival time statistics ...")
 
-			// inter-packet arrival time is a relative metric -> value
-			// for first packet is not meaningful
-			arrivalTimes = arrivalTimes[1 : len(arrivalTimes)-1]
+	// get packet arrival times
+	arrivalTimes := res.Packets.GetArrivalTimes()
 
-			// get minimum and maximum inter-packet arrival times
-			sort.Sort(sort.Float64Slice(arrivalTimes))
-			arrivalTimeMin := arrivalTimes[0]
-			arrivalTimeMax := arrivalTimes[len(arrivalTimes)-1]
+	// inter-packet arrival time is a relative metric -> value
+	// for first packet is not meaningful
+	arrivalTimes = arrivalTimes[1 : len(arrivalTimes)-1]
 
-			// convert inter-packet arrival times to nanoseconds
-			arrivalTimeMin *= 1e9
-			arrivalTimeMax *= 1e9
+	// get minimum and maximum inter-packet arrival times
+	sort.Sort(sort.Float64Slice(arrivalTimes))
+	arrivalTimeMin := arrivalTimes[0]
+	arrivalTimeMax := arrivalTimes[len(arrivalTimes)-1]
 
-			// output information
-			gofluent10g.Log(gofluent10g.LOG_INFO,
-				"Minimum inter-packet arrival time: %.2f ns", arrivalTimeMin)
-			gofluent10g.Log(gofluent10g.LOG_INFO,
-				"Maxmimum inter-packet arrival time: %.2f ns", arrivalTimeMax)
+	// convert inter-packet arrival times to nanoseconds
+	arrivalTimeMin *= 1e9
+	arrivalTimeMax *= 1e9
 
-			// reset pointers pointing to data we do not need anymore
-			trace = nil
-			capture = nil
-			pkts = nil
+	// output information
+	gofluent10g.Log(gofluent10g.LOG_INFO,
+		"Minimum inter-packet arrival time: %.2f ns", arrivalTimeMin)
+	gofluent10g.Log(gofluent10g.LOG_INFO,
+		"Maxmimum inter-packet arrival time: %.2f ns", arrivalTimeMax)
 
-			// free memory
-			nt.FreeHostMemory()
+	// add inter-packet arrival times to result record
+	res.Record.Values["arrival_time_min_ns"] = arrivalTimeMin
+	res.Record.Values["arrival_time_max_ns"] = arrivalTimeMax
+}
 
-			gofluent10g.LogDecrementIndentLevel()
+func measurementPlan() *plan.Plan {
+	p := &plan.Plan{}
+	for _, datarate := range exp.Datarates {
+		for _, pktlen := range exp.Pktlens {
+			p.Add(plan.Point{
+				Name: fmt.Sprintf("Datarate: %.2f bps, Packet length: %d",
+					datarate, pktlen),
+				Datarate:        datarate,
+				Pktlen:          pktlen,
+				TraceCaptureLen: 34,
+				NumGenerators:   1,
+				NumReceivers:    1,
+				CaptureMaxLen:   0,
+				Duration:        exp.Duration.Duration,
+				DrainTime:       harness.DrainTimeDefault,
+			})
 		}
 	}
+	return p
 }
@@ -0,0 +1,252 @@
+// The MIT License
+//
+// Copyright (c) 2017-2018 by the author(s)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Author(s):
+//   - Andreas Oeldemann <andreas.oeldemann@tum.de>
+//
+// Description:
+//
+// see README.md
+
+package main
+
+import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/harness"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/stats"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tracegen"
+	"github.com/aoeldemann/gofluent10g"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// generator interface id
+		IfGen: 0,
+
+		// receiver interface id
+		IfRecv: 1,
+
+		// unused, the replay duration is given by the PCAP file
+		Duration: config.Duration{Duration: time.Second},
+
+		// timestamps are disabled by default, since they overwrite packet
+		// data. configure a timestamp position and width to measure latency
+		Timestamp: config.Timestamp{Pos: 0, Width: 0},
+
+		// transfer the first 64 bytes of each packet to the hardware,
+		// replay at original speed
+		Pcap: config.Pcap{CaptureLen: 64, Speedup: 1.0},
+
+		// output directory
+		OutDir: "output",
+	}
+)
+
+func main() {
+	// parse command line and load experiment configuration
+	opts, err := cli.Parse(&exp, cli.FlagInterfaces|cli.FlagPcap|
+		cli.FlagLatency|cli.FlagSaveTraces|cli.FlagSaveCaptures)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	if exp.Pcap.File == "" {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "no PCAP file specified "+
+			"(--pcap)")
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan().Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("replay_pcap", &exp)
+	defer man.Close()
+
+	// open network tester
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
+	defer nt.Close()
+	man.SetTester(nt)
+
+	// set up timestamping
+	if exp.Timestamp.Width > 0 {
+		nt.SetTimestampMode(gofluent10g.TimestampModeFixedPos)
+		nt.SetTimestampPos(exp.Timestamp.Pos)
+		nt.SetTimestampWidth(exp.Timestamp.Width)
+	} else {
+		nt.SetTimestampMode(gofluent10g.TimestampModeDisabled)
+	}
+
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "replay_pcap", exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
+	h := harness.Create(nt)
+	h.SetResultWriter(resultWriter)
+	if opts.SaveCaptures {
+		h.SetCaptureDir(exp.OutDir)
+	}
+
+	// histogram binning has been validated with the configuration
+	binning, _ := stats.ParseBinning(exp.Histogram.Binning)
+	h.SetHistogram(binning, exp.Histogram.CDF)
+	h.SetLatencySeries(exp.LatencySeries.Packets,
+		exp.LatencySeries.WindowWidths())
+
+	h.RunAll([]harness.Point{measurementPoint(opts.SaveTraces)})
+}
+
+func measurementPoint(saveTrace bool) harness.Point {
+	// statistics of the imported PCAP file
+	var stats *tracegen.PcapStats
+
+	params := map[string]interface{}{
+		"pcap":        exp.Pcap.File,
+		"capture_len": exp.Pcap.CaptureLen,
+		"speedup":     exp.Pcap.Speedup,
+		"line_rate":   exp.Pcap.LineRate,
+	}
+
+	return harness.Point{
+		Name: fmt.Sprintf("PCAP: %s", exp.Pcap.File),
+
+		GenTraceData: func() (*tracegen.Data, int) {
+			var data *tracegen.Data
+			data, stats = importPcap()
+
+			// save trace for inspection (see inspect_trace)
+			if saveTrace {
+				filename := filepath.Join(exp.OutDir, "trace.bin")
+				err := data.Save(filename, tracegen.Meta{Params: params})
+				if err != nil {
+					gofluent10g.Log(gofluent10g.LOG_ERR, "could not save "+
+						"trace to '%s': %s", filename, err.Error())
+				}
+			}
+
+			return data, 1
+		},
+
+		Params: params,
+
+		IfGen:  exp.IfGen,
+		IfRecv: exp.IfRecv,
+
+		// we are only interested in packet counts and latency, so we disable
+		// the capturing of packet data
+		CaptureMaxLen: 0,
+
+		Analyze: func(res *harness.Result) {
+			res.Record.Values["duration_orig"] = stats.DurationOrig.Seconds()
+			res.Record.Values["packets_line_rate_limited"] =
+				float64(stats.NumLineRateLimited)
+			res.Record.Values["gaps_capped"] = float64(stats.NumGapsCapped)
+			res.Record.Values["packets_padded"] = float64(stats.NumPadded)
+
+			if exp.Timestamp.Width > 0 {
+				harness.WriteLatencyHistogram(res,
+					filepath.Join(exp.OutDir, "histogram.dat"))
+			}
+		},
+	}
+}
+
+// imports the configured PCAP file. The program aborts if the file cannot be
+// imported
+func importPcap() (*tracegen.Data, *tracegen.PcapStats) {
+	data, stats, err := tracegen.ImportPcap(exp.Pcap.File,
+		tracegen.PcapOptions{
+			CaptureLen: exp.Pcap.CaptureLen,
+			Speedup:    exp.Pcap.Speedup,
+			LineRate:   exp.Pcap.LineRate,
+		})
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not import PCAP file: "+
+			"%s", err.Error())
+	}
+
+	gofluent10g.Log(gofluent10g.LOG_INFO, "Imported %d packets (original "+
+		"duration: %s, replay duration: %s)", stats.NumPackets,
+		stats.DurationOrig, data.Duration)
+	if stats.NumLineRateLimited > 0 {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "%d packets delayed to not "+
+			"exceed line rate", stats.NumLineRateLimited)
+	}
+	if stats.NumGapsCapped > 0 {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "%d inter-packet times cut "+
+			"to hardware limit", stats.NumGapsCapped)
+	}
+	if stats.NumPadded > 0 {
+		gofluent10g.Log(gofluent10g.LOG_INFO, "%d packets shorter than "+
+			"minimum frame size", stats.NumPadded)
+	}
+
+	return data, stats
+}
+
+func measurementPlan() *plan.Plan {
+	// the PCAP file determines the traffic, so we have to import it
+	data, stats := importPcap()
+
+	// wire lengths of the trace exclude the FCS. the data rate includes
+	// FCS, preamble, SOD and inter-frame gap (24 bytes) of each packet, the
+	// mean packet size includes the FCS
+	p := &plan.Plan{}
+	p.Add(plan.Point{
+		Name: fmt.Sprintf("PCAP: %s", exp.Pcap.File),
+		Datarate: float64(8*(stats.BytesWire+24*uint64(stats.NumPackets))) /
+			data.Duration.Seconds(),
+		Pktlen:          int(stats.BytesWire/uint64(stats.NumPackets)) + 4,
+		TraceCaptureLen: len(data.Buf)/stats.NumPackets - 8,
+		NumGenerators:   1,
+		NumReceivers:    1,
+		CaptureMaxLen:   0,
+		Duration:        data.Duration,
+		DrainTime:       harness.DrainTimeDefault,
+	})
+	return p
+}
@@ -30,46 +30,100 @@
 package main
 
 import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
+	"os"
 	"time"
 )
 
 var (
-	// per-generator data rate
-	datarate = 10e9
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// per-generator data rate
+		Datarates: []float64{10e9},
 
-	// packet sizes
-	pktlens = []int{64, 100, 300, 500, 700, 900, 1100, 1300, 1518}
+		// packet sizes
+		Pktlens: []int{64, 100, 300, 500, 700, 900, 1100, 1300, 1518},
 
-	// measurement duration
-	duration = 10 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
+
+		// output directory (unused, results are only logged)
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagPktlens|
+		cli.FlagDuration)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+	datarate, err := exp.Datarate()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan(datarate).Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("validate_generate_40Gbps", &exp)
+	defer man.Close()
 
 	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
 	defer nt.Close()
+	man.SetTester(nt)
 
 	// get generators
 	gens := nt.GetGenerators()
 
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir, "validate_generate_40Gbps",
+		exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
 	// iterate over all packet sizes
-	for i, pktlen := range pktlens {
+	for i, pktlen := range exp.Pktlens {
 
 		gofluent10g.Log(gofluent10g.LOG_INFO,
 			"%d/%d Replay: Datarate: 4x %.2f bps (duplex), "+
-				"Packet Length: %d", (i + 1), len(pktlens), datarate, pktlen)
+				"Packet Length: %d", (i + 1), len(exp.Pktlens), datarate,
+			pktlen)
 
 		gofluent10g.LogIncrementIndentLevel()
 
 		gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
 
 		// generate CBR traffic trace
-		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4, duration, 1)
+		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4,
+			exp.Duration.Duration, 1)
 
 		// assign traces to generators
 		for _, gen := range gens {
@@ -87,6 +141,19 @@ func main() {
 		gofluent10g.Log(gofluent10g.LOG_INFO, "done! (hardware did not flag "+
 			"error, so this was a success!)")
 
+		// write result record
+		rec := results.NewRecord(fmt.Sprintf("Replay: Datarate: 4x %.2f bps "+
+			"(duplex), Packet Length: %d", datarate, pktlen))
+		rec.Params["datarate"] = datarate
+		rec.Params["pktlen"] = pktlen
+		rec.Counters = &results.Counters{
+			PacketsTrace: len(gens) * trace.GetPacketCount(),
+		}
+		for i := range gens {
+			rec.Counters.PacketsTX += nt.GetInterface(i).GetPacketCountTX()
+		}
+		resultWriter.Write(rec)
+
 		// free host memory we do not need anymore
 		trace = nil
 		nt.FreeHostMemory()
@@ -97,5 +164,21 @@ func main() {
 	// no errors occurs, so this was a success!
 	gofluent10g.Log(gofluent10g.LOG_INFO, "Successfully maintained replay "+
 		"data rate of 4x %.2f bps for the following packet sizes: %d", datarate,
-		pktlens)
+		exp.Pktlens)
+}
+
+func measurementPlan(datarate float64) *plan.Plan {
+	p := &plan.Plan{}
+	for _, pktlen := range exp.Pktlens {
+		p.Add(plan.Point{
+			Name: fmt.Sprintf("Replay: Datarate: 4x %.2f bps (duplex), "+
+				"Packet Length: %d", datarate, pktlen),
+			Datarate:        datarate,
+			Pktlen:          pktlen,
+			TraceCaptureLen: pktlen - 4,
+			NumGenerators:   4,
+			Duration:        exp.Duration.Duration,
+		})
+	}
+	return p
 }
@@ -30,40 +30,82 @@
 package main
 
 import (
+	"fmt"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/cli"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/config"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/manifest"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/plan"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/results"
+	"github.com/aoeldemann/fluent10g-paper-fpl2018/reproducible-research/internal/tester"
 	"github.com/aoeldemann/gofluent10g"
 	"github.com/aoeldemann/gofluent10g/utils"
+	"os"
 	"time"
 )
 
 var (
-	// per-generator data rate
-	datarate = 10e9
+	// default experiment configuration, can be overridden with a
+	// configuration file (see internal/config)
+	exp = config.Experiment{
+		// per-generator data rate
+		Datarates: []float64{10e9},
 
-	// packet sizes
-	pktlens = []int{64, 100, 300, 500, 700, 900, 1100, 1300, 1518}
+		// packet sizes
+		Pktlens: []int{64, 100, 300, 500, 700, 900, 1100, 1300, 1518},
 
-	// measurement duration
-	duration = 10 * time.Second
+		// measurement duration
+		Duration: config.Duration{Duration: 10 * time.Second},
 
-	// generator and receiver interface ids
-	ifsGen  = []int{0, 1, 2}
-	ifsRecv = []int{0, 1, 3}
+		// generator and receiver interface ids
+		IfsGen:  []int{0, 1, 2},
+		IfsRecv: []int{0, 1, 3},
+
+		// output directory (unused, results are only logged)
+		OutDir: "output",
+	}
 )
 
 func main() {
-	// set log level to INFO to reduce verbosity of output
-	gofluent10g.LogSetLevel(gofluent10g.LOG_INFO)
+	// parse command line and load experiment configuration. log level
+	// defaults to INFO to reduce verbosity of output
+	opts, err := cli.Parse(&exp, cli.FlagRates|cli.FlagPktlens|
+		cli.FlagDuration|cli.FlagInterfaces)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+	datarate, err := exp.Datarate()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "%s", err.Error())
+		return
+	}
+
+	// print measurement plan in dry-run mode
+	if opts.DryRun {
+		measurementPlan(datarate).Print(os.Stdout)
+		return
+	}
+
+	// record software versions, environment and configuration of this run
+	man := manifest.Create("validate_generate_capture_30Gbps", &exp)
+	defer man.Close()
 
 	// open network tester
-	nt := gofluent10g.NetworkTesterCreate()
+	nt, err := tester.Create()
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not open network "+
+			"tester: %s", err.Error())
+		return
+	}
 	defer nt.Close()
+	man.SetTester(nt)
 
 	// get generators and receivers
-	gens := make(gofluent10g.Generators, 3)
-	recvs := make(gofluent10g.Receivers, 3)
-	for i := 0; i < 3; i++ {
-		gens[i] = nt.GetGenerator(ifsGen[i])
-		recvs[i] = nt.GetReceiver(ifsRecv[i])
+	gens := make(tester.Generators, len(exp.IfsGen))
+	recvs := make(tester.Receivers, len(exp.IfsRecv))
+	for i := range exp.IfsGen {
+		gens[i] = nt.GetGenerator(exp.IfsGen[i])
+		recvs[i] = nt.GetReceiver(exp.IfsRecv[i])
 	}
 
 	// enable packet capture on all receivers. we want to capture entire
@@ -75,19 +117,31 @@ func main() {
 		recv.SetCaptureDiscard(true)
 	}
 
+	// create result record file
+	resultWriter, err := results.Create(exp.OutDir,
+		"validate_generate_capture_30Gbps", exp.Seed)
+	if err != nil {
+		gofluent10g.Log(gofluent10g.LOG_ERR, "could not create result "+
+			"record file: %s", err.Error())
+		return
+	}
+	defer resultWriter.Close()
+
 	// iterate over all packet sizes
-	for i, pktlen := range pktlens {
+	for i, pktlen := range exp.Pktlens {
 
 		gofluent10g.Log(gofluent10g.LOG_INFO,
-			"%d/%d Replay + Capture: Datarate: 3x %.2f bps (each), "+
-				"Packet Length: %d", (i + 1), len(pktlens), datarate, pktlen)
+			"%d/%d Replay + Capture: Datarate: %dx %.2f bps (each), "+
+				"Packet Length: %d", (i + 1), len(exp.Pktlens), len(gens),
+			datarate, pktlen)
 
 		gofluent10g.LogIncrementIndentLevel()
 
 		gofluent10g.Log(gofluent10g.LOG_INFO, "Generating trace ...")
 
 		// generate CBR traffic trace
-		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4, duration, 1)
+		trace := utils.GenTraceCBR(datarate, pktlen, pktlen-4,
+			exp.Duration.Duration, 1)
 
 		// assign traces to generators
 		for _, gen := range gens {
@@ -111,6 +165,22 @@ func main() {
 		gofluent10g.Log(gofluent10g.LOG_INFO, "done! (hardware did not flag "+
 			"error, so this was a success!)")
 
+		// write result record
+		rec := results.NewRecord(fmt.Sprintf("Replay + Capture: Datarate: "+
+			"%dx %.2f bps (each), Packet Length: %d", len(gens), datarate,
+			pktlen))
+		rec.Params["datarate"] = datarate
+		rec.Params["pktlen"] = pktlen
+		rec.Counters = &results.Counters{
+			PacketsTrace: len(gens) * trace.GetPacketCount(),
+		}
+		for i := range gens {
+			rec.Counters.PacketsTX +=
+				nt.GetInterface(exp.IfsGen[i]).GetPacketCountTX()
+			rec.Counters.PacketsCaptured += recvs[i].GetPacketCountCaptured()
+		}
+		resultWriter.Write(rec)
+
 		// free host memory we do not need anymore
 		trace = nil
 		nt.FreeHostMemory()
@@ -120,6 +190,26 @@ func main() {
 
 	// no errors occurs, so this was a success!
 	gofluent10g.Log(gofluent10g.LOG_INFO, "Successfully maintained replay and "+
-		"capture data rate of 3x %.2f bps for the following packet sizes: %d",
-		datarate, pktlens)
+		"capture data rate of %dx %.2f bps for the following packet sizes: %d",
+		len(gens), datarate, exp.Pktlens)
+}
+
+func measurementPlan(datarate float64) *plan.Plan {
+	p := &plan.Plan{}
+	for _, pktlen := range exp.Pktlens {
+		p.Add(plan.Point{
+			Name: fmt.Sprintf("Replay + Capture: Datarate: %dx %.2f bps "+
+				"(each), Packet Length: %d", len(exp.IfsGen), datarate,
+				pktlen),
+			Datarate:        datarate,
+			Pktlen:          pktlen,
+			TraceCaptureLen: pktlen - 4,
+			NumGenerators:   len(exp.IfsGen),
+			NumReceivers:    len(exp.IfsRecv),
+			CaptureMaxLen:   1518,
+			CaptureDiscard:  true,
+			Duration:        exp.Duration.Duration,
+		})
+	}
+	return p
 }